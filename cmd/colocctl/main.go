@@ -0,0 +1,286 @@
+package main
+
+/**
+author:liuyang
+date:2025-5-20
+colocctl: 运维命令行工具，通过管理接口查看和控制节点上的混部内存插件
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/admin"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `Usage: colocctl [flags] <command> [args]
+
+Commands:
+  blocks             list colocation memory blocks
+  pods               list colocation pods and their memory tier
+  capacity           show the colocation memory capacity breakdown
+  decisions [n]      show the last n adjustment decisions
+  drain [pod...]     swap the given pods (default: all pods with bound blocks) out to pooled memory
+  reclaim            try to swap pods back to DRAM now
+  adjust             refresh memory state and adjust blocks now
+  pause | resume     pause or resume the automatic loops
+
+Flags:
+`
+
+func main() {
+	// 与插件读取同样的环境变量，默认连接插件的管理接口
+	config, err := common.LoadConfig()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	socket := flag.String("socket", config.AdminSocket, "admin socket of the device plugin")
+	output := flag.String("o", "table", "output format: table or json")
+	timeout := flag.Duration("timeout", 2*time.Minute, "request timeout, swap-outs may take a while")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fatalf("unknown output format %q", *output)
+	}
+
+	c := &cli{client: admin.NewClient(*socket, *timeout), json: *output == "json"}
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "blocks":
+		err = c.blocks()
+	case "pods":
+		err = c.pods()
+	case "capacity":
+		err = c.capacity()
+	case "decisions":
+		err = c.decisions(args)
+	case "drain":
+		err = c.drain(args)
+	case "reclaim":
+		err = c.reclaim()
+	case "adjust":
+		err = c.adjust()
+	case "pause":
+		err = c.client.Pause()
+	case "resume":
+		err = c.client.Resume()
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+type cli struct {
+	client *admin.Client
+	json   bool
+}
+
+func (c *cli) blocks() error {
+	state, err := c.client.State()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(state.Blocks)
+	}
+	printBlocks(state.Blocks)
+	return nil
+}
+
+func (c *cli) pods() error {
+	state, err := c.client.State()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(state.Pods)
+	}
+	printPods(state.Pods)
+	return nil
+}
+
+func (c *cli) capacity() error {
+	state, err := c.client.State()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(state.Capacity)
+	}
+	printCapacity(state)
+	return nil
+}
+
+func (c *cli) decisions(args []string) error {
+	n := 10
+	if len(args) > 0 {
+		if _, err := fmt.Sscan(args[0], &n); err != nil {
+			return fmt.Errorf("invalid count %q", args[0])
+		}
+	}
+	decisions, err := c.client.Decisions(n)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(decisions)
+	}
+	for _, d := range decisions {
+		fmt.Printf("%s  %s\n", d.Time.Format(time.RFC3339), d)
+	}
+	return nil
+}
+
+// drain 把Pod交换到池化内存，未指定Pod时交换所有还绑定DRAM块的Pod
+func (c *cli) drain(pods []string) error {
+	if len(pods) == 0 {
+		state, err := c.client.State()
+		if err != nil {
+			return err
+		}
+		for _, pod := range state.Pods {
+			if len(pod.BindBlocks) > 0 {
+				pods = append(pods, pod.Name)
+			}
+		}
+	}
+
+	var results []*admin.SwapOutResult
+	var failed []string
+	for _, pod := range pods {
+		result, err := c.client.SwapOut(pod)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "drain %s: %v\n", pod, err)
+			failed = append(failed, pod)
+			continue
+		}
+		results = append(results, result)
+		if !c.json {
+			fmt.Printf("pod %s: %d blocks swapped out\n", result.Pod, result.Blocks)
+		}
+	}
+	if c.json {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to drain %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (c *cli) reclaim() error {
+	state, err := c.client.Reclaim()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(state.Pods)
+	}
+	printPods(state.Pods)
+	return nil
+}
+
+func (c *cli) adjust() error {
+	state, err := c.client.Adjust()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(state.Capacity)
+	}
+	printCapacity(state)
+	return nil
+}
+
+func printBlocks(blocks []admin.Block) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSED\tPOD\tAGE")
+	for _, b := range blocks {
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\n", b.ID, b.Used, orNone(b.BindPod), age(b.UpdateTime))
+	}
+	w.Flush()
+}
+
+func printPods(pods []admin.Pod) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tPID\tTIER\tBOUND\tSWAPPED\tSWAP-NODE\tMIGRATIONS")
+	for _, p := range pods {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%d\t%s\t%d\n",
+			orNone(p.Namespace), p.Name, p.Pid, p.Tier, len(p.BindBlocks), len(p.SwapBlocks), orNone(p.SwapNode), p.MigrationCount)
+	}
+	w.Flush()
+}
+
+func printCapacity(state *admin.State) {
+	c := state.Capacity
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Total memory:\t%s\n", formatBytes(c.TotalMemory))
+	fmt.Fprintf(w, "Online pods used:\t%s\n", formatBytes(c.OnlinePodsUsed))
+	fmt.Fprintf(w, "Safety margin:\t%s\n", formatBytes(c.SafetyMargin))
+	fmt.Fprintf(w, "Colocation memory:\t%s\n", formatBytes(c.ColocMemory))
+	b := c.Breakdown
+	fmt.Fprintf(w, "  DRAM total:\t%s\t(free %s, available %s)\n", formatBytes(b.NodeTotal), formatBytes(b.NodeFree), formatBytes(b.NodeAvailable))
+	fmt.Fprintf(w, "  - system reserve:\t%s\t(max of node reserved %s, non-k8s used %s)\n",
+		formatBytes(b.SystemReserve), formatBytes(b.NodeReserved), formatBytes(b.SystemUsed))
+	fmt.Fprintf(w, "  - online pods:\t%s\t(guaranteed %s, burstable %s, best-effort %s excluding colocation pods %s)\n",
+		formatBytes(b.OnlineUsed), formatBytes(b.GuaranteedUsed), formatBytes(b.BurstableUsed), formatBytes(b.BestEffortUsed), formatBytes(b.ColocPodsUsed))
+	fmt.Fprintf(w, "  - safety margin:\t%s\n", formatBytes(b.SafetyMargin))
+	fmt.Fprintf(w, "Blocks:\t%d x %s\n", c.Blocks, formatBytes(common.BlockSize))
+	fmt.Fprintf(w, "Paused:\t%v\n", state.Paused)
+	w.Flush()
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+func age(t time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return time.Since(t).Round(time.Second).String()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "colocctl: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -1,34 +1,72 @@
 package main
 
 import (
+	"context"
+	"liuyang/colocation-memory-device-plugin/pkg/admin"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
 	"liuyang/colocation-memory-device-plugin/pkg/device_plugin"
 	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
-	"liuyang/colocation-memory-device-plugin/pkg/utils"
+	"liuyang/colocation-memory-device-plugin/pkg/metrics"
+	"os/signal"
+	"syscall"
 
 	"k8s.io/klog/v2"
 )
 
 func main() {
 	klog.Infof("device plugin starting")
+	config, err := common.LoadConfig()
+	if err != nil {
+		klog.Fatalf("load config failed: %v", err)
+	}
+
+	// SIGTERM/SIGINT时取消ctx，所有后台循环随之退出
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+	metrics.Serve(ctx, config.MetricsAddr)
+
 	// 初始化memory manager
-	mm := memory_manager.NewMemoryManager()
+	mm := memory_manager.NewMemoryManager(ctx, config)
 
 	// 初始化colocation memory device plugin
 	dp := device_plugin.NewColocationMemoryDevicePlugin(mm)
-	go dp.Run()
+	if err := dp.Run(ctx); err != nil {
+		klog.Fatalf("start device plugin failed: %v", err)
+	}
+
+	// 本地管理接口
+	var adminServer *admin.Server
+	if config.AdminSocket != "" {
+		adminServer = admin.NewServer(config.AdminSocket, dp.Monitor(), mm.Audit)
+		if err := adminServer.Run(); err != nil {
+			klog.Errorf("start admin server failed: %v", err)
+			adminServer = nil
+		}
+	}
 
 	// register when device plugin start
 	if err := dp.Register(); err != nil {
 		klog.Fatalf("register to kubelet failed: %v", err)
 	}
 
-	// watch kubelet.sock,when kubelet restart,exit device plugin,then will restart by DaemonSet
-	stop := make(chan struct{})
-	err := utils.WatchKubelet(stop)
-	if err != nil {
-		klog.Fatalf("start to kubelet failed: %v", err)
+	// watch kubelet.sock,when kubelet restart,re-register in process and keep the memory ledger
+	if err := dp.WatchKubelet(ctx); err != nil {
+		klog.Errorf("watch kubelet failed: %v", err)
+	} else {
+		klog.Infof("received signal,exiting")
 	}
+	cancel()
 
-	<-stop
-	klog.Infof("kubelet restart,exiting")
+	// 先停止管理接口，避免手动操作和退出流程并发
+	if adminServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), common.ShutdownTimeout)
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			klog.Errorf("shutdown admin server failed: %v", err)
+		}
+		shutdownCancel()
+	}
+	dp.Stop()
+	mm.Shutdown()
+	klog.Infof("device plugin stopped")
+	klog.Flush()
 }
@@ -0,0 +1,83 @@
+package main
+
+/**
+author:liuyang
+date:2025-5-25
+离线模拟器：回放内存使用和混部Pod轨迹，比较不同迁移模式和兜底策略
+用法: simulator -trace trace.jsonl -mode partial -fallback another-node
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/simulator"
+	"os"
+
+	"k8s.io/klog/v2"
+)
+
+func main() {
+	config, err := common.LoadConfig()
+	if err != nil {
+		fatalf("load config: %v", err)
+	}
+
+	tracePath := flag.String("trace", "", "trace file in JSON Lines format")
+	flag.StringVar(&config.MigrationMode, "mode", config.MigrationMode, "migration mode: full or partial")
+	flag.StringVar(&config.FallbackPolicy, "fallback", config.FallbackPolicy, "fallback policy when the pooled memory node is full: skip, another-node or evict")
+	var opts simulator.Options
+	flag.DurationVar(&opts.AdjustInterval, "adjust-interval", common.RefreshInterval, "interval between device adjustments")
+	flag.DurationVar(&opts.ReclaimInterval, "reclaim-interval", common.ReclaimCheckInterval, "interval between reclaim checks")
+	flag.DurationVar(&opts.PingPongWindow, "ping-pong-window", 0, "a swap-out within this time after a swap-in counts as a ping-pong (default 10m)")
+	flag.DurationVar(&opts.Tail, "tail", 0, "time to keep simulating after the last event")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	verbose := flag.Bool("verbose", false, "print the plugin logs")
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	if *tracePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		klog.LogToStderr(false)
+		klog.SetOutput(io.Discard)
+	}
+	// 命令行参数覆盖了环境变量，需要重新检查
+	if err := config.Validate(); err != nil {
+		fatalf("%v", err)
+	}
+	// 模拟器不写节点上的审计日志
+	config.AuditLogPath = ""
+
+	events, err := simulator.LoadTrace(*tracePath)
+	if err != nil {
+		fatalf("load trace: %v", err)
+	}
+	sim, err := simulator.New(config, opts, events)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	report, err := sim.Run()
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	fmt.Println(report)
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "simulator: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,97 @@
+package admin
+
+/**
+author:liuyang
+date:2025-5-20
+管理接口的客户端，通过unix socket访问插件
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type Client struct {
+	http *http.Client
+}
+
+func NewClient(socket string, timeout time.Duration) *Client {
+	return &Client{
+		http: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func (c *Client) State() (*State, error) {
+	state := &State{}
+	return state, c.do(http.MethodGet, "/v1/state", state)
+}
+
+func (c *Client) Decisions(n int) ([]*memory_manager.AdjustDecision, error) {
+	var decisions []*memory_manager.AdjustDecision
+	return decisions, c.do(http.MethodGet, "/v1/decisions?n="+strconv.Itoa(n), &decisions)
+}
+
+func (c *Client) Adjust() (*State, error) {
+	state := &State{}
+	return state, c.do(http.MethodPost, "/v1/adjust", state)
+}
+
+func (c *Client) Reclaim() (*State, error) {
+	state := &State{}
+	return state, c.do(http.MethodPost, "/v1/reclaim", state)
+}
+
+func (c *Client) SwapOut(podName string) (*SwapOutResult, error) {
+	result := &SwapOutResult{}
+	return result, c.do(http.MethodPost, "/v1/pods/"+url.PathEscape(podName)+"/swap-out", result)
+}
+
+func (c *Client) Pause() error {
+	return c.do(http.MethodPost, "/v1/pause", nil)
+}
+
+func (c *Client) Resume() error {
+	return c.do(http.MethodPost, "/v1/resume", nil)
+}
+
+// 发送请求并解析JSON响应，非2xx时返回服务端的错误信息
+func (c *Client) do(method, path string, out any) error {
+	req, err := http.NewRequest(method, "http://admin"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		errResp := &ErrorResponse{}
+		if json.Unmarshal(body, errResp) == nil && errResp.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, path, errResp.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
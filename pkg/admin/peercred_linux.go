@@ -0,0 +1,32 @@
+//go:build linux
+
+package admin
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// 通过SO_PEERCRED读取unix socket对端进程的pid和uid
+func peerCred(c net.Conn) string {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return "unknown"
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return "unknown"
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("pid:%d,uid:%d", cred.Pid, cred.Uid)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package admin
+
+import "net"
+
+func peerCred(_ net.Conn) string {
+	return "unknown"
+}
@@ -0,0 +1,192 @@
+package admin
+
+/**
+author:liuyang
+date:2025-5-18
+本地管理接口，通过unix socket上的HTTP提供账本查询和手动控制，所有修改操作都会记录审计日志
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/audit"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+type connKey struct{}
+
+type Server struct {
+	socket string
+	ctrl   Controller
+	log    *audit.Logger // 修改操作写入块生命周期审计日志，为nil时只输出klog
+	server *http.Server
+}
+
+func NewServer(socket string, ctrl Controller, log *audit.Logger) *Server {
+	s := &Server{
+		socket: socket,
+		ctrl:   ctrl,
+		log:    log,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/state", s.handleState)
+	mux.HandleFunc("GET /v1/decisions", s.handleDecisions)
+	mux.HandleFunc("POST /v1/adjust", s.audit(s.handleAdjust))
+	mux.HandleFunc("POST /v1/reclaim", s.audit(s.handleReclaim))
+	mux.HandleFunc("POST /v1/pods/{name}/swap-out", s.audit(s.handleSwapOut))
+	mux.HandleFunc("POST /v1/pause", s.audit(s.handlePause))
+	mux.HandleFunc("POST /v1/resume", s.audit(s.handleResume))
+
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		// 保存连接，审计时读取对端进程的身份
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, c)
+		},
+	}
+	return s
+}
+
+// Run 监听unix socket并启动管理接口，socket只允许root访问
+func (s *Server) Run() error {
+	if err := os.MkdirAll(filepath.Dir(s.socket), 0o755); err != nil {
+		return fmt.Errorf("create socket dir for %s failed: %w", s.socket, err)
+	}
+	if err := os.Remove(s.socket); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete socket %s failed: %w", s.socket, err)
+	}
+
+	listener, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return fmt.Errorf("listen unix %s failed: %w", s.socket, err)
+	}
+	if err := os.Chmod(s.socket, 0o600); err != nil {
+		listener.Close()
+		return fmt.Errorf("chmod socket %s failed: %w", s.socket, err)
+	}
+
+	go func() {
+		klog.Infof("[admin] 管理接口监听 %s", s.socket)
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("[admin] 管理接口退出: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown 停止接收新请求，等待进行中的请求结束后删除socket
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if rmErr := os.Remove(s.socket); rmErr != nil && !os.IsNotExist(rmErr) {
+		klog.Errorf("[admin] 删除socket %s 失败: %v", s.socket, rmErr)
+	}
+	return err
+}
+
+func (s *Server) handleState(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func (s *Server) handleDecisions(w http.ResponseWriter, r *http.Request) {
+	n := 0
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid n %q: %w", v, err))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.ctrl.Decisions(n))
+}
+
+func (s *Server) handleAdjust(w http.ResponseWriter, _ *http.Request) {
+	if err := s.ctrl.Adjust(); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func (s *Server) handleReclaim(w http.ResponseWriter, _ *http.Request) {
+	s.ctrl.Reclaim()
+	writeJSON(w, http.StatusOK, s.ctrl.State())
+}
+
+func (s *Server) handleSwapOut(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	blocks, err := s.ctrl.SwapOut(name)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &SwapOutResult{Pod: name, Blocks: blocks})
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, _ *http.Request) {
+	s.ctrl.Pause()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, _ *http.Request) {
+	s.ctrl.Resume()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 记录修改操作的审计日志: 调用者、请求和结果
+func (s *Server) audit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		caller := "unknown"
+		if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+			caller = peerCred(c)
+		}
+		klog.Infof("[audit] caller=%s method=%s path=%s status=%d duration=%s",
+			caller, r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+		s.log.Log(audit.Record{
+			Time:   start,
+			Event:  audit.EventAdmin,
+			Pod:    r.PathValue("name"),
+			Reason: "admin_api",
+			Caller: caller,
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Status: rec.status,
+		})
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Errorf("[admin] 写入响应失败: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"liuyang/colocation-memory-device-plugin/pkg/audit"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeController struct {
+	paused  bool
+	swapErr error
+}
+
+func (c *fakeController) State() *State { return &State{Paused: c.paused} }
+func (c *fakeController) Decisions(int) []*memory_manager.AdjustDecision {
+	return nil
+}
+func (c *fakeController) Adjust() error { return nil }
+func (c *fakeController) Reclaim()      {}
+func (c *fakeController) SwapOut(string) (int, error) {
+	if c.swapErr != nil {
+		return 0, c.swapErr
+	}
+	return 2, nil
+}
+func (c *fakeController) Pause()  { c.paused = true }
+func (c *fakeController) Resume() { c.paused = false }
+
+// 修改操作写入审计日志，查询操作不写入
+func TestServerAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.jsonl")
+	log, err := audit.NewLogger(logPath, 0, 0)
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer log.Close()
+
+	socket := filepath.Join(dir, "admin.sock")
+	ctrl := &fakeController{swapErr: errors.New("pod not found")}
+	s := NewServer(socket, ctrl, log)
+	if err := s.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	}()
+
+	client := NewClient(socket, 5*time.Second)
+	if _, err := client.State(); err != nil {
+		t.Fatalf("State: %v", err)
+	}
+	if err := client.Pause(); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if _, err := client.SwapOut("pod-a"); err == nil {
+		t.Fatal("SwapOut succeeded, want the controller error")
+	}
+	if !ctrl.paused {
+		t.Error("controller not paused")
+	}
+
+	records, err := audit.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	want := []audit.Record{
+		{Event: audit.EventAdmin, Reason: "admin_api", Method: "POST", Path: "/v1/pause", Status: 204},
+		{Event: audit.EventAdmin, Reason: "admin_api", Method: "POST", Path: "/v1/pods/pod-a/swap-out", Pod: "pod-a", Status: 409},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d audit records %+v, want %d", len(records), records, len(want))
+	}
+	for i, r := range records {
+		if r.Time.IsZero() || r.Caller == "" {
+			t.Errorf("record %d = %+v, want time and caller set", i, r)
+		}
+		r.Time, r.Caller = time.Time{}, ""
+		if r != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, r, want[i])
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package admin
+
+/**
+author:liuyang
+date:2025-5-18
+管理接口的数据结构，插件和命令行工具共用
+*/
+
+import (
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"time"
+)
+
+// Controller 管理接口需要插件提供的能力，由DeviceMonitor实现
+type Controller interface {
+	// State 返回混部内存块和Pod的当前状态
+	State() *State
+	// Decisions 返回最近n条调整决策，n<=0时返回全部
+	Decisions(n int) []*memory_manager.AdjustDecision
+	// Adjust 立即刷新内存状态并调整设备
+	Adjust() error
+	// Reclaim 立即尝试把交换出去的Pod迁回DRAM
+	Reclaim()
+	// SwapOut 把指定Pod交换到池化内存，返回交换出去的块数
+	SwapOut(podName string) (int, error)
+	// Pause 暂停自动调整和回收
+	Pause()
+	// Resume 恢复自动调整和回收
+	Resume()
+}
+
+// State 插件的账本快照
+type State struct {
+	Paused   bool     `json:"paused"`
+	Capacity Capacity `json:"capacity"`
+	Blocks   []Block  `json:"blocks"`
+	Pods     []Pod    `json:"pods"`
+}
+
+// Capacity 混部内存容量
+type Capacity struct {
+	TotalMemory    uint64 `json:"totalMemory"`
+	OnlinePodsUsed uint64 `json:"onlinePodsUsed"`
+	SafetyMargin   uint64 `json:"safetyMargin"`
+	ColocMemory    uint64 `json:"colocMemory"`
+	Blocks         int    `json:"blocks"`
+
+	Breakdown memory_manager.CapacityBreakdown `json:"breakdown"` // 容量计算的明细
+}
+
+// Block 混部内存块
+type Block struct {
+	ID         string    `json:"id"`
+	Used       bool      `json:"used"`
+	BindPod    string    `json:"bindPod,omitempty"`
+	UpdateTime time.Time `json:"updateTime"`
+}
+
+// Pod 混部Pod
+type Pod struct {
+	Name           string   `json:"name"`
+	Namespace      string   `json:"namespace"`
+	Pid            int      `json:"pid"`
+	Tier           string   `json:"tier"`
+	BindBlocks     []string `json:"bindBlocks,omitempty"`
+	SwapBlocks     []string `json:"swapBlocks,omitempty"`
+	SwapNode       string   `json:"swapNode,omitempty"`
+	SwappedBytes   uint64   `json:"swappedBytes,omitempty"`
+	MigrationCount int      `json:"migrationCount"`
+}
+
+// SwapOutResult 交换Pod的结果
+type SwapOutResult struct {
+	Pod    string `json:"pod"`
+	Blocks int    `json:"blocks"`
+}
+
+// ErrorResponse 请求失败时返回的错误
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,167 @@
+package audit
+
+/**
+author:liuyang
+date:2025-5-22
+混部内存块生命周期的审计日志，每次状态变化追加一行JSON，按大小滚动
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// 块的状态变化
+const (
+	EventCreated    = "created"     // 新建空闲块
+	EventBound      = "bound"       // 绑定到Pod
+	EventReleased   = "released"    // Pod删除后释放
+	EventSwappedOut = "swapped_out" // 随Pod交换到池化内存
+	EventSwappedIn  = "swapped_in"  // 随Pod迁回DRAM
+	EventDeleted    = "deleted"     // 从设备列表中删除
+	EventAdmin      = "admin"       // 通过管理接口的修改操作，不对应具体的块
+)
+
+// Record 一次块状态变化
+type Record struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Block      string    `json:"block,omitempty"`
+	Pod        string    `json:"pod,omitempty"`
+	Tier       string    `json:"tier,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	DecisionID string    `json:"decisionId,omitempty"`
+
+	// 管理操作的调用者、请求和结果，仅EventAdmin使用
+	Caller string `json:"caller,omitempty"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// Logger 追加写入的JSON Lines审计日志
+// 当前文件超过maxSize后重命名为path.1，原来的path.1变为path.2，依此类推，最多保留maxBackups个
+type Logger struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewLogger(path string, maxSize int64, maxBackups int) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create audit log dir for %s failed: %w", path, err)
+	}
+	l := &Logger{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Log 写入一条记录，Logger为nil时忽略(未开启审计日志)
+func (l *Logger) Log(r Record) {
+	if l == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		klog.Errorf("[audit] 序列化审计记录失败: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			klog.Errorf("[audit] 打开审计日志失败: %v", err)
+			return
+		}
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			klog.Errorf("[audit] 滚动审计日志失败: %v", err)
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		klog.Errorf("[audit] 写入审计日志失败: %v", err)
+	}
+}
+
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open audit log %s failed: %w", l.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat audit log %s failed: %w", l.path, err)
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// 依次后移备份文件，超出maxBackups的最旧文件被覆盖
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		klog.Warningf("[audit] 关闭审计日志失败: %v", err)
+	}
+	l.file = nil
+
+	if l.maxBackups <= 0 {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		for i := l.maxBackups - 1; i >= 1; i-- {
+			err := os.Rename(backupPath(l.path, i), backupPath(l.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(l.path, backupPath(l.path, 1)); err != nil {
+			return err
+		}
+	}
+	return l.open()
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(t *testing.T, maxSize int64, maxBackups int) (*Logger, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := NewLogger(path, maxSize, maxBackups)
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, path
+}
+
+func testRecord(i int) Record {
+	return Record{
+		Time:  time.Date(2025, 5, 22, 0, 0, i, 0, time.UTC),
+		Event: EventCreated,
+		Block: fmt.Sprintf("blk-%02d", i),
+		Tier:  "dram",
+	}
+}
+
+// 写入的记录按原样读回，未开启审计日志时Log和Close都是空操作
+func TestLoggerRoundTrip(t *testing.T) {
+	l, path := newTestLogger(t, 0, 0)
+	want := []Record{
+		testRecord(1),
+		{Time: testRecord(2).Time, Event: EventBound, Block: "blk-01", Pod: "pod-a", Tier: "dram", Reason: "pod_started"},
+		{Time: testRecord(3).Time, Event: EventAdmin, Reason: "admin_api", Caller: "pid:1,uid:0", Method: "POST", Path: "/v1/pause", Status: 204},
+	}
+	for _, r := range want {
+		l.Log(r)
+	}
+
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) {
+			t.Errorf("record %d Time = %v, want %v", i, got[i].Time, want[i].Time)
+		}
+		got[i].Time, want[i].Time = time.Time{}, time.Time{}
+		if got[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	var nilLogger *Logger
+	nilLogger.Log(testRecord(4))
+	if err := nilLogger.Close(); err != nil {
+		t.Errorf("nil Close() = %v", err)
+	}
+}
+
+// 未设置时间的记录使用写入时间
+func TestLoggerDefaultTime(t *testing.T) {
+	l, path := newTestLogger(t, 0, 0)
+	before := time.Now()
+	l.Log(Record{Event: EventDeleted, Block: "blk-01"})
+
+	got, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if len(got) != 1 || got[0].Time.Before(before.Truncate(time.Second)) {
+		t.Errorf("got %+v, want one record stamped after %v", got, before)
+	}
+}
+
+// 超过maxSize后滚动，只保留maxBackups个备份，ReadAll按时间顺序拼接保留下来的记录
+func TestLoggerRotate(t *testing.T) {
+	line, err := marshalLen(testRecord(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个文件正好容纳两条记录
+	const maxBackups = 2
+	l, path := newTestLogger(t, int64(2*line), maxBackups)
+	for i := range 7 {
+		l.Log(testRecord(i))
+	}
+
+	// 7条记录: [0 1] [2 3] [4 5] [6]，最旧的文件被丢弃
+	files := map[string][]string{
+		path:                {"blk-06"},
+		backupPath(path, 1): {"blk-04", "blk-05"},
+		backupPath(path, 2): {"blk-02", "blk-03"},
+	}
+	for p, blocks := range files {
+		rs, err := ReadFile(p)
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", p, err)
+		}
+		if got := blockIDs(rs); fmt.Sprint(got) != fmt.Sprint(blocks) {
+			t.Errorf("%s holds %v, want %v", filepath.Base(p), got, blocks)
+		}
+	}
+	if _, err := os.Stat(backupPath(path, 3)); !os.IsNotExist(err) {
+		t.Errorf("backup %d exists, want at most %d backups", 3, maxBackups)
+	}
+
+	all, err := ReadAll(path, maxBackups)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	want := []string{"blk-02", "blk-03", "blk-04", "blk-05", "blk-06"}
+	if got := blockIDs(all); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ReadAll = %v, want %v", got, want)
+	}
+
+	// 多读几个不存在的备份不影响结果
+	all, err = ReadAll(path, maxBackups+3)
+	if err != nil {
+		t.Fatalf("ReadAll with missing backups: %v", err)
+	}
+	if got := blockIDs(all); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ReadAll with missing backups = %v, want %v", got, want)
+	}
+}
+
+// 不保留备份时滚动直接删除旧文件
+func TestLoggerRotateNoBackups(t *testing.T) {
+	line, err := marshalLen(testRecord(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, path := newTestLogger(t, int64(line), 0)
+	for i := range 3 {
+		l.Log(testRecord(i))
+	}
+
+	all, err := ReadAll(path, 0)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if got := blockIDs(all); fmt.Sprint(got) != "[blk-02]" {
+		t.Errorf("ReadAll = %v, want [blk-02]", got)
+	}
+	if _, err := os.Stat(backupPath(path, 1)); !os.IsNotExist(err) {
+		t.Errorf("backup 1 exists with maxBackups=0")
+	}
+}
+
+// 重新打开已有文件时接着累计大小，不会超过maxSize才滚动
+func TestLoggerReopen(t *testing.T) {
+	line, err := marshalLen(testRecord(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, path := newTestLogger(t, int64(2*line), 1)
+	l.Log(testRecord(0))
+	l.Close()
+
+	l2, err := NewLogger(path, int64(2*line), 1)
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer l2.Close()
+	l2.Log(testRecord(1))
+	l2.Log(testRecord(2))
+
+	all, err := ReadAll(path, 1)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if got := blockIDs(all); fmt.Sprint(got) != "[blk-00 blk-01 blk-02]" {
+		t.Errorf("ReadAll = %v, want [blk-00 blk-01 blk-02]", got)
+	}
+	rs, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got := blockIDs(rs); fmt.Sprint(got) != "[blk-02]" {
+		t.Errorf("current file holds %v, want [blk-02]", got)
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ReadFile(filepath.Join(dir, "missing.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("ReadFile(missing) = %v, want not exist", err)
+	}
+
+	path := filepath.Join(dir, "bad.jsonl")
+	data := `{"event":"created","block":"blk-00"}` + "\n\n" + "not json\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ReadFile(path)
+	if err == nil {
+		t.Fatal("ReadFile with a corrupt line succeeded")
+	}
+	if want := path + ":3:"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("error = %q, want prefix %q", err, want)
+	}
+	if len(rs) != 1 {
+		t.Errorf("got %d records before the corrupt line, want 1", len(rs))
+	}
+	if _, err := ReadAll(path, 0); err == nil {
+		t.Error("ReadAll with a corrupt file succeeded")
+	}
+}
+
+func TestBlockHistory(t *testing.T) {
+	records := []Record{
+		{Event: EventCreated, Block: "blk-a"},
+		{Event: EventCreated, Block: "blk-b"},
+		{Event: EventBound, Block: "blk-a", Pod: "pod-1"},
+		{Event: EventAdmin, Path: "/v1/pause"},
+		{Event: EventSwappedOut, Block: "blk-a", Pod: "pod-1"},
+	}
+	history := BlockHistory(records, "blk-a")
+	var events []string
+	for _, r := range history {
+		events = append(events, r.Event)
+	}
+	if want := "[created bound swapped_out]"; fmt.Sprint(events) != want {
+		t.Errorf("BlockHistory = %v, want %s", events, want)
+	}
+	if got := BlockHistory(records, "blk-c"); len(got) != 0 {
+		t.Errorf("BlockHistory(unknown) = %v, want none", got)
+	}
+}
+
+// 一条记录写入文件后的字节数，包含换行
+func marshalLen(r Record) (int, error) {
+	line, err := json.Marshal(r)
+	return len(line) + 1, err
+}
+
+func blockIDs(records []Record) []string {
+	var ids []string
+	for _, r := range records {
+		ids = append(ids, r.Block)
+	}
+	return ids
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ReadFile 读取一个审计日志文件中的全部记录
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return records, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// ReadAll 按时间顺序读取当前文件和所有备份中的记录，缺失的备份会被跳过
+func ReadAll(path string, maxBackups int) ([]Record, error) {
+	var records []Record
+	for i := maxBackups; i >= 0; i-- {
+		p := path
+		if i > 0 {
+			p = backupPath(path, i)
+		}
+		rs, err := ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rs...)
+	}
+	return records, nil
+}
+
+// BlockHistory 过滤出某个块的记录
+func BlockHistory(records []Record, block string) []Record {
+	var history []Record
+	for _, r := range records {
+		if r.Block == block {
+			history = append(history, r)
+		}
+	}
+	return history
+}
@@ -0,0 +1,169 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// 迁移模式
+const (
+	MigrationModeFull     = "full"     // 整Pod迁移：把Pod的所有页面迁移到目标节点
+	MigrationModePartial  = "partial"  // 部分迁移：只迁移被回收块对应字节数的页面
+	MigrationModeDemotion = "demotion" // 降级迁移：通过memory.reclaim让内核把冷页面降级到CXL节点
+)
+
+// 页面迁移后端
+const (
+	MigratorBackendSyscall      = "syscall"      // 进程内调用migrate_pages(2)
+	MigratorBackendMigratepages = "migratepages" // 调用numactl的migratepages命令
+)
+
+// 在线任务内存的核算方式
+const (
+	MemoryAccountingWorkingSet = "working-set" // memory.current - inactive_file
+	MemoryAccountingAnon       = "anon"        // 只统计匿名页
+	MemoryAccountingCurrent    = "current"     // memory.current，包含全部页缓存
+)
+
+// CXL节点容量不足时的兜底策略
+const (
+	FallbackPolicyEvict     = "evict"        // 驱逐Pod，迁移到其他k8s节点
+	FallbackPolicyOtherNode = "another-node" // 迁移到其他有空闲的CXL节点
+	FallbackPolicySkip      = "skip"         // 跳过该Pod，选择下一个牺牲者
+)
+
+// Config 运行时配置，通过环境变量覆盖默认值，方便在DaemonSet中配置
+type Config struct {
+	NodeName        string // 当前k8s节点名称，通过downward API注入
+	DevicePluginDir string // 插件socket所在目录，kubelet在该目录下发现插件
+	KubeletSocket   string // kubelet注册服务的socket
+	MigrationMode   string // 迁移模式，见MigrationMode*
+	MigratorBackend string // 页面迁移后端，见MigratorBackend*
+	FallbackPolicy  string // CXL节点容量不足时的兜底策略，见FallbackPolicy*
+
+	MemoryAccounting string // 在线任务内存的核算方式，见MemoryAccounting*
+
+	FallbackTaint         bool          // 兜底驱逐时是否给节点打上临时NoSchedule污点
+	FallbackTaintDuration time.Duration // 临时污点的持续时间
+
+	PressureTaint         bool // 混部内存压力时是否给节点打上污点
+	PressureRecoverBlocks int  // 可用块数达到该值才认为容量恢复
+	PressureRecoverCount  int  // 连续多少次调整容量恢复才解除压力
+
+	StatusUpdateInterval time.Duration // ColocationMemoryNode状态的最小更新间隔
+
+	MetricsAddr string // Prometheus指标监听地址，为空时不启动
+	AdminSocket string // 管理接口的unix socket路径，为空时不启动
+
+	AuditLogPath       string // 块生命周期审计日志路径，为空时不记录
+	AuditLogMaxSize    int64  // 审计日志单个文件的最大字节数，超过后滚动
+	AuditLogMaxBackups int    // 保留的审计日志备份数
+}
+
+// LoadConfig 从环境变量加载配置，取值不合法的枚举项返回错误，由调用方终止启动
+func LoadConfig() (*Config, error) {
+	hostname, _ := os.Hostname()
+	devicePluginDir := getEnv("COLOC_DEVICE_PLUGIN_DIR", pluginapi.DevicePluginPath)
+	config := &Config{
+		NodeName:        getEnv("NODE_NAME", hostname),
+		DevicePluginDir: devicePluginDir,
+		KubeletSocket:   getEnv("COLOC_KUBELET_SOCKET", filepath.Join(devicePluginDir, filepath.Base(pluginapi.KubeletSocket))),
+		MigrationMode:   getEnv("COLOC_MIGRATION_MODE", MigrationModeFull),
+		MigratorBackend: getEnv("COLOC_MIGRATOR_BACKEND", MigratorBackendSyscall),
+		FallbackPolicy:  getEnv("COLOC_FALLBACK_POLICY", FallbackPolicySkip),
+
+		MemoryAccounting: getEnv("COLOC_MEMORY_ACCOUNTING", MemoryAccountingWorkingSet),
+
+		FallbackTaint:         getEnvBool("COLOC_FALLBACK_TAINT", false),
+		FallbackTaintDuration: getEnvDuration("COLOC_FALLBACK_TAINT_DURATION", 5*time.Minute),
+
+		PressureTaint:         getEnvBool("COLOC_PRESSURE_TAINT", false),
+		PressureRecoverBlocks: getEnvInt("COLOC_PRESSURE_RECOVER_BLOCKS", 2),
+		PressureRecoverCount:  getEnvInt("COLOC_PRESSURE_RECOVER_COUNT", 3),
+
+		StatusUpdateInterval: getEnvDuration("COLOC_STATUS_UPDATE_INTERVAL", 30*time.Second),
+
+		MetricsAddr: getEnv("COLOC_METRICS_ADDR", ":9464"),
+		AdminSocket: getEnv("COLOC_ADMIN_SOCKET", "/run/colocation-memory-device-plugin/admin.sock"),
+
+		AuditLogPath:       getEnv("COLOC_AUDIT_LOG", "/var/log/colocation-memory-device-plugin/audit.jsonl"),
+		AuditLogMaxSize:    int64(getEnvInt("COLOC_AUDIT_LOG_MAX_SIZE_MB", 100)) * 1024 * 1024,
+		AuditLogMaxBackups: getEnvInt("COLOC_AUDIT_LOG_MAX_BACKUPS", 5),
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate 检查迁移模式、兜底策略和内存核算方式，未知的取值不能静默按默认值处理
+func (c *Config) Validate() error {
+	switch c.MigrationMode {
+	case MigrationModeFull, MigrationModePartial, MigrationModeDemotion:
+	default:
+		return fmt.Errorf("unknown migration mode %q, want %s, %s or %s", c.MigrationMode, MigrationModeFull, MigrationModePartial, MigrationModeDemotion)
+	}
+	switch c.FallbackPolicy {
+	case FallbackPolicyEvict, FallbackPolicyOtherNode, FallbackPolicySkip:
+	default:
+		return fmt.Errorf("unknown fallback policy %q, want %s, %s or %s", c.FallbackPolicy, FallbackPolicySkip, FallbackPolicyOtherNode, FallbackPolicyEvict)
+	}
+	switch c.MemoryAccounting {
+	case MemoryAccountingWorkingSet, MemoryAccountingAnon, MemoryAccountingCurrent:
+	default:
+		return fmt.Errorf("unknown memory accounting %q, want %s, %s or %s", c.MemoryAccounting, MemoryAccountingWorkingSet, MemoryAccountingAnon, MemoryAccountingCurrent)
+	}
+	return nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		klog.Warningf("[LoadConfig] 环境变量 %s=%q 不是合法的布尔值, 使用默认值 %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		klog.Warningf("[LoadConfig] 环境变量 %s=%q 不是合法的整数, 使用默认值 %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return i
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		klog.Warningf("[LoadConfig] 环境变量 %s=%q 不是合法的时间间隔, 使用默认值 %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
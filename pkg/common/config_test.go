@@ -0,0 +1,37 @@
+package common
+
+import (
+	"testing"
+)
+
+// 未知的迁移模式、兜底策略和内存核算方式导致启动失败，而不是静默使用默认值
+func TestLoadConfigRejectsUnknownValues(t *testing.T) {
+	tests := []struct {
+		env, value string
+	}{
+		{"COLOC_MIGRATION_MODE", "partail"},
+		{"COLOC_FALLBACK_POLICY", "other-node"},
+		{"COLOC_MEMORY_ACCOUNTING", "rss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			if config, err := LoadConfig(); err == nil {
+				t.Errorf("LoadConfig with %s=%s = %+v, want an error", tt.env, tt.value, config)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	for _, env := range []string{"COLOC_MIGRATION_MODE", "COLOC_FALLBACK_POLICY", "COLOC_MEMORY_ACCOUNTING"} {
+		t.Setenv(env, "")
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if config.MigrationMode != MigrationModeFull || config.FallbackPolicy != FallbackPolicySkip || config.MemoryAccounting != MemoryAccountingWorkingSet {
+		t.Errorf("got mode %q fallback %q accounting %q, want the defaults", config.MigrationMode, config.FallbackPolicy, config.MemoryAccounting)
+	}
+}
@@ -13,15 +13,39 @@ const (
 	// 2.在做虚拟内存块计算时，采用了冷却时间+滞后区间来防抖动，需要留出一定的内存空间来防止实际内存溢出
 	SafetyWatermark = 0.1 // 10%安全水位
 
+	CgroupRootPath  = "/sys/fs/cgroup"
 	K8sPodsBasePath = "/sys/fs/cgroup/kubepods.slice"
-	BurstablePath   = "/kubepods-burstable.slice/memory.current"
-	BestEffortPath  = "/kubepods-besteffort.slice/memory.current"
+	BurstablePath   = "/kubepods-burstable.slice"
+	BestEffortPath  = "/kubepods-besteffort.slice"
 	RefreshInterval = 10 * time.Second
 	DeviceName      = "CM-%s"                // 设备名称
 	KubeConfigPath  = "/home/liuyang/config" // kubeconfig路径
 
+	MemoryCurrentFile = "memory.current" // cgroup的内存使用量文件
+	MemoryStatFile    = "memory.stat"    // cgroup的内存统计文件
+
 	DebounceThreshold     = 1                // 防抖阈值
 	MinAdjustmentInterval = 60 * time.Second // 最小调整间隔
 
 	ReclaimCheckInterval = 13 * time.Second // 回收Pod检查间隔
+	ShutdownTimeout      = 10 * time.Second // 退出时等待HTTP服务处理完请求的时间
+
+	NodeAllocatableRefreshInterval = 5 * time.Minute // 重新读取节点Allocatable的间隔
+
+	RegisterRetryInterval  = 2 * time.Second // kubelet重启后重新注册的重试间隔
+	KubeletRestartDebounce = time.Second     // 合并kubelet重启产生的多个文件事件
+
+	PressureConditionType = "ColocationMemoryPressure"         // 混部内存压力的节点条件
+	PressureTaintKey      = "x.com/colocation-memory-pressure" // 混部内存压力污点，在线Pod需要容忍，混部Pod不容忍
+	FallbackTaintKey      = "x.com/colocation-memory-fallback" // 兜底驱逐时给节点打上的临时污点
+
+	// 混部Pod上反映内存层级的注解
+	AnnotationTier          = "x.com/colocation-memory-tier"           // 当前内存层级: cxl / mixed，不存在表示在DRAM
+	AnnotationSwappedBlocks = "x.com/colocation-memory-swapped-blocks" // 交换到池化内存的块数
+	AnnotationLastMigration = "x.com/colocation-memory-last-migration" // 上次迁移时间
+	AnnotationMigrations    = "x.com/colocation-memory-migrations"     // 成功交换到池化内存的次数
+
+	SwapNumaNode = 2 // 默认的池化内存(CXL)节点
+
+	DecisionHistorySize = 100 // 管理接口保留的调整决策条数
 )
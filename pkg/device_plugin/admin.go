@@ -0,0 +1,134 @@
+package device_plugin
+
+import (
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/admin"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"slices"
+	"sort"
+
+	"k8s.io/klog/v2"
+)
+
+// DeviceMonitor实现管理接口，所有操作和周期任务一样持有d.mm.Lock()
+
+var _ admin.Controller = &DeviceMonitor{}
+
+func (d *DeviceMonitor) State() *admin.State {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+
+	state := &admin.State{
+		Paused: d.paused.Load(),
+		Capacity: admin.Capacity{
+			TotalMemory:    d.mm.TotalMemory,
+			OnlinePodsUsed: d.mm.OnlinePodsUsed,
+			SafetyMargin:   d.mm.SafetyMargin,
+			ColocMemory:    d.mm.ColocMemory,
+			Blocks:         d.mm.PrevBlocks,
+			Breakdown:      d.mm.Capacity,
+		},
+	}
+	for _, meta := range d.mm.Uuid2ColocMetaData {
+		state.Blocks = append(state.Blocks, admin.Block{
+			ID:         meta.Uuid,
+			Used:       meta.Used,
+			BindPod:    meta.BindPod,
+			UpdateTime: meta.UpdateTime,
+		})
+	}
+	sort.Slice(state.Blocks, func(i, j int) bool {
+		return state.Blocks[i].ID < state.Blocks[j].ID
+	})
+	for _, podInfo := range d.mm.Pod2PodInfo {
+		state.Pods = append(state.Pods, admin.Pod{
+			Name:           podInfo.Name,
+			Namespace:      podInfo.Namespace,
+			Pid:            podInfo.Pid,
+			Tier:           podInfo.Tier(),
+			BindBlocks:     slices.Clone(podInfo.BindColocIds),
+			SwapBlocks:     slices.Clone(podInfo.SwapColocIds),
+			SwapNode:       podInfo.SwapNode,
+			SwappedBytes:   podInfo.SwappedBytes,
+			MigrationCount: podInfo.MigrationCount,
+		})
+	}
+	sort.Slice(state.Pods, func(i, j int) bool {
+		return state.Pods[i].Name < state.Pods[j].Name
+	})
+	return state
+}
+
+func (d *DeviceMonitor) Decisions(n int) []*memory_manager.AdjustDecision {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+
+	if n <= 0 || n > len(d.decisions) {
+		n = len(d.decisions)
+	}
+	// 驱逐完成时finishEviction会在锁内修改决策，返回副本
+	decisions := make([]*memory_manager.AdjustDecision, 0, n)
+	for _, decision := range d.decisions[len(d.decisions)-n:] {
+		decisions = append(decisions, decision.DeepCopy())
+	}
+	return decisions
+}
+
+func (d *DeviceMonitor) Adjust() error {
+	if d.mm.PodCreateRunning.Load() {
+		return fmt.Errorf("pod creation in progress, try again later")
+	}
+	return d.adjustOnce()
+}
+
+func (d *DeviceMonitor) Reclaim() {
+	d.tryReclaimSwapBlocks()
+}
+
+// SwapOut 手动把Pod交换到池化内存，释放的DRAM重新作为空闲块上报
+func (d *DeviceMonitor) SwapOut(podName string) (int, error) {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+
+	podInfo, ok := d.mm.Pod2PodInfo[podName]
+	if !ok {
+		return 0, fmt.Errorf("pod %s not found", podName)
+	}
+	if len(podInfo.BindColocIds) == 0 {
+		return 0, fmt.Errorf("pod %s has no bound blocks", podName)
+	}
+	if d.evicting[podName] != nil {
+		return 0, fmt.Errorf("pod %s is being evicted to another node", podName)
+	}
+
+	var count int
+	if d.swapsByBytes() {
+		count = d.swapOutPodPartial(podInfo, len(podInfo.BindColocIds))
+	} else {
+		count = d.swapOutPod(podInfo)
+	}
+	if d.evicting[podName] != nil {
+		return 0, fmt.Errorf("pod %s does not fit the pooled memory node and is being evicted to another node", podName)
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("pod %s was not swapped out, pooled memory node may be full", podName)
+	}
+
+	for range count {
+		d.generateBlock(false, "", "", reasonAdminSwapOut)
+	}
+	d.updateMetrics()
+	d.notifyDevices()
+	klog.Infof("[SwapOut] 手动交换 pod %s, 释放 %d 个块", podName, count)
+	return count, nil
+}
+
+func (d *DeviceMonitor) Pause() {
+	d.paused.Store(true)
+	klog.Info("[Pause] 自动调整和回收已暂停")
+}
+
+func (d *DeviceMonitor) Resume() {
+	d.paused.Store(false)
+	klog.Info("[Resume] 自动调整和回收已恢复")
+}
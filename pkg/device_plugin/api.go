@@ -3,7 +3,9 @@ package device_plugin
 import (
 	"context"
 	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/metrics"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
@@ -20,22 +22,41 @@ func (c *ColocationMemoryDevicePlugin) GetDevicePluginOptions(_ context.Context,
 // Whenever a Device state change or a Device disappears, ListAndWatch
 // returns the new list
 // 这里上报的不是内存总量，而是排除了在线任务和安全水位后的内存余量
-func (c *ColocationMemoryDevicePlugin) ListAndWatch(_ *pluginapi.Empty, srv pluginapi.DevicePlugin_ListAndWatchServer) error {
-	devs := c.dm.Devices()
-	klog.Info("[ListAndWatch] number of init devices: ", len(devs))
+// 每次(重新)连接先发送完整的设备列表; kubelet断开、发送失败或stop关闭(所在的gRPC服务停止)时返回
+// gRPC服务上的ListAndWatch见pluginServer，stop在创建服务时确定
+func (c *ColocationMemoryDevicePlugin) listAndWatch(srv pluginapi.DevicePlugin_ListAndWatchServer, stop <-chan struct{}) error {
+	updates, unsubscribe := c.dm.updates.Subscribe()
+	defer unsubscribe()
+	klog.Info("[ListAndWatch] number of streams: ", c.dm.updates.Subscribers())
 
-	err := srv.Send(&pluginapi.ListAndWatchResponse{Devices: devs})
-	if err != nil {
+	// 订阅时已有一次通知，第一次发送完整的设备列表
+	// 先取走通知再读取设备列表，读取之后的发布会再次通知，不会丢失更新
+	<-updates
+	devs := c.dm.updates.Latest()
+	klog.Info("[ListAndWatch] number of init devices: ", len(devs))
+	if err := srv.Send(&pluginapi.ListAndWatchResponse{Devices: devs}); err != nil {
 		return errors.WithMessage(err, "send device failed")
 	}
 
 	klog.Infoln("waiting for device update")
-	for range c.dm.notify {
-		devs = c.dm.Devices()
+	for {
+		select {
+		case <-stop:
+			klog.Info("[ListAndWatch] device plugin stopped")
+			return nil
+		case <-srv.Context().Done():
+			klog.Info("[ListAndWatch] stream closed by kubelet: ", srv.Context().Err())
+			return nil
+		case <-updates:
+		}
+		devs = c.dm.updates.Latest()
 		klog.Infof("device update,new device list [%s]", String(devs))
-		_ = srv.Send(&pluginapi.ListAndWatchResponse{Devices: devs})
+		if err := srv.Send(&pluginapi.ListAndWatchResponse{Devices: devs}); err != nil {
+			klog.Errorf("[ListAndWatch] send device update failed: %v", err)
+			return errors.WithMessage(err, "send device update failed")
+		}
+		metrics.ListAndWatchUpdates.Inc()
 	}
-	return nil
 }
 
 // GetPreferredAllocation returns a preferred set of devices to allocate
@@ -83,6 +104,7 @@ func (c *ColocationMemoryDevicePlugin) GetPreferredAllocation(_ context.Context,
 // 由于没有用原生k8s的内存资源，这里最重要的是要用cgroups对内存做实际的限制
 // 如果原先申请的设备资源（动态内存）不够了，运行中的POD并不会被自动驱逐，还是要用cgroups的驱逐机制
 func (c *ColocationMemoryDevicePlugin) Allocate(_ context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
+	defer metrics.ObserveRPC("Allocate", time.Now())
 	ret := &pluginapi.AllocateResponse{}
 	for _, req := range reqs.ContainerRequests {
 		klog.Infof("[Allocate] received request: %v", strings.Join(req.DevicesIDs, ","))
@@ -102,5 +124,6 @@ func (c *ColocationMemoryDevicePlugin) Allocate(_ context.Context, reqs *plugina
 // before each container start. Device plugin can run device specific operations
 // such as reseting the device before making devices available to the container
 func (c *ColocationMemoryDevicePlugin) PreStartContainer(_ context.Context, _ *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
+	defer metrics.ObserveRPC("PreStartContainer", time.Now())
 	return &pluginapi.PreStartContainerResponse{}, nil
 }
@@ -0,0 +1,239 @@
+package device_plugin_test
+
+import (
+	"errors"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/device_plugin"
+	"liuyang/colocation-memory-device-plugin/pkg/fake_kubelet"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"liuyang/colocation-memory-device-plugin/pkg/simulator"
+	"slices"
+	"testing"
+	"time"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	gib         = 1 << 30
+	testTimeout = 10 * time.Second
+)
+
+type testPlugin struct {
+	*device_plugin.ColocationMemoryDevicePlugin
+	machine *simulator.Machine
+	mm      *memory_manager.MemoryManager
+}
+
+// 在模拟的节点上创建插件，DRAM节点各空闲16GiB
+func newTestPlugin(t *testing.T) *testPlugin {
+	t.Helper()
+	return newTestPluginWithUsage(t, &simulator.Event{
+		Type:       simulator.EventUsage,
+		OnlineUsed: 8 * gib,
+		NodeFree:   map[int]uint64{0: 16 * gib, 1: 16 * gib, 2: 64 * gib},
+		NodeTotal:  map[int]uint64{0: 32 * gib, 1: 32 * gib, 2: 64 * gib},
+	})
+}
+
+// 按初始内存数据创建插件，NodeFree中0和1以外的节点都是池化内存节点
+func newTestPluginWithUsage(t *testing.T, usage *simulator.Event) *testPlugin {
+	t.Helper()
+	topo, err := simulator.Topology(usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := simulator.NewMachine(topo)
+	machine.ApplyUsage(usage)
+
+	config, err := common.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	config.AuditLogPath = ""
+	mm, err := memory_manager.NewOfflineMemoryManager(config, topo, machine, machine)
+	if err != nil {
+		t.Fatalf("NewOfflineMemoryManager: %v", err)
+	}
+	p := &testPlugin{
+		ColocationMemoryDevicePlugin: device_plugin.NewOfflineColocationMemoryDevicePlugin(mm),
+		machine:                      machine,
+		mm:                           mm,
+	}
+	if err := p.Monitor().List(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return p
+}
+
+// 在线任务内存上涨，DRAM节点各只剩free字节，调整后设备列表变化
+func (p *testPlugin) shrink(t *testing.T, free uint64) {
+	t.Helper()
+	p.machine.ApplyUsage(&simulator.Event{
+		Type:       simulator.EventUsage,
+		OnlineUsed: 32*gib - 2*free,
+		NodeFree:   map[int]uint64{0: free, 1: free},
+	})
+	if err := p.Monitor().Adjust(); err != nil {
+		t.Fatalf("Adjust: %v", err)
+	}
+}
+
+// 在后台运行ListAndWatch，返回结果通道
+func (p *testPlugin) listAndWatch(stream *fake_kubelet.ListAndWatchStream, stop <-chan struct{}) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- p.ListAndWatchUntil(stream, stop) }()
+	return done
+}
+
+func waitReturn(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(testTimeout):
+		t.Fatal("ListAndWatch did not return")
+		return nil
+	}
+}
+
+func deviceIDs(devs []*pluginapi.Device) []string {
+	var ids []string
+	for _, dev := range devs {
+		ids = append(ids, dev.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func ledgerIDs(p *testPlugin) []string {
+	return deviceIDs(p.Monitor().Devices())
+}
+
+// kubelet断开连接后返回nil并取消订阅
+func TestListAndWatchContextCancel(t *testing.T) {
+	p := newTestPlugin(t)
+	stream := fake_kubelet.NewListAndWatchStream()
+	done := p.listAndWatch(stream, make(chan struct{}))
+	if err := stream.WaitForResponses(1, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	stream.Disconnect()
+	if err := waitReturn(t, done); err != nil {
+		t.Errorf("ListAndWatch = %v, want nil after disconnect", err)
+	}
+	if n := p.ListAndWatchStreams(); n != 0 {
+		t.Errorf("%d streams still subscribed", n)
+	}
+}
+
+// 发送初始列表或更新失败时返回该错误
+func TestListAndWatchSendError(t *testing.T) {
+	errBroken := errors.New("broken pipe")
+
+	t.Run("initial", func(t *testing.T) {
+		p := newTestPlugin(t)
+		stream := fake_kubelet.NewListAndWatchStream()
+		stream.FailSends(errBroken)
+		if err := waitReturn(t, p.listAndWatch(stream, make(chan struct{}))); !errors.Is(err, errBroken) {
+			t.Errorf("ListAndWatch = %v, want %v", err, errBroken)
+		}
+		if n := p.ListAndWatchStreams(); n != 0 {
+			t.Errorf("%d streams still subscribed", n)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		p := newTestPlugin(t)
+		stream := fake_kubelet.NewListAndWatchStream()
+		done := p.listAndWatch(stream, make(chan struct{}))
+		if err := stream.WaitForResponses(1, testTimeout); err != nil {
+			t.Fatal(err)
+		}
+
+		stream.FailSends(errBroken)
+		p.shrink(t, 8*gib)
+		if err := waitReturn(t, done); !errors.Is(err, errBroken) {
+			t.Errorf("ListAndWatch = %v, want %v", err, errBroken)
+		}
+		if got := len(stream.Responses()); got != 1 {
+			t.Errorf("recorded %d responses, want only the initial one", got)
+		}
+		if n := p.ListAndWatchStreams(); n != 0 {
+			t.Errorf("%d streams still subscribed", n)
+		}
+	})
+}
+
+// gRPC服务停止时所有流返回nil
+func TestListAndWatchPluginStop(t *testing.T) {
+	p := newTestPlugin(t)
+	stop := make(chan struct{})
+	streams := []*fake_kubelet.ListAndWatchStream{fake_kubelet.NewListAndWatchStream(), fake_kubelet.NewListAndWatchStream()}
+	var done []<-chan error
+	for _, stream := range streams {
+		done = append(done, p.listAndWatch(stream, stop))
+		if err := stream.WaitForResponses(1, testTimeout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := p.ListAndWatchStreams(); n != len(streams) {
+		t.Errorf("%d streams subscribed, want %d", n, len(streams))
+	}
+
+	close(stop)
+	for i := range done {
+		if err := waitReturn(t, done[i]); err != nil {
+			t.Errorf("stream %d: ListAndWatch = %v, want nil after stop", i, err)
+		}
+	}
+	if n := p.ListAndWatchStreams(); n != 0 {
+		t.Errorf("%d streams still subscribed", n)
+	}
+}
+
+// 每次订阅先发送完整的设备列表，之后的更新也是完整列表而不是增量
+func TestListAndWatchFullSnapshot(t *testing.T) {
+	p := newTestPlugin(t)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	first := fake_kubelet.NewListAndWatchStream()
+	p.listAndWatch(first, stop)
+	if err := first.WaitForResponses(1, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	initial := ledgerIDs(p)
+	if got := deviceIDs(first.Responses()[0].Devices); !slices.Equal(got, initial) {
+		t.Fatalf("initial list = %v, want %v", got, initial)
+	}
+
+	p.shrink(t, 8*gib)
+	shrunk := ledgerIDs(p)
+	if len(shrunk) >= len(initial) {
+		t.Fatalf("ledger has %d devices after shrinking, want fewer than %d", len(shrunk), len(initial))
+	}
+	if err := first.WaitForResponses(2, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	responses := first.Responses()
+	if got := deviceIDs(responses[len(responses)-1].Devices); !slices.Equal(got, shrunk) {
+		t.Errorf("update = %v, want the full list %v", got, shrunk)
+	}
+
+	// 后订阅的流第一次就收到当前的完整列表
+	second := fake_kubelet.NewListAndWatchStream()
+	p.listAndWatch(second, stop)
+	if err := second.WaitForResponses(1, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if got := deviceIDs(second.Responses()[0].Devices); !slices.Equal(got, shrunk) {
+		t.Errorf("initial list of a new stream = %v, want %v", got, shrunk)
+	}
+	for _, dev := range second.Responses()[0].Devices {
+		if dev.Health != pluginapi.Healthy {
+			t.Errorf("device %s health = %s, want %s", dev.ID, dev.Health, pluginapi.Healthy)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package device_plugin
+
+/**
+author:liuyang
+date:2025-6-2
+设备列表更新的广播：支持任意数量的ListAndWatch流，发布方永不阻塞
+每个订阅者只有一个容量为1的通知通道，连续多次发布合并为一次通知，订阅者收到通知后读取最新的设备列表
+*/
+
+import (
+	"sync"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+type deviceBroadcaster struct {
+	mu      sync.Mutex
+	devices []*pluginapi.Device        // 最新的设备列表
+	subs    map[chan struct{}]struct{} // 订阅者的通知通道
+}
+
+func newDeviceBroadcaster() *deviceBroadcaster {
+	return &deviceBroadcaster{
+		subs: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Publish 更新最新的设备列表并通知所有订阅者，订阅者还没处理上一次通知时不会重复通知
+func (b *deviceBroadcaster) Publish(devices []*pluginapi.Device) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.devices = devices
+	for ch := range b.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Subscribe 订阅设备列表更新，返回的通道中已经有一次通知，用于发送完整的初始列表
+// 订阅者退出时必须调用unsubscribe
+func (b *deviceBroadcaster) Subscribe() (updates <-chan struct{}, unsubscribe func()) {
+	ch := make(chan struct{}, 1)
+	ch <- struct{}{}
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+// Latest 最新的设备列表
+func (b *deviceBroadcaster) Latest() []*pluginapi.Device {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.devices
+}
+
+// Subscribers 当前的订阅者数量
+func (b *deviceBroadcaster) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
@@ -1,34 +1,104 @@
 package device_plugin
 
 import (
+	"context"
 	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/audit"
 	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/fallback_migrator"
 	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"liuyang/colocation-memory-device-plugin/pkg/metrics"
+	"liuyang/colocation-memory-device-plugin/pkg/node_status"
 	"liuyang/colocation-memory-device-plugin/pkg/utils"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
+// PodEvictor 池化内存节点容量不足时把Pod驱逐到其他k8s节点
+// 由fallback_migrator.FallbackMigrator实现，模拟器提供只修改模型的实现
+type PodEvictor interface {
+	// MigratePodToAnotherNode 驱逐Pod并等待它离开本节点，ctx取消后立即返回
+	MigratePodToAnotherNode(ctx context.Context, namespace, podName string) error
+	// Shutdown 清理驱逐期间对节点做的修改
+	Shutdown(ctx context.Context)
+}
+
+var _ PodEvictor = &fallback_migrator.FallbackMigrator{}
+
 type DeviceMonitor struct {
 	devices map[string]*pluginapi.Device // uuid -> device
-	notify  chan struct{}                // notify when device update
+	updates *deviceBroadcaster           // notify ListAndWatch when device update
 	mm      *memory_manager.MemoryManager
+	fm      PodEvictor // CXL节点容量不足时的兜底迁移
+
+	decision  *memory_manager.AdjustDecision // 正在进行的adjustDevices决策
+	reporter  *node_status.PressureReporter  // 上报混部内存压力
+	publisher *node_status.StatusPublisher   // 发布ColocationMemoryNode状态
+
+	// 周期调整、回收和管理接口触发的操作都持有d.mm.Lock()，与Pod事件处理互斥; devices、decisions和evicting也受其保护
+	paused    atomic.Bool                      // 暂停自动调整和回收，管理接口仍可手动触发
+	decisions []*memory_manager.AdjustDecision // 最近的调整决策，最多保留DecisionHistorySize条
+
+	evictCtx    context.Context                    // Shutdown时取消，中止后台进行中的兜底驱逐
+	evictCancel context.CancelFunc                 // 取消evictCtx
+	evictWG     sync.WaitGroup                     // 后台兜底驱逐协程
+	evicting    map[string]*memory_manager.PodInfo // 正在驱逐的Pod名称 -> Pod信息，受d.mm.Lock()保护
 }
 
 func NewDeviceMonitor(mm *memory_manager.MemoryManager) *DeviceMonitor {
-	monitor := &DeviceMonitor{
-		devices: make(map[string]*pluginapi.Device),
-		notify:  make(chan struct{}),
-		mm:      mm,
+	monitor := newDeviceMonitor(mm)
+	fm, err := fallback_migrator.NewFallbackMigrator(mm.Config)
+	if err != nil {
+		klog.Errorf("[NewDeviceMonitor] 初始化兜底迁移器失败: %v", err)
+	} else {
+		monitor.fm = fm
+	}
+	reporter, err := node_status.NewPressureReporter(mm.Config)
+	if err != nil {
+		klog.Errorf("[NewDeviceMonitor] 初始化节点压力上报失败: %v", err)
+	} else {
+		monitor.reporter = reporter
+	}
+	publisher, err := node_status.NewStatusPublisher(mm.Config)
+	if err != nil {
+		klog.Errorf("[NewDeviceMonitor] 初始化节点状态发布失败: %v", err)
+	} else {
+		monitor.publisher = publisher
 	}
 	return monitor
 }
 
+// NewOfflineDeviceMonitor 创建不连接API Server的设备监视器，供模拟器使用
+// evictor为nil时evict兜底策略按跳过处理
+func NewOfflineDeviceMonitor(mm *memory_manager.MemoryManager, evictor PodEvictor) *DeviceMonitor {
+	monitor := newDeviceMonitor(mm)
+	monitor.fm = evictor
+	_ = monitor.List()
+	return monitor
+}
+
+func newDeviceMonitor(mm *memory_manager.MemoryManager) *DeviceMonitor {
+	evictCtx, evictCancel := context.WithCancel(context.Background())
+	return &DeviceMonitor{
+		devices:     make(map[string]*pluginapi.Device),
+		updates:     newDeviceBroadcaster(),
+		mm:          mm,
+		evictCtx:    evictCtx,
+		evictCancel: evictCancel,
+		evicting:    make(map[string]*memory_manager.PodInfo),
+	}
+}
+
 // List all devices
 func (d *DeviceMonitor) List() error {
 	// for _, dev := range d.mm.ColocMemoryList {
@@ -38,23 +108,37 @@ func (d *DeviceMonitor) List() error {
 	// 	})
 	// }
 
+	d.mm.Lock()
+	defer d.mm.Unlock()
 	for _, dev := range d.mm.Uuid2ColocMetaData {
 		d.devices[dev.Uuid] = &pluginapi.Device{
 			ID:     dev.Uuid,
 			Health: pluginapi.Healthy,
 		}
 	}
+	d.notifyDevices()
 
 	return nil
 }
 
 // Watch device change
-func (d *DeviceMonitor) Watch() error {
+// ctx取消后返回，正在进行的调整(包括迁移)会先完成
+func (d *DeviceMonitor) Watch(ctx context.Context) error {
 
 	ticker := time.NewTicker(common.RefreshInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			klog.Info("[Watch] 停止监控设备")
+			return nil
+		case <-ticker.C:
+		}
+		if d.paused.Load() {
+			klog.Info("[Watch] 自动调整已暂停,跳过本次监控")
+			continue
+		}
 		// 防止pods_monitor在等待Pod进入running的时候还没更新ColocMetaData
 		if d.mm.PodCreateRunning.Load() {
 			klog.Info("[Watch] 有pod在创建过程中,跳过本次监控")
@@ -65,22 +149,78 @@ func (d *DeviceMonitor) Watch() error {
 			continue
 		}
 
-		d.mm.UpdateState()
-		if err := d.adjustDevices(); err != nil {
+		if err := d.adjustOnce(); err != nil {
 			klog.Errorf("[Watch] 调整设备失败: %v", err)
 			return errors.WithMessagef(err, "调整设备失败")
 		}
-		klog.Info("[Watch] 混部内存块数量: ", d.mm.PrevBlocks)
 	}
+}
+
+// 刷新内存状态并调整设备，随后上报节点状态和指标
+func (d *DeviceMonitor) adjustOnce() error {
+	d.mm.Lock()
+	defer d.mm.Unlock()
 
+	d.mm.UpdateState()
+	if err := d.adjustDevices(); err != nil {
+		return err
+	}
+	if d.reporter != nil {
+		d.reporter.Report(d.mm.LastDecision)
+	}
+	if d.publisher != nil {
+		d.publisher.Publish(d.mm)
+	}
+	d.updateMetrics()
+	klog.Info("[Watch] 混部内存块数量: ", d.mm.PrevBlocks)
 	return nil
+}
+
+// Shutdown 中止后台的兜底驱逐并移除临时污点，等待正在进行的操作完成，最后发布一次节点状态
+func (d *DeviceMonitor) Shutdown() {
+	// 驱逐协程结束时需要持有d.mm.Lock()更新账本，不能持有锁等待
+	d.evictCancel()
+	d.evictWG.Wait()
+	if d.fm != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), common.ConnectTimeout)
+		d.fm.Shutdown(ctx)
+		cancel()
+	}
 
+	d.mm.Lock()
+	if d.publisher != nil {
+		d.publisher.Flush(d.mm)
+	}
+	d.mm.Unlock()
+
+	// 等待后台协程把最后一次状态写到API Server
+	if d.reporter != nil {
+		d.reporter.Close()
+	}
+	if d.publisher != nil {
+		d.publisher.Close()
+	}
 }
 
-func (d *DeviceMonitor) PeriodicReclaimCheck() {
+// WaitEvictions 等待后台进行中的兜底驱逐结束并更新账本，模拟器在每次调整后调用，使结果可以复现
+func (d *DeviceMonitor) WaitEvictions() {
+	d.evictWG.Wait()
+}
+
+func (d *DeviceMonitor) PeriodicReclaimCheck(ctx context.Context) {
 	ticker := time.NewTicker(common.ReclaimCheckInterval)
 	defer ticker.Stop()
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			klog.Info("[periodicReclaimCheck] 停止周期性回收")
+			return
+		case <-ticker.C:
+		}
+		if d.paused.Load() {
+			klog.Info("[periodicReclaimCheck] 自动回收已暂停,跳过本次巡检")
+			continue
+		}
 		if d.mm.PodCreateRunning.Load() {
 			klog.Info("[periodicReclaimCheck] 有pod在创建过程中,跳过本次巡检")
 			continue
@@ -91,14 +231,25 @@ func (d *DeviceMonitor) PeriodicReclaimCheck() {
 }
 
 func (d *DeviceMonitor) tryReclaimSwapBlocks() {
+	d.mm.Lock()
+	defer d.mm.Unlock()
 	d.mm.PeriodicReclaimRunning.Store(true)
 	defer func() {
 		d.mm.PeriodicReclaimRunning.Store(false)
 	}()
 
+	reclaimed := false
+	defer func() {
+		// 迁回时块被替换，需要更新指标并通知kubelet
+		if reclaimed {
+			d.updateMetrics()
+			d.notifyDevices()
+		}
+	}()
+
 	for podName, podInfo := range d.mm.Pod2PodInfo {
-		// 如果没有待回收的块，跳过
-		if len(podInfo.SwapColocIds) == 0 {
+		// 如果没有待回收的块，跳过; 正在驱逐的Pod不再迁回
+		if len(podInfo.SwapColocIds) == 0 || d.evicting[podName] != nil {
 			continue
 		}
 
@@ -115,18 +266,52 @@ func (d *DeviceMonitor) tryReclaimSwapBlocks() {
 			continue
 		}
 
-		// 开始恢复块
+		// 先迁回页面，成功后再恢复块；失败时保留交换记录，下次巡检重试
+		swapNode := podInfo.SwapNode
+		if swapNode == "" {
+			swapNode = strconv.Itoa(common.SwapNumaNode)
+		}
+		var err error
+		if d.swapsByBytes() {
+			// 部分迁移和降级模式只迁回之前迁出的字节数
+			var moved uint64
+			moved, err = d.mm.MigratePodPartial(podName, swapNode, "0,1", podInfo.SwappedBytes)
+			podInfo.SwappedBytes -= min(moved, podInfo.SwappedBytes)
+			if err == nil {
+				podInfo.SwappedBytes = 0
+			}
+		} else {
+			// 先恢复cpuset.mems，否则页面无法迁回DRAM节点
+			if err := d.mm.RestorePodMemoryNodes(podName); err != nil {
+				klog.Warningf("[periodicCheck] 恢复 pod %s 的cpuset.mems失败: %v", podName, err)
+			}
+			_, err = d.mm.MigratePod(podName, swapNode, "0,1")
+			if err != nil {
+				// Pod仍在池化内存上，重新限制新分配的内存
+				if err := d.mm.SetPodMemoryNodes(podName, swapNode); err != nil {
+					klog.Warningf("[periodicCheck] 重新设置 pod %s 的cpuset.mems失败: %v", podName, err)
+				}
+			}
+		}
+		observeMigration(metrics.DirectionSwapIn, podInfo, err)
+		if err != nil {
+			klog.Errorf("[periodicCheck] Pod %s 迁回失败, 保留 %d 个交换块等待下次巡检: %v", podName, len(podInfo.SwapColocIds), err)
+			continue
+		}
+
+		// 恢复块
+		reclaimed = true
 		for _, blkID := range podInfo.SwapColocIds {
-			d.generateBlock(true, blkID, podInfo.Name)
+			d.generateBlock(true, blkID, podInfo.Name, reasonReclaim)
 			podInfo.BindColocIds = append(podInfo.BindColocIds, blkID)
 		}
-
-		// 触发 Pod 迁移逻辑
-		d.mm.MigratePod(podName, "2", "0,1")
+		d.recordMigrationEvent(podInfo, memory_manager.EventSwappedIn, len(podInfo.SwapColocIds))
 		klog.Infof("[periodicCheck] Pod %s 已迁回，恢复 %d 个块", podName, len(podInfo.SwapColocIds))
 
 		// 清空 SwapColocIds
 		podInfo.SwapColocIds = []string{}
+		podInfo.SwapNode = ""
+		d.mm.AnnotatePodTier(podInfo)
 	}
 }
 
@@ -137,6 +322,23 @@ func (d *DeviceMonitor) adjustDevices() error {
 	currentBlocks := int(d.mm.ColocMemory / common.BlockSize)
 	delta := currentBlocks - d.mm.PrevBlocks
 
+	// 记录本次决策，交换和驱逐过程中会补充详细信息
+	d.decision = &memory_manager.AdjustDecision{
+		ID:            utils.GetUuid(),
+		Time:          time.Now(),
+		ColocMemory:   d.mm.ColocMemory,
+		PrevBlocks:    d.mm.PrevBlocks,
+		CurrentBlocks: currentBlocks,
+	}
+	defer func() {
+		d.mm.LastDecision = d.decision
+		d.decisions = append(d.decisions, d.decision)
+		if len(d.decisions) > common.DecisionHistorySize {
+			d.decisions = slices.Clone(d.decisions[len(d.decisions)-common.DecisionHistorySize:])
+		}
+		d.decision = nil
+	}()
+
 	// TODO: 为了测试方便,先不做防抖,记得改回来
 
 	// // 滞后区间
@@ -157,8 +359,12 @@ func (d *DeviceMonitor) adjustDevices() error {
 		// 增加块
 		d.addColocDevices(delta)
 	case delta < 0:
-		// 减少块
-		d.removeColocDevices(-delta)
+		// 减少块，没有删够时按实际块数记录，正在驱逐的块在驱逐成功后扣除，其余的下次调整继续删除
+		if removed := d.removeColocDevices(-delta); removed < -delta {
+			klog.Warningf("[adjustDevices] 删除了 %d/%d 个块, 正在驱逐 %d 个块", removed, -delta, d.evictingBlocks())
+			currentBlocks = d.mm.PrevBlocks - removed
+			d.decision.CurrentBlocks = currentBlocks
+		}
 	case delta == 0:
 		klog.Info("[adjustDevices] 设备数量不变")
 	}
@@ -208,15 +414,24 @@ func (d *DeviceMonitor) addColocDevices(addCount int) {
 
 	// // Step 2: 如果不足，生成新的块
 	for range addCount {
-		d.generateBlock(false, "", "")
+		d.generateBlock(false, "", "", reasonCapacityIncrease)
+	}
+	if d.decision != nil {
+		d.decision.AddedBlocks = addCount
 	}
-	d.notify <- struct{}{}
+	d.notifyDevices()
 	klog.Infof("[adjustDevices] 增加设备完成，总共增加设备数量: %d", addCount)
 }
 
-func (d *DeviceMonitor) removeColocDevices(removeCount int) {
+// 删除removeCount个块，返回实际减少的块数
+// 正在后台驱逐的Pod的块驱逐成功后会被删除，计入删除目标，不再为它们交换其他Pod
+func (d *DeviceMonitor) removeColocDevices(removeCount int) int {
 	deletedCount := 0
-	targetDeleteCount := removeCount
+	targetDeleteCount := removeCount - d.evictingBlocks()
+	if targetDeleteCount <= 0 {
+		klog.Infof("[adjustDevices] 正在驱逐的块足够删除 %d 个块", removeCount)
+		return 0
+	}
 
 	// Step 1: 收集未使用的块
 	unusedKeys := make([]string, 0, removeCount)
@@ -234,8 +449,12 @@ func (d *DeviceMonitor) removeColocDevices(removeCount int) {
 		klog.Infof("[adjustDevices] 删除未使用块: %v", d.mm.Uuid2ColocMetaData[blkID])
 		delete(d.mm.Uuid2ColocMetaData, blkID)
 		delete(d.devices, blkID)
+		d.auditBlock(audit.EventDeleted, blkID, "", "", reasonCapacityDecrease)
 		deletedCount++
 	}
+	if d.decision != nil {
+		d.decision.RemovedUnused = deletedCount
+	}
 
 	// Step 3: 如果不够，按 most_used 策略删除使用中的块（整 pod）
 	if deletedCount < targetDeleteCount {
@@ -260,49 +479,229 @@ func (d *DeviceMonitor) removeColocDevices(removeCount int) {
 			if deletedCount >= targetDeleteCount {
 				break
 			}
-			klog.Infof("[adjustDevices] 迁移 Pod: %s, 删除绑定块: %v", pod.PodName, pod.BlockIDs)
-			for _, blkID := range pod.BlockIDs {
-				delete(d.mm.Uuid2ColocMetaData, blkID)
-				delete(d.devices, blkID)
-				deletedCount++
-
-				// 记录交换出去的块
-				d.mm.Pod2PodInfo[pod.PodName].SwapColocIds = append(d.mm.Pod2PodInfo[pod.PodName].SwapColocIds, blkID)
-
-				// 如果删除的块数量超过目标数量，生成新的块
-				// 这样子对k8s来说多余的块空了出来，作为一个新的设备
-				if deletedCount > targetDeleteCount {
-					d.generateBlock(false, "", "")
-				}
+			// 已经全部交换出去的Pod没有可删除的块，正在驱逐的Pod等待驱逐结果
+			if len(pod.BlockIDs) == 0 || d.evicting[pod.PodName] != nil {
+				continue
+			}
+
+			podInfo := d.mm.Pod2PodInfo[pod.PodName]
+			if d.swapsByBytes() {
+				// 部分迁移: 只交换出还差的块数，Pod剩余的块继续留在DRAM
+				deletedCount += d.swapOutPodPartial(podInfo, targetDeleteCount-deletedCount)
+			} else {
+				deletedCount += d.swapOutPod(podInfo)
 			}
+			// 兜底策略开始驱逐该Pod，它的块驱逐成功后删除
+			if d.evicting[pod.PodName] != nil {
+				targetDeleteCount -= len(pod.BlockIDs)
+			}
+		}
 
-			// TODO: 先看看NUMA节点的内存是否充足，不充足直接兜底迁移
-			// cxlNodeInfo, err := memory_manager.GetNumaMemInfo(2)
-			// if err != nil {
-			// 	klog.Errorf("[adjustDevices] 获取NUMA节点内存信息失败: %v", err)
-			// }
-			// if cxlNodeInfo.Free < common.BlockSize*uint64(len(d.mm.Pod2PodInfo[pod.PodName].SwapColocIds)) {
-			// 	klog.Info("[adjustDevices] NUMA节点内存不足,兜底迁移")
-			// 	fallback_migrator.MigratePodToAnotherNode(fmt.Sprintf("/home/liuyang/i-device-plugin-main/deploy/%s.yaml", pod.PodName))
-			// 	klog.Info("[adjustDevices] Pod迁移完成")
-			// 	continue
-			// }
-
-			// 这里写死了NUMA node
-			d.mm.MigratePod(pod.PodName, "0,1", "2")
-
-			// 清空Pod绑定的虚拟内存块
-			d.mm.Pod2PodInfo[pod.PodName].BindColocIds = []string{}
-
-			klog.Infof("[adjustDevices] %s信息更新, BindColocIds数量: %d, SwapColocIds数量: %d", d.mm.Pod2PodInfo[pod.PodName].Name, len(d.mm.Pod2PodInfo[pod.PodName].BindColocIds), len(d.mm.Pod2PodInfo[pod.PodName].SwapColocIds))
+		// 驱逐的块可能多于还差的块数，多删除的部分在驱逐完成后由下次调整补回
+		targetDeleteCount = max(targetDeleteCount, 0)
+
+		// 如果删除的块数量超过目标数量，生成新的块
+		// 这样子对k8s来说多余的块空了出来，作为一个新的设备
+		for range deletedCount - targetDeleteCount {
+			d.generateBlock(false, "", "", reasonSwapOutOvershoot)
 		}
 	}
 
-	d.notify <- struct{}{}
+	d.notifyDevices()
 	klog.Infof("[adjustDevices] 总共删除设备数量: %d(目标 %d)", deletedCount, targetDeleteCount)
+	// 多删除的块已经重新生成
+	return min(deletedCount, targetDeleteCount)
 }
 
-func (d *DeviceMonitor) generateBlock(isSwap bool, swapColocId string, podName string) {
+// 整Pod迁移：交换出Pod绑定的所有块，并把Pod的所有页面迁移到池化内存节点，返回删除的块数
+func (d *DeviceMonitor) swapOutPod(podInfo *memory_manager.PodInfo) int {
+	// 先检查池化内存节点的容量，不足时按兜底策略处理
+	bytes := d.mm.EstimateSwapBytes(podInfo.Name, "0,1")
+	target, action := d.reserveSwapTarget(podInfo, bytes)
+	switch action {
+	case swapActionSkip:
+		d.decision.RecordSkip(podInfo.Name)
+		return 0
+	case swapActionEvict:
+		return d.evictPod(podInfo)
+	}
+	defer d.mm.ReleaseNodeCapacity(target, bytes)
+	swapNode := strconv.Itoa(target)
+
+	// 先迁移再更新账本，迁移失败时块仍绑定在Pod上，选择下一个牺牲者
+	_, err := d.mm.MigratePod(podInfo.Name, "0,1", swapNode)
+	observeMigration(metrics.DirectionSwapOut, podInfo, err)
+	if err != nil {
+		klog.Errorf("[adjustDevices] 迁移 pod %s 失败, 保留绑定块: %v", podInfo.Name, err)
+		d.decision.RecordSkip(podInfo.Name)
+		return 0
+	}
+	// 迁移成功后限制Pod新分配的内存也落在池化内存节点上，避免Pod慢慢漂移回DRAM
+	if err := d.mm.SetPodMemoryNodes(podInfo.Name, swapNode); err != nil {
+		klog.Warningf("[adjustDevices] 设置 pod %s 的cpuset.mems失败: %v", podInfo.Name, err)
+	}
+
+	count := len(podInfo.BindColocIds)
+	d.decision.RecordSwapOut(podInfo.Name, count)
+	klog.Infof("[adjustDevices] 迁移 Pod: %s, 删除绑定块: %v", podInfo.Name, podInfo.BindColocIds)
+	for _, blkID := range podInfo.BindColocIds {
+		delete(d.mm.Uuid2ColocMetaData, blkID)
+		delete(d.devices, blkID)
+		d.auditBlock(audit.EventSwappedOut, blkID, podInfo.Name, memory_manager.TierCXL, d.swapOutReason())
+	}
+
+	// 记录交换出去的块，清空Pod绑定的虚拟内存块
+	podInfo.SwapColocIds = append(podInfo.SwapColocIds, podInfo.BindColocIds...)
+	podInfo.SwapNode = swapNode
+	podInfo.BindColocIds = []string{}
+	podInfo.MigrationCount++
+	d.recordMigrationEvent(podInfo, memory_manager.EventSwappedOut, count)
+	d.mm.AnnotatePodTier(podInfo)
+
+	klog.Infof("[adjustDevices] %s信息更新, BindColocIds数量: %d, SwapColocIds数量: %d", podInfo.Name, len(podInfo.BindColocIds), len(podInfo.SwapColocIds))
+	return count
+}
+
+// 部分迁移一个Pod：按count个块的字节数迁移(或降级)页面，只交换出实际迁移字节数覆盖的块，返回删除的块数
+// Pod同时使用两层内存，这里不修改cpuset.mems，否则cgroup v2会把剩余的页面也迁移过去
+func (d *DeviceMonitor) swapOutPodPartial(podInfo *memory_manager.PodInfo, count int) int {
+	count = min(count, len(podInfo.BindColocIds))
+	bytes := uint64(count) * common.BlockSize
+	target, action := d.reserveSwapTarget(podInfo, bytes)
+	switch action {
+	case swapActionSkip:
+		d.decision.RecordSkip(podInfo.Name)
+		return 0
+	case swapActionEvict:
+		return d.evictPod(podInfo)
+	}
+	defer d.mm.ReleaseNodeCapacity(target, bytes)
+	swapNode := strconv.Itoa(target)
+
+	var moved uint64
+	var err error
+	if d.mm.Config.MigrationMode == common.MigrationModeDemotion {
+		// 降级模式只把冷页面交给内核降级，按实际降级的字节数计算
+		var result *memory_manager.DemotionResult
+		if result, err = d.mm.DemotePod(podInfo.Name, "0,1", swapNode, bytes); err == nil {
+			moved = result.Demoted
+		} else {
+			klog.Errorf("[adjustDevices] 降级 pod %s 失败: %v", podInfo.Name, err)
+		}
+	} else {
+		// 中途失败时已经迁移的页面仍在池化内存节点上
+		moved, err = d.mm.MigratePodPartial(podInfo.Name, "0,1", swapNode, bytes)
+	}
+	observeMigration(metrics.DirectionSwapOut, podInfo, err)
+	podInfo.SwappedBytes += moved
+
+	// 不足一个块的部分不交换，账本只减少确实从DRAM迁出的块
+	swapped := min(count, int(moved/common.BlockSize))
+	if swapped == 0 {
+		klog.Errorf("[adjustDevices] pod %s 只迁移了 %d/%d 字节, 保留绑定块", podInfo.Name, moved, bytes)
+		d.decision.RecordSkip(podInfo.Name)
+		return 0
+	}
+
+	d.decision.RecordSwapOut(podInfo.Name, swapped)
+	swapIds := podInfo.BindColocIds[:swapped]
+	klog.Infof("[adjustDevices] 部分迁移 Pod: %s, 删除绑定块: %v", podInfo.Name, swapIds)
+
+	for _, blkID := range swapIds {
+		delete(d.mm.Uuid2ColocMetaData, blkID)
+		delete(d.devices, blkID)
+		d.auditBlock(audit.EventSwappedOut, blkID, podInfo.Name, memory_manager.TierCXL, d.swapOutReason())
+	}
+
+	// 记录交换出去的块，剩余的块仍绑定在Pod上
+	podInfo.SwapColocIds = append(podInfo.SwapColocIds, swapIds...)
+	podInfo.BindColocIds = slices.Clone(podInfo.BindColocIds[swapped:])
+	podInfo.SwapNode = swapNode
+	podInfo.MigrationCount++
+	d.recordMigrationEvent(podInfo, memory_manager.EventSwappedOut, swapped)
+	d.mm.AnnotatePodTier(podInfo)
+
+	klog.Infof("[adjustDevices] %s信息更新, BindColocIds数量: %d, SwapColocIds数量: %d, 已迁移字节数: %d", podInfo.Name, len(podInfo.BindColocIds), len(podInfo.SwapColocIds), podInfo.SwappedBytes)
+	return swapped
+}
+
+// 迁移成功后在Pod上发出事件，字节数和耗时取自迁移校验结果
+func (d *DeviceMonitor) recordMigrationEvent(podInfo *memory_manager.PodInfo, reason string, blocks int) {
+	report := podInfo.LastMigration
+	if report == nil {
+		return
+	}
+	d.mm.RecordPodEvent(podInfo, corev1.EventTypeNormal, reason,
+		"Moved %d blocks from NUMA node %s to %s: %d bytes migrated in %s",
+		blocks, report.SrcNode, report.DstNode, report.BytesMovedTo(report.DstNode), report.Duration.Round(time.Millisecond))
+}
+
+// 记录迁移次数和成功迁移的耗时，耗时取自迁移校验结果
+func observeMigration(direction string, podInfo *memory_manager.PodInfo, err error) {
+	metrics.Migrations.WithLabelValues(direction, metrics.Result(err)).Inc()
+	if err == nil && podInfo.LastMigration != nil {
+		metrics.MigrationDuration.WithLabelValues(direction).Observe(podInfo.LastMigration.Duration.Seconds())
+	}
+}
+
+// 审计日志中块状态变化的原因
+const (
+	reasonCapacityIncrease = "capacity_increase"  // 混部内存增加，新建空闲块
+	reasonCapacityDecrease = "capacity_decrease"  // 混部内存减少，删除空闲块或交换Pod
+	reasonSwapOutOvershoot = "swap_out_overshoot" // 交换整个Pod释放的块多于需要删除的块
+	reasonReclaim          = "reclaim"            // 空闲块充足，Pod迁回DRAM
+	reasonEvicted          = "evicted"            // 池化内存容量不足，兜底驱逐Pod
+	reasonAdminSwapOut     = "admin_swap_out"     // 通过管理接口手动交换Pod
+)
+
+// 记录块状态变化，adjustDevices过程中的变化关联到本次决策
+func (d *DeviceMonitor) auditBlock(event, block, podName, tier, reason string) {
+	record := audit.Record{Event: event, Block: block, Pod: podName, Tier: tier, Reason: reason}
+	if d.decision != nil {
+		record.DecisionID = d.decision.ID
+	}
+	d.mm.Audit.Log(record)
+}
+
+// 交换Pod的原因: adjustDevices中是容量减少，否则是管理接口手动触发
+func (d *DeviceMonitor) swapOutReason() string {
+	if d.decision != nil {
+		return reasonCapacityDecrease
+	}
+	return reasonAdminSwapOut
+}
+
+// 更新内存和块状态指标
+func (d *DeviceMonitor) updateMetrics() {
+	metrics.TotalMemoryBytes.Set(float64(d.mm.TotalMemory))
+	metrics.OnlinePodsUsedBytes.Set(float64(d.mm.OnlinePodsUsed))
+	metrics.SafetyMarginBytes.Set(float64(d.mm.SafetyMargin))
+	metrics.ColocMemoryBytes.Set(float64(d.mm.ColocMemory))
+	metrics.Blocks.Set(float64(d.mm.PrevBlocks))
+
+	var free, bound, swapped int
+	for _, meta := range d.mm.Uuid2ColocMetaData {
+		if meta.Used {
+			bound++
+		} else {
+			free++
+		}
+	}
+	for _, podInfo := range d.mm.Pod2PodInfo {
+		swapped += len(podInfo.SwapColocIds)
+	}
+	metrics.BlocksByState.WithLabelValues(metrics.BlockStateFree).Set(float64(free))
+	metrics.BlocksByState.WithLabelValues(metrics.BlockStateBound).Set(float64(bound))
+	metrics.BlocksByState.WithLabelValues(metrics.BlockStateSwapped).Set(float64(swapped))
+}
+
+// 部分迁移和降级模式按字节数迁移，Pod可以同时使用DRAM和CXL
+func (d *DeviceMonitor) swapsByBytes() bool {
+	mode := d.mm.Config.MigrationMode
+	return mode == common.MigrationModePartial || mode == common.MigrationModeDemotion
+}
+
+func (d *DeviceMonitor) generateBlock(isSwap bool, swapColocId string, podName string, reason string) {
 
 	var deviceId string
 
@@ -320,6 +719,7 @@ func (d *DeviceMonitor) generateBlock(isSwap bool, swapColocId string, podName s
 		if removedID != "" {
 			delete(d.mm.Uuid2ColocMetaData, removedID)
 			delete(d.devices, removedID)
+			d.auditBlock(audit.EventDeleted, removedID, "", "", reason)
 		} else {
 			klog.Warningf("[generateBlock] 未找到可回收的空闲块，无法清理空间恢复块 %s", swapColocId)
 		}
@@ -332,6 +732,7 @@ func (d *DeviceMonitor) generateBlock(isSwap bool, swapColocId string, podName s
 			BindPod:    podName,
 			UpdateTime: time.Now(),
 		}
+		d.auditBlock(audit.EventSwappedIn, deviceId, podName, memory_manager.TierDRAM, reason)
 	case false:
 		deviceId = fmt.Sprintf(common.DeviceName, utils.GetUuid())
 		d.mm.Uuid2ColocMetaData[deviceId] = &memory_manager.ColocMemoryBlockMetaData{
@@ -340,6 +741,7 @@ func (d *DeviceMonitor) generateBlock(isSwap bool, swapColocId string, podName s
 			BindPod:    "",
 			UpdateTime: time.Now(),
 		}
+		d.auditBlock(audit.EventCreated, deviceId, "", memory_manager.TierDRAM, reason)
 	}
 
 	d.devices[deviceId] = &pluginapi.Device{
@@ -348,12 +750,25 @@ func (d *DeviceMonitor) generateBlock(isSwap bool, swapColocId string, podName s
 	}
 }
 
+// 把当前设备列表发布给所有ListAndWatch流，不会阻塞
+func (d *DeviceMonitor) notifyDevices() {
+	d.updates.Publish(d.Devices())
+}
+
 // Devices transformer map to slice
+// 返回按ID排序的副本，之后对设备的修改不会影响已经发布的列表; 修改设备的操作都持有d.mm.Lock()，调用方也需要持有
 func (d *DeviceMonitor) Devices() []*pluginapi.Device {
 	devices := make([]*pluginapi.Device, 0, len(d.devices))
 	for _, device := range d.devices {
-		devices = append(devices, device)
+		devices = append(devices, &pluginapi.Device{
+			ID:       device.ID,
+			Health:   device.Health,
+			Topology: device.Topology,
+		})
 	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
 	return devices
 }
 
@@ -0,0 +1,39 @@
+package device_plugin
+
+import (
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// ListAndWatchUntil 不经过gRPC直接调用ListAndWatch，stop代替gRPC服务的停止信号
+func (c *ColocationMemoryDevicePlugin) ListAndWatchUntil(srv pluginapi.DevicePlugin_ListAndWatchServer, stop <-chan struct{}) error {
+	return c.listAndWatch(srv, stop)
+}
+
+// ListAndWatchStreams 正在订阅设备列表的流数
+func (c *ColocationMemoryDevicePlugin) ListAndWatchStreams() int {
+	return c.dm.updates.Subscribers()
+}
+
+// SwapOutPodPartial 持有锁部分交换一个Pod，返回交换出去的块数
+func (d *DeviceMonitor) SwapOutPodPartial(podName string, count int) int {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+	return d.swapOutPodPartial(d.mm.Pod2PodInfo[podName], count)
+}
+
+type SwapAction = swapAction
+
+const (
+	SwapActionMigrate = swapActionMigrate
+	SwapActionEvict   = swapActionEvict
+	SwapActionSkip    = swapActionSkip
+)
+
+// ReserveSwapTarget 持有锁选择交换目标节点，返回迁移时由调用方释放预留的容量
+func (d *DeviceMonitor) ReserveSwapTarget(podInfo *memory_manager.PodInfo, bytes uint64) (int, SwapAction) {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+	return d.reserveSwapTarget(podInfo, bytes)
+}
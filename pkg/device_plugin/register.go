@@ -3,25 +3,31 @@ package device_plugin
 import (
 	"context"
 	"path"
+	"time"
 
 	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/utils"
 
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
 // Register registers the device plugin for the given resourceName with Kubelet.
 func (c *ColocationMemoryDevicePlugin) Register() error {
-	conn, err := connect(pluginapi.KubeletSocket, common.ConnectTimeout)
+	// 在连接之前读取，注册期间kubelet.sock被替换时下一次事件会重新注册
+	kubeletID, _ := utils.StatFileID(c.kubeletSocket)
+	conn, err := connect(c.kubeletSocket, common.ConnectTimeout)
 	if err != nil {
-		return errors.WithMessagef(err, "connect to %s failed", pluginapi.KubeletSocket)
+		return errors.WithMessagef(err, "connect to %s failed", c.kubeletSocket)
 	}
 	defer conn.Close()
 
 	client := pluginapi.NewRegistrationClient(conn)
 	reqt := &pluginapi.RegisterRequest{
 		Version:      pluginapi.Version,
-		Endpoint:     path.Base(common.DeviceSocket),
+		Endpoint:     path.Base(c.socket),
 		ResourceName: common.ResourceName,
 		// 如果需要使用 GetPreferredAllocation，需要指定开启
 		Options: &pluginapi.DevicePluginOptions{
@@ -34,5 +40,61 @@ func (c *ColocationMemoryDevicePlugin) Register() error {
 	if err != nil {
 		return errors.WithMessage(err, "register to kubelet failed")
 	}
+	c.mu.Lock()
+	c.kubeletID = kubeletID
+	c.mu.Unlock()
 	return nil
 }
+
+// 注册失败时按间隔重试，直到成功或ctx取消
+// kubelet.sock刚创建时kubelet可能还没有开始服务
+func (c *ColocationMemoryDevicePlugin) registerWithRetry(ctx context.Context) error {
+	return wait.PollUntilContextCancel(ctx, common.RegisterRetryInterval, true, func(context.Context) (bool, error) {
+		if err := c.Register(); err != nil {
+			klog.Warningf("[registerWithRetry] 注册到kubelet失败, %s 后重试: %v", common.RegisterRetryInterval, err)
+			return false, nil
+		}
+		klog.Info("[registerWithRetry] 已重新注册到kubelet")
+		return true, nil
+	})
+}
+
+// WatchKubelet 监听kubelet重启，在进程内重建gRPC服务并重新注册，直到ctx取消
+// 重建gRPC服务失败时返回错误，由DaemonSet重启插件
+func (c *ColocationMemoryDevicePlugin) WatchKubelet(ctx context.Context) error {
+	restart := make(chan struct{}, 1)
+	if err := utils.WatchKubelet(ctx, c.kubeletSocket, c.socket, restart); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-restart:
+		}
+		// kubelet重启时会先删除插件socket再创建kubelet.sock，等待事件稳定后只重启一次
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(common.KubeletRestartDebounce):
+		}
+		select {
+		case <-restart:
+		default:
+		}
+		// 重建gRPC服务时插件会删除并重新创建自己的socket，这些事件不能再触发重启
+		if !c.socketsChanged() {
+			klog.Info("[WatchKubelet] socket没有变化, 忽略插件自己重建gRPC服务产生的事件")
+			continue
+		}
+
+		klog.Warning("[WatchKubelet] kubelet重启, 重建gRPC服务并重新注册")
+		if err := c.Restart(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"net"
 	"os"
 	"path"
+	"sync"
 	"syscall"
 	"time"
 
 	"liuyang/colocation-memory-device-plugin/pkg/common"
 	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"liuyang/colocation-memory-device-plugin/pkg/utils"
 
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
@@ -19,40 +21,128 @@ import (
 )
 
 type ColocationMemoryDevicePlugin struct {
-	server *grpc.Server
-	stop   chan struct{} // this channel signals to stop the device plugin
-	dm     *DeviceMonitor
+	mu            sync.Mutex // 保护server、stop和stopped，kubelet重启后会重建gRPC服务
+	server        *grpc.Server
+	stop          chan struct{} // this channel signals to stop the device plugin, 每个gRPC服务一个，见pluginServer
+	stopped       bool
+	wg            sync.WaitGroup // 设备监控和周期回收协程
+	dm            *DeviceMonitor
+	socket        string // 插件的gRPC socket
+	kubeletSocket string // kubelet注册服务的socket
+
+	// 当前gRPC服务监听的socket文件和上次注册成功时的kubelet.sock，受mu保护
+	// 两者都没有变化时，socket目录下的事件来自插件自己重建gRPC服务，不需要重启
+	socketID  utils.FileID
+	kubeletID utils.FileID
 }
 
 func NewColocationMemoryDevicePlugin(mm *memory_manager.MemoryManager) *ColocationMemoryDevicePlugin {
+	return newColocationMemoryDevicePlugin(mm.Config, NewDeviceMonitor(mm))
+}
+
+// NewOfflineColocationMemoryDevicePlugin 使用不连接API Server的设备监视器创建插件，供测试工具使用
+func NewOfflineColocationMemoryDevicePlugin(mm *memory_manager.MemoryManager) *ColocationMemoryDevicePlugin {
+	return newColocationMemoryDevicePlugin(mm.Config, newDeviceMonitor(mm))
+}
+
+func newColocationMemoryDevicePlugin(config *common.Config, dm *DeviceMonitor) *ColocationMemoryDevicePlugin {
 	return &ColocationMemoryDevicePlugin{
-		server: grpc.NewServer(grpc.EmptyServerOption{}),
-		stop:   make(chan struct{}),
-		dm:     NewDeviceMonitor(mm),
+		dm:            dm,
+		socket:        path.Join(config.DevicePluginDir, common.DeviceSocket),
+		kubeletSocket: config.KubeletSocket,
 	}
 }
 
+// Monitor 返回设备监视器，供管理接口使用
+func (c *ColocationMemoryDevicePlugin) Monitor() *DeviceMonitor {
+	return c.dm
+}
+
 // Run start gRPC server and watcher
-func (c *ColocationMemoryDevicePlugin) Run() error {
+// ctx取消后后台循环退出，随后调用Stop停止gRPC服务
+func (c *ColocationMemoryDevicePlugin) Run(ctx context.Context) error {
 	err := c.dm.List()
 	if err != nil {
 		log.Fatalf("list device error: %v", err)
 	}
 
+	c.wg.Add(2)
 	go func() {
-		if err = c.dm.Watch(); err != nil {
+		defer c.wg.Done()
+		if err := c.dm.Watch(ctx); err != nil {
 			log.Println("watch devices error")
 		}
 	}()
 
-	go c.dm.PeriodicReclaimCheck()
+	go func() {
+		defer c.wg.Done()
+		c.dm.PeriodicReclaimCheck(ctx)
+	}()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.serve()
+}
+
+// Restart kubelet重启后重建gRPC服务并重新注册，设备监视器和MemoryManager的账本保持不变
+func (c *ColocationMemoryDevicePlugin) Restart(ctx context.Context) error {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return errors.New("device plugin stopped")
+	}
+	server, stop := c.detachServer()
+	c.mu.Unlock()
+	// GracefulStop等待ListAndWatch返回，不能持有c.mu
+	stopServer(server, stop)
+
+	c.mu.Lock()
+	var err error
+	switch {
+	case c.stopped:
+		err = errors.New("device plugin stopped")
+	case c.server == nil:
+		err = c.serve()
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return errors.WithMessage(err, "restart gRPC server failed")
+	}
+	return c.registerWithRetry(ctx)
+}
+
+// Stop 停止插件，调用前需要取消传给Run的ctx
+// 先等待后台循环退出(进行中的迁移会先完成)并写入最终状态，再结束ListAndWatch、优雅停止gRPC服务并删除socket
+func (c *ColocationMemoryDevicePlugin) Stop() {
+	c.wg.Wait()
+	c.dm.Shutdown()
+
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.stopped = true
+	server, stop := c.detachServer()
+	c.mu.Unlock()
+
+	stopServer(server, stop)
+	if err := os.Remove(c.socket); err != nil && !os.IsNotExist(err) {
+		log.Printf("delete socket %s failed: %v", c.socket, err)
+	}
+}
+
+// 在插件socket上启动新的gRPC服务，调用方持有c.mu
+func (c *ColocationMemoryDevicePlugin) serve() error {
+	c.server = grpc.NewServer(grpc.EmptyServerOption{})
+	c.stop = make(chan struct{})
 
 	// use grpc to register
-	pluginapi.RegisterDevicePluginServer(c.server, c)
+	pluginapi.RegisterDevicePluginServer(c.server, &pluginServer{ColocationMemoryDevicePlugin: c, stop: c.stop})
 	// delete old unix socket before start
 	// /var/lib/kubelet/device-plugins/colocationMemory.sock
-	socket := path.Join(pluginapi.DevicePluginPath, common.DeviceSocket)
-	err = syscall.Unlink(socket)
+	socket := c.socket
+	err := syscall.Unlink(socket)
 	if err != nil && !os.IsNotExist(err) {
 		return errors.WithMessagef(err, "delete socket %s failed", socket)
 	}
@@ -62,10 +152,12 @@ func (c *ColocationMemoryDevicePlugin) Run() error {
 		return errors.WithMessagef(err, "listen unix %s failed", socket)
 	}
 
+	c.socketID, _ = utils.StatFileID(socket)
+
 	go c.server.Serve(sock)
 
 	// Wait for server to start by launching a blocking connection
-	conn, err := connect(common.DeviceSocket, 5*time.Second)
+	conn, err := connect(socket, 5*time.Second)
 	if err != nil {
 		return err
 	}
@@ -74,6 +166,49 @@ func (c *ColocationMemoryDevicePlugin) Run() error {
 	return nil
 }
 
+// socket目录下的文件事件是否来自kubelet：kubelet.sock被重新创建，或者插件的socket被删除或替换
+func (c *ColocationMemoryDevicePlugin) socketsChanged() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kubeletID, ok := utils.StatFileID(c.kubeletSocket)
+	if !ok || kubeletID != c.kubeletID {
+		return true
+	}
+	socketID, ok := utils.StatFileID(c.socket)
+	return !ok || socketID != c.socketID
+}
+
+// 取下当前的gRPC服务和它的停止信号，之后由stopServer在不持有c.mu时停止，调用方持有c.mu
+func (c *ColocationMemoryDevicePlugin) detachServer() (*grpc.Server, chan struct{}) {
+	server, stop := c.server, c.stop
+	c.server, c.stop = nil, nil
+	return server, stop
+}
+
+// 结束服务上的ListAndWatch并优雅停止gRPC服务
+// GracefulStop等待所有处理函数返回，调用方不能持有c.mu
+func stopServer(server *grpc.Server, stop chan struct{}) {
+	if server == nil {
+		return
+	}
+	close(stop)
+	server.GracefulStop()
+}
+
+// pluginServer 注册到一个gRPC服务上的插件
+// ListAndWatch使用创建服务时的停止信号，不需要获取c.mu，kubelet重启后旧服务上的流也不会拿到新服务的信号
+type pluginServer struct {
+	*ColocationMemoryDevicePlugin
+	stop <-chan struct{}
+}
+
+var _ pluginapi.DevicePluginServer = &pluginServer{}
+
+func (s *pluginServer) ListAndWatch(_ *pluginapi.Empty, srv pluginapi.DevicePlugin_ListAndWatchServer) error {
+	return s.listAndWatch(srv, s.stop)
+}
+
 // dial establishes the gRPC communication with the registered device plugin.
 func connect(socketPath string, timeout time.Duration) (*grpc.ClientConn, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
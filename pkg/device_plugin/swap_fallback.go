@@ -0,0 +1,146 @@
+package device_plugin
+
+import (
+	"liuyang/colocation-memory-device-plugin/pkg/audit"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/fallback_migrator"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"liuyang/colocation-memory-device-plugin/pkg/metrics"
+	"strconv"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// 交换前容量检查的结果
+type swapAction int
+
+const (
+	swapActionMigrate swapAction = iota // 迁移到选定的池化内存节点
+	swapActionEvict                     // 驱逐Pod
+	swapActionSkip                      // 跳过该Pod，选择下一个牺牲者
+)
+
+// 选择交换目标节点并预留容量，容量不足时按配置的兜底策略处理
+// 返回actionMigrate时需要调用ReleaseNodeCapacity释放预留的容量
+func (d *DeviceMonitor) reserveSwapTarget(podInfo *memory_manager.PodInfo, bytes uint64) (int, swapAction) {
+	// 已经部分交换出去的Pod继续使用原来的节点
+	preferred := common.SwapNumaNode
+	if podInfo.SwapNode != "" {
+		if id, err := strconv.Atoi(podInfo.SwapNode); err == nil {
+			preferred = id
+		}
+	}
+
+	err := d.mm.ReserveNodeCapacity(preferred, bytes)
+	if err == nil {
+		return preferred, swapActionMigrate
+	}
+	klog.Warningf("[reserveSwapTarget] pod %s 无法迁移到节点 %d: %v, 兜底策略: %s", podInfo.Name, preferred, err, d.mm.Config.FallbackPolicy)
+
+	switch d.mm.Config.FallbackPolicy {
+	case common.FallbackPolicyOtherNode:
+		// 已经部分交换出去的Pod不能分散到两个池化内存节点上，按another-node失败处理
+		if podInfo.SwapNode != "" {
+			klog.Infof("[reserveSwapTarget] pod %s 已交换到节点 %s, 不能改用其他节点, 跳过", podInfo.Name, podInfo.SwapNode)
+			metrics.Fallbacks.WithLabelValues(common.FallbackPolicyOtherNode, metrics.ResultFailure).Inc()
+			return -1, swapActionSkip
+		}
+		for _, node := range d.mm.Topology.CxlNodes {
+			if node == preferred {
+				continue
+			}
+			if err := d.mm.ReserveNodeCapacity(node, bytes); err == nil {
+				klog.Infof("[reserveSwapTarget] pod %s 改为迁移到节点 %d", podInfo.Name, node)
+				metrics.Fallbacks.WithLabelValues(common.FallbackPolicyOtherNode, metrics.ResultSuccess).Inc()
+				return node, swapActionMigrate
+			}
+		}
+		// 一次兜底只记录一个结果，这里按another-node失败计数，不再计入skip
+		klog.Infof("[reserveSwapTarget] 没有其他池化内存节点能容纳 pod %s, 跳过", podInfo.Name)
+		metrics.Fallbacks.WithLabelValues(common.FallbackPolicyOtherNode, metrics.ResultFailure).Inc()
+		return -1, swapActionSkip
+	case common.FallbackPolicyEvict:
+		return -1, swapActionEvict
+	}
+	metrics.Fallbacks.WithLabelValues(common.FallbackPolicySkip, metrics.ResultSuccess).Inc()
+	return -1, swapActionSkip
+}
+
+// 兜底迁移：在后台把Pod驱逐到其他k8s节点，返回0
+// 驱逐可能因为PodDisruptionBudget和等待旧Pod删除持续数分钟，不能持有d.mm.Lock()，驱逐结果由finishEviction更新账本
+func (d *DeviceMonitor) evictPod(podInfo *memory_manager.PodInfo) int {
+	klog.Infof("[evictPod] 池化内存节点容量不足, 兜底迁移 Pod: %s", podInfo.Name)
+	if d.fm == nil {
+		klog.Errorf("[evictPod] 兜底迁移器未初始化, 无法迁移 Pod %s", podInfo.Name)
+		metrics.Fallbacks.WithLabelValues(common.FallbackPolicyEvict, metrics.ResultFailure).Inc()
+		d.decision.RecordSkip(podInfo.Name)
+		return 0
+	}
+
+	d.evicting[podInfo.Name] = podInfo
+	decision := d.decision
+	d.evictWG.Add(1)
+	go func() {
+		defer d.evictWG.Done()
+		err := d.fm.MigratePodToAnotherNode(d.evictCtx, podInfo.Namespace, podInfo.Name)
+		d.finishEviction(podInfo, decision, err)
+	}()
+	return 0
+}
+
+// 驱逐结束后更新账本：成功时删除Pod绑定的块并减少块数，失败时Pod仍在本节点的DRAM上，块保持绑定
+// decision是发起驱逐的调整决策，驱逐成功后补充到该决策中
+func (d *DeviceMonitor) finishEviction(podInfo *memory_manager.PodInfo, decision *memory_manager.AdjustDecision, err error) {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+	delete(d.evicting, podInfo.Name)
+
+	metrics.Fallbacks.WithLabelValues(common.FallbackPolicyEvict, metrics.Result(err)).Inc()
+	// 没有发起驱逐，Pod的块由Pod删除事件释放
+	if errors.Is(err, fallback_migrator.ErrPodNotOnNode) {
+		klog.Warningf("[evictPod] Pod %s 不在本节点上, 未驱逐, 保留绑定块: %v", podInfo.Name, err)
+		return
+	}
+	if err != nil {
+		klog.Errorf("[evictPod] Pod %s 兜底迁移失败, 保留绑定块: %v", podInfo.Name, err)
+		d.mm.RecordPodEvent(podInfo, corev1.EventTypeWarning, memory_manager.EventMigrationFailed,
+			"Failed to evict pod after pooled memory node ran out of capacity: %v", err)
+		return
+	}
+
+	// 驱逐期间Pod可能已经删除，它释放的块如果又分配给了其他Pod则保留
+	count := 0
+	for _, blkID := range podInfo.BindColocIds {
+		meta, ok := d.mm.Uuid2ColocMetaData[blkID]
+		if !ok || (meta.Used && meta.BindPod != podInfo.Name) {
+			continue
+		}
+		delete(d.mm.Uuid2ColocMetaData, blkID)
+		delete(d.devices, blkID)
+		record := audit.Record{Event: audit.EventDeleted, Block: blkID, Pod: podInfo.Name, Tier: memory_manager.TierDRAM, Reason: reasonEvicted}
+		if decision != nil {
+			record.DecisionID = decision.ID
+		}
+		d.mm.Audit.Log(record)
+		count++
+	}
+	klog.Infof("[evictPod] Pod %s 迁移完成, 删除 %d 个绑定块", podInfo.Name, count)
+	podInfo.BindColocIds = []string{}
+	d.mm.PrevBlocks -= min(count, d.mm.PrevBlocks)
+	decision.RecordEviction(podInfo.Name, count)
+	d.mm.RecordPodEvent(podInfo, corev1.EventTypeNormal, memory_manager.EventEvicted,
+		"Evicted to another node: pooled memory node cannot fit %d blocks", count)
+	d.updateMetrics()
+	d.notifyDevices()
+}
+
+// 正在后台驱逐的Pod绑定的块数
+func (d *DeviceMonitor) evictingBlocks() int {
+	count := 0
+	for _, podInfo := range d.evicting {
+		count += len(podInfo.BindColocIds)
+	}
+	return count
+}
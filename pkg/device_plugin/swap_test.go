@@ -0,0 +1,192 @@
+package device_plugin_test
+
+import (
+	"errors"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/device_plugin"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"liuyang/colocation-memory-device-plugin/pkg/metrics"
+	"liuyang/colocation-memory-device-plugin/pkg/simulator"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// 把n个空闲块分配给Pod，Pod的驻留内存为resident字节
+func (p *testPlugin) startPod(t *testing.T, name string, n int, resident uint64) *memory_manager.PodInfo {
+	t.Helper()
+	var free []string
+	for _, block := range p.Monitor().State().Blocks {
+		if !block.Used {
+			free = append(free, block.ID)
+		}
+	}
+	if len(free) < n {
+		t.Fatalf("only %d free blocks, need %d", len(free), n)
+	}
+	pid := p.machine.AddPod(name, resident)
+	return p.mm.AddPod("default", name, free[:n], pid)
+}
+
+// 部分交换只删除实际迁移字节数覆盖的块，不足一个块的部分不交换
+func TestSwapOutPodPartial(t *testing.T) {
+	const block = common.BlockSize
+	tests := []struct {
+		name        string
+		blocks      int
+		resident    uint64
+		count       int
+		wantSwapped int
+		wantBytes   uint64
+	}{
+		{"full blocks", 4, 4 * block, 2, 2, 2 * block},
+		{"count above bound blocks", 2, 2 * block, 5, 2, 2 * block},
+		{"partial block not swapped", 4, 3*block + block/2, 4, 3, 3*block + block/2},
+		{"less than one block", 4, block / 2, 2, 0, block / 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPlugin(t)
+			podInfo := p.startPod(t, "job-1", tt.blocks, tt.resident)
+			bound := slices.Clone(podInfo.BindColocIds)
+
+			if got := p.Monitor().SwapOutPodPartial("job-1", tt.count); got != tt.wantSwapped {
+				t.Fatalf("swapped %d blocks, want %d", got, tt.wantSwapped)
+			}
+			if podInfo.SwappedBytes != tt.wantBytes {
+				t.Errorf("SwappedBytes = %d, want %d", podInfo.SwappedBytes, tt.wantBytes)
+			}
+			if !slices.Equal(podInfo.SwapColocIds, bound[:tt.wantSwapped]) || !slices.Equal(podInfo.BindColocIds, bound[tt.wantSwapped:]) {
+				t.Errorf("bound %v swapped %v, want bound %v swapped %v",
+					podInfo.BindColocIds, podInfo.SwapColocIds, bound[tt.wantSwapped:], bound[:tt.wantSwapped])
+			}
+			ledger := ledgerIDs(p)
+			for i, id := range bound {
+				if got, want := slices.Contains(ledger, id), i >= tt.wantSwapped; got != want {
+					t.Errorf("block %s in ledger = %v, want %v", id, got, want)
+				}
+			}
+			if tt.wantSwapped == 0 {
+				if podInfo.SwapNode != "" || podInfo.MigrationCount != 0 {
+					t.Errorf("got swapNode %q migrations %d, want no swap recorded", podInfo.SwapNode, podInfo.MigrationCount)
+				}
+				return
+			}
+			wantTier := memory_manager.TierMixed
+			if tt.wantSwapped == tt.blocks {
+				wantTier = memory_manager.TierCXL
+			}
+			if podInfo.SwapNode != "2" || podInfo.MigrationCount != 1 || podInfo.Tier() != wantTier {
+				t.Errorf("got swapNode %q migrations %d tier %s, want 2/1/%s", podInfo.SwapNode, podInfo.MigrationCount, podInfo.Tier(), wantTier)
+			}
+		})
+	}
+}
+
+// 池化内存节点容量不足时按兜底策略处理，每次兜底只记录一个结果
+func TestReserveSwapTarget(t *testing.T) {
+	const need = 6 * gib
+	type fallback struct{ action, result string }
+	tests := []struct {
+		name       string
+		policy     string
+		swapNode   string
+		free       map[int]uint64
+		wantNode   int
+		wantAction device_plugin.SwapAction
+		wantCount  *fallback
+	}{
+		{"preferred node fits", common.FallbackPolicySkip, "", map[int]uint64{2: 8 * gib, 3: 8 * gib},
+			2, device_plugin.SwapActionMigrate, nil},
+		{"keep the node of a partial swap", common.FallbackPolicySkip, "3", map[int]uint64{2: 8 * gib, 3: 8 * gib},
+			3, device_plugin.SwapActionMigrate, nil},
+		{"skip", common.FallbackPolicySkip, "", map[int]uint64{2: gib, 3: 8 * gib},
+			-1, device_plugin.SwapActionSkip, &fallback{common.FallbackPolicySkip, metrics.ResultSuccess}},
+		{"evict", common.FallbackPolicyEvict, "", map[int]uint64{2: gib, 3: 8 * gib},
+			-1, device_plugin.SwapActionEvict, nil},
+		{"another node", common.FallbackPolicyOtherNode, "", map[int]uint64{2: gib, 3: 8 * gib},
+			3, device_plugin.SwapActionMigrate, &fallback{common.FallbackPolicyOtherNode, metrics.ResultSuccess}},
+		{"no other node fits", common.FallbackPolicyOtherNode, "", map[int]uint64{2: gib, 3: gib},
+			-1, device_plugin.SwapActionSkip, &fallback{common.FallbackPolicyOtherNode, metrics.ResultFailure}},
+		{"partial swap cannot change node", common.FallbackPolicyOtherNode, "2", map[int]uint64{2: gib, 3: 8 * gib},
+			-1, device_plugin.SwapActionSkip, &fallback{common.FallbackPolicyOtherNode, metrics.ResultFailure}},
+	}
+	labels := []fallback{
+		{common.FallbackPolicySkip, metrics.ResultSuccess},
+		{common.FallbackPolicyOtherNode, metrics.ResultSuccess},
+		{common.FallbackPolicyOtherNode, metrics.ResultFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPluginWithUsage(t, &simulator.Event{
+				Type:       simulator.EventUsage,
+				OnlineUsed: 8 * gib,
+				NodeFree:   map[int]uint64{0: 16 * gib, 1: 16 * gib, 2: tt.free[2], 3: tt.free[3]},
+				NodeTotal:  map[int]uint64{0: 32 * gib, 1: 32 * gib, 2: 8 * gib, 3: 8 * gib},
+			})
+			p.mm.Config.FallbackPolicy = tt.policy
+			before := make(map[fallback]float64)
+			for _, l := range labels {
+				before[l] = testutil.ToFloat64(metrics.Fallbacks.WithLabelValues(l.action, l.result))
+			}
+
+			podInfo := &memory_manager.PodInfo{Name: "job-1", SwapNode: tt.swapNode}
+			node, action := p.Monitor().ReserveSwapTarget(podInfo, need)
+			if node != tt.wantNode || action != tt.wantAction {
+				t.Errorf("reserveSwapTarget = (%d, %v), want (%d, %v)", node, action, tt.wantNode, tt.wantAction)
+			}
+			for _, l := range labels {
+				want := before[l]
+				if tt.wantCount != nil && *tt.wantCount == l {
+					want++
+				}
+				if got := testutil.ToFloat64(metrics.Fallbacks.WithLabelValues(l.action, l.result)); got != want {
+					t.Errorf("fallbacks{%s,%s} = %v, want %v", l.action, l.result, got, want)
+				}
+			}
+
+			// 迁移时容量已经预留，释放前同一节点不能再容纳同样大小的迁移
+			if action != device_plugin.SwapActionMigrate {
+				return
+			}
+			if err := p.mm.ReserveNodeCapacity(node, need); !errors.Is(err, memory_manager.ErrNodeCapacityExceeded) {
+				t.Errorf("second reservation on node %d = %v, want %v", node, err, memory_manager.ErrNodeCapacityExceeded)
+			}
+			p.mm.ReleaseNodeCapacity(node, need)
+			if err := p.mm.ReserveNodeCapacity(node, need); err != nil {
+				t.Errorf("reservation after release: %v", err)
+			}
+		})
+	}
+}
+
+func blocksByState(state string) float64 {
+	return testutil.ToFloat64(metrics.BlocksByState.WithLabelValues(state))
+}
+
+// 手动交换和周期迁回后块状态指标立即更新，不等待下一次调整
+func TestSwapMetricsUpdated(t *testing.T) {
+	p := newTestPlugin(t)
+	p.mm.Config.MigrationMode = common.MigrationModeFull
+	p.startPod(t, "job-1", 4, 4*common.BlockSize)
+	total := len(ledgerIDs(p))
+
+	if _, err := p.Monitor().SwapOut("job-1"); err != nil {
+		t.Fatalf("SwapOut: %v", err)
+	}
+	if got := blocksByState(metrics.BlockStateSwapped); got != 4 {
+		t.Errorf("swapped blocks after swap-out = %v, want 4", got)
+	}
+	if got := blocksByState(metrics.BlockStateFree); got != float64(total) {
+		t.Errorf("free blocks after swap-out = %v, want %d", got, total)
+	}
+
+	p.Monitor().Reclaim()
+	if got := blocksByState(metrics.BlockStateSwapped); got != 0 {
+		t.Errorf("swapped blocks after reclaim = %v, want 0", got)
+	}
+	if got := blocksByState(metrics.BlockStateBound); got != 4 {
+		t.Errorf("bound blocks after reclaim = %v, want 4", got)
+	}
+}
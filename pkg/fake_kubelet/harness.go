@@ -0,0 +1,178 @@
+package fake_kubelet
+
+/**
+author:liuyang
+date:2025-5-28
+端到端测试的组装：假kubelet、插件和模拟的节点，按main的顺序启动和停止
+*/
+
+import (
+	"context"
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/device_plugin"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"liuyang/colocation-memory-device-plugin/pkg/simulator"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const harnessTimeout = 10 * time.Second
+
+// Harness 在临时目录中启动假kubelet和插件，插件的内存数据来自模拟的节点
+// 插件注册后以kubelet的身份连接并打开ListAndWatch
+type Harness struct {
+	Dir     string
+	Kubelet *Kubelet
+	Plugin  *device_plugin.ColocationMemoryDevicePlugin
+	Machine *simulator.Machine
+	MM      *memory_manager.MemoryManager
+	Client  *PluginClient
+
+	Registration *pluginapi.RegisterRequest // 插件最近一次的注册请求
+
+	cancel  context.CancelFunc // 停止插件的后台循环
+	watched chan struct{}      // 插件监听kubelet重启的协程退出后关闭
+}
+
+// NewHarness usage为初始的内存数据，需要包含节点0和1
+func NewHarness(config *common.Config, usage *simulator.Event) (h *Harness, err error) {
+	dir, err := os.MkdirTemp("", "coloc-plugin-")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h = &Harness{Dir: dir, cancel: cancel}
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
+
+	cfg := *config
+	cfg.DevicePluginDir = dir
+	cfg.KubeletSocket = filepath.Join(dir, "kubelet.sock")
+	cfg.AdminSocket = ""
+	cfg.AuditLogPath = ""
+
+	if h.Kubelet, err = Start(dir); err != nil {
+		return h, err
+	}
+
+	topo, err := simulator.Topology(usage)
+	if err != nil {
+		return h, err
+	}
+	h.Machine = simulator.NewMachine(topo)
+	h.Machine.ApplyUsage(usage)
+	if h.MM, err = memory_manager.NewOfflineMemoryManager(&cfg, topo, h.Machine, h.Machine); err != nil {
+		return h, err
+	}
+
+	h.Plugin = device_plugin.NewOfflineColocationMemoryDevicePlugin(h.MM)
+	if err = h.Plugin.Run(ctx); err != nil {
+		return h, fmt.Errorf("run plugin: %w", err)
+	}
+	if err = h.Plugin.Register(); err != nil {
+		return h, fmt.Errorf("register plugin: %w", err)
+	}
+	h.watched = make(chan struct{})
+	go func() {
+		defer close(h.watched)
+		if err := h.Plugin.WatchKubelet(ctx); err != nil {
+			klog.Errorf("[Harness] 监听kubelet失败: %v", err)
+		}
+	}()
+	return h, h.connect()
+}
+
+// 等待插件注册后以kubelet的身份连接，第一次ListAndWatch返回完整的设备列表
+func (h *Harness) connect() error {
+	req, err := h.Kubelet.WaitForRegistration(harnessTimeout)
+	if err != nil {
+		return err
+	}
+	h.Registration = req
+	if h.Client, err = h.Kubelet.Connect(req); err != nil {
+		return err
+	}
+	if err = h.Client.Watch(); err != nil {
+		return err
+	}
+	return h.Client.WaitForUpdates(0, harnessTimeout)
+}
+
+// RestartKubelet 模拟kubelet重启：停止注册服务，像kubelet一样删除插件socket，再重新创建kubelet.sock
+// 插件应在进程内重新注册，返回后Client为新的连接
+func (h *Harness) RestartKubelet() error {
+	h.Client.Close()
+	h.Kubelet.Stop()
+	if err := os.Remove(filepath.Join(h.Dir, common.DeviceSocket)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var err error
+	if h.Kubelet, err = Start(h.Dir); err != nil {
+		return err
+	}
+	return h.connect()
+}
+
+// SetUsage 修改节点内存数据并立即调整设备，模拟容量变化
+func (h *Harness) SetUsage(usage *simulator.Event) error {
+	h.Machine.ApplyUsage(usage)
+	return h.Plugin.Monitor().Adjust()
+}
+
+// StartPod 像kubelet一样为Pod分配n个空闲设备并启动容器，然后登记到MemoryManager
+func (h *Harness) StartPod(name string, n int) ([]string, error) {
+	var free []string
+	for _, block := range h.Plugin.Monitor().State().Blocks {
+		if !block.Used {
+			free = append(free, block.ID)
+		}
+	}
+	if len(free) < n {
+		return nil, fmt.Errorf("only %d free devices, need %d", len(free), n)
+	}
+	ids := free[:n]
+
+	resp, err := h.Client.Allocate(ids...)
+	if err != nil {
+		return nil, fmt.Errorf("allocate: %w", err)
+	}
+	if resp.Envs[common.ResourceName] == "" {
+		return nil, fmt.Errorf("allocate response has no %s env", common.ResourceName)
+	}
+	if err := h.Client.PreStartContainer(ids...); err != nil {
+		return nil, fmt.Errorf("pre-start container: %w", err)
+	}
+
+	pid := h.Machine.AddPod(name, uint64(n)*common.BlockSize)
+	h.MM.AddPod("default", name, ids, pid)
+	return ids, nil
+}
+
+// Close 按main的退出顺序停止插件，之后不应残留协程
+func (h *Harness) Close() {
+	h.cancel()
+	if h.watched != nil {
+		<-h.watched
+	}
+	if h.Client != nil {
+		h.Client.Close()
+	}
+	if h.Plugin != nil {
+		h.Plugin.Stop()
+	}
+	if h.MM != nil {
+		h.MM.Shutdown()
+	}
+	if h.Kubelet != nil {
+		h.Kubelet.Stop()
+	}
+	os.RemoveAll(h.Dir)
+}
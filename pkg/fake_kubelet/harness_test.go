@@ -0,0 +1,290 @@
+package fake_kubelet
+
+import (
+	"context"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/simulator"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	gib         = 1 << 30
+	testTimeout = 10 * time.Second
+)
+
+// 两个32GiB的DRAM节点各空闲16GiB，CXL节点2空闲64GiB
+func idleUsage() *simulator.Event {
+	return &simulator.Event{
+		Type:       simulator.EventUsage,
+		OnlineUsed: 8 * gib,
+		NodeFree:   map[int]uint64{0: 16 * gib, 1: 16 * gib, 2: 64 * gib},
+		NodeTotal:  map[int]uint64{0: 32 * gib, 1: 32 * gib, 2: 64 * gib},
+	}
+}
+
+// 在线任务内存上涨，DRAM节点各只剩8GiB
+func busyUsage() *simulator.Event {
+	return &simulator.Event{
+		Type:       simulator.EventUsage,
+		OnlineUsed: 24 * gib,
+		NodeFree:   map[int]uint64{0: 8 * gib, 1: 8 * gib},
+	}
+}
+
+func newTestConfig(t *testing.T) *common.Config {
+	t.Helper()
+	config, err := common.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	config.MigrationMode = common.MigrationModeFull
+	return config
+}
+
+func newTestHarness(t *testing.T) *Harness {
+	t.Helper()
+	h, err := NewHarness(newTestConfig(t), idleUsage())
+	if err != nil {
+		t.Fatalf("NewHarness: %v", err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// 账本中所有块的ID
+func ledgerBlockIDs(h *Harness) []string {
+	var ids []string
+	for _, block := range h.Plugin.Monitor().State().Blocks {
+		ids = append(ids, block.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestHarnessRegister(t *testing.T) {
+	h := newTestHarness(t)
+
+	req := h.Registration
+	if req.Version != pluginapi.Version {
+		t.Errorf("Version = %q, want %q", req.Version, pluginapi.Version)
+	}
+	if req.ResourceName != common.ResourceName {
+		t.Errorf("ResourceName = %q, want %q", req.ResourceName, common.ResourceName)
+	}
+	if req.Endpoint != common.DeviceSocket {
+		t.Errorf("Endpoint = %q, want %q", req.Endpoint, common.DeviceSocket)
+	}
+	if req.Options == nil || !req.Options.PreStartRequired {
+		t.Errorf("Options = %v, want PreStartRequired", req.Options)
+	}
+	if got := h.Client.ResourceName(); got != common.ResourceName {
+		t.Errorf("client ResourceName = %q, want %q", got, common.ResourceName)
+	}
+}
+
+// 连接后第一次ListAndWatch就是账本中的全部块，且都健康
+func TestHarnessInitialListAndWatch(t *testing.T) {
+	h := newTestHarness(t)
+
+	want := ledgerBlockIDs(h)
+	if len(want) == 0 {
+		t.Fatal("ledger has no blocks")
+	}
+	if got := h.Client.HealthyDeviceIDs(); !slices.Equal(got, want) {
+		t.Errorf("ListAndWatch devices = %v, want %v", got, want)
+	}
+	if got := len(h.Client.Devices()); got != len(want) {
+		t.Errorf("got %d devices, want %d all healthy", got, len(want))
+	}
+}
+
+// Allocate把设备ID写入环境变量，PreStartContainer成功，启动后块绑定到Pod
+func TestHarnessAllocateAndPreStart(t *testing.T) {
+	h := newTestHarness(t)
+	devices := h.Client.HealthyDeviceIDs()
+
+	resp, err := h.Client.Allocate(devices[:2]...)
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if got, want := resp.Envs[common.ResourceName], strings.Join(devices[:2], ","); got != want {
+		t.Errorf("env %s = %q, want %q", common.ResourceName, got, want)
+	}
+	if err := h.Client.PreStartContainer(devices[:2]...); err != nil {
+		t.Errorf("PreStartContainer: %v", err)
+	}
+
+	ids, err := h.StartPod("job-1", 3)
+	if err != nil {
+		t.Fatalf("StartPod: %v", err)
+	}
+	bound := make(map[string]string)
+	for _, block := range h.Plugin.Monitor().State().Blocks {
+		if block.Used {
+			bound[block.ID] = block.BindPod
+		}
+	}
+	if len(bound) != len(ids) {
+		t.Errorf("%d blocks bound, want %d", len(bound), len(ids))
+	}
+	for _, id := range ids {
+		if bound[id] != "job-1" {
+			t.Errorf("block %s bound to %q, want job-1", id, bound[id])
+		}
+	}
+	// 分配不改变上报的设备列表
+	if got := h.Client.HealthyDeviceIDs(); !slices.Equal(got, devices) {
+		t.Errorf("devices changed after allocation: %v, want %v", got, devices)
+	}
+}
+
+// 容量变化后kubelet收到和账本一致的新设备列表
+func TestHarnessSetUsage(t *testing.T) {
+	h := newTestHarness(t)
+	idle := len(h.Client.Devices())
+
+	if err := h.SetUsage(busyUsage()); err != nil {
+		t.Fatalf("SetUsage(busy): %v", err)
+	}
+	busy := ledgerBlockIDs(h)
+	if len(busy) >= idle {
+		t.Fatalf("ledger has %d blocks after online usage grew, want fewer than %d", len(busy), idle)
+	}
+	if err := h.Client.WaitForDeviceCount(len(busy), testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Client.HealthyDeviceIDs(); !slices.Equal(got, busy) {
+		t.Errorf("devices = %v, want %v", got, busy)
+	}
+
+	if err := h.SetUsage(idleUsage()); err != nil {
+		t.Fatalf("SetUsage(idle): %v", err)
+	}
+	if err := h.Client.WaitForDeviceCount(idle, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.Client.HealthyDeviceIDs(), ledgerBlockIDs(h); !slices.Equal(got, want) {
+		t.Errorf("devices = %v, want %v", got, want)
+	}
+}
+
+// kubelet重启后插件在进程内重新注册，新连接收到同样的设备列表，已分配的块保持绑定
+func TestHarnessRestartKubelet(t *testing.T) {
+	h := newTestHarness(t)
+	ids, err := h.StartPod("job-1", 2)
+	if err != nil {
+		t.Fatalf("StartPod: %v", err)
+	}
+	before := h.Client.HealthyDeviceIDs()
+
+	if err := h.RestartKubelet(); err != nil {
+		t.Fatalf("RestartKubelet: %v", err)
+	}
+	if got := h.Client.HealthyDeviceIDs(); !slices.Equal(got, before) {
+		t.Errorf("devices after restart = %v, want %v", got, before)
+	}
+	for _, block := range h.Plugin.Monitor().State().Blocks {
+		if slices.Contains(ids, block.ID) && block.BindPod != "job-1" {
+			t.Errorf("block %s lost its binding after restart", block.ID)
+		}
+	}
+}
+
+// 以kubelet的身份再打开一个ListAndWatch流
+func watchAgain(t *testing.T, h *Harness) *PluginClient {
+	t.Helper()
+	client, err := h.Kubelet.Connect(h.Registration)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(client.Close)
+	if err := client.Watch(); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if err := client.WaitForUpdates(0, testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// kubelet重启后旧服务上的流结束，新服务上的流不受影响
+func TestHarnessRestartEndsOldStreams(t *testing.T) {
+	h := newTestHarness(t)
+	old := watchAgain(t, h)
+
+	done := make(chan error, 1)
+	go func() { done <- h.RestartKubelet() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RestartKubelet: %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("RestartKubelet did not return with an open ListAndWatch stream")
+	}
+	if err := old.WaitForEnd(testTimeout); err != nil {
+		t.Errorf("stream on the old server: %v", err)
+	}
+
+	current := watchAgain(t, h)
+	if err := h.SetUsage(busyUsage()); err != nil {
+		t.Fatalf("SetUsage: %v", err)
+	}
+	want := len(ledgerBlockIDs(h))
+	for _, client := range []*PluginClient{h.Client, current} {
+		if err := client.WaitForDeviceCount(want, testTimeout); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// 插件停止时结束所有打开的ListAndWatch流，Stop不会等待kubelet断开
+func TestHarnessStopEndsStreams(t *testing.T) {
+	h := newTestHarness(t)
+	clients := []*PluginClient{h.Client, watchAgain(t, h), watchAgain(t, h)}
+
+	h.cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Plugin.Stop()
+	}()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("Stop did not return with open ListAndWatch streams")
+	}
+	for i, client := range clients {
+		if err := client.WaitForEnd(testTimeout); err != nil {
+			t.Errorf("stream %d: %v", i, err)
+		}
+	}
+}
+
+// 一次重启只重新注册一次：插件重建gRPC服务时删除并重新创建自己的socket，这些事件不会再触发重启
+func TestHarnessRestartRegistersOnce(t *testing.T) {
+	h := newTestHarness(t)
+	quiet := 3 * common.KubeletRestartDebounce
+
+	if err := h.RestartKubelet(); err != nil {
+		t.Fatalf("RestartKubelet: %v", err)
+	}
+	if req, err := h.Kubelet.WaitForRegistration(quiet); err == nil {
+		t.Fatalf("unexpected registration %v after kubelet restart", req.Endpoint)
+	}
+
+	if err := h.Plugin.Restart(context.Background()); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if _, err := h.Kubelet.WaitForRegistration(testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if req, err := h.Kubelet.WaitForRegistration(quiet); err == nil {
+		t.Fatalf("unexpected registration %v after plugin restart", req.Endpoint)
+	}
+}
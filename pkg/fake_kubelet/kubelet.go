@@ -0,0 +1,96 @@
+package fake_kubelet
+
+/**
+author:liuyang
+date:2025-5-28
+进程内的假kubelet：提供Registration服务，并像kubelet一样连接插件、消费ListAndWatch、调用Allocate
+用于在临时目录中端到端地验证插件的gRPC接口
+*/
+
+import (
+	"context"
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+type Kubelet struct {
+	dir    string
+	socket string
+	server *grpc.Server
+
+	registrations chan *pluginapi.RegisterRequest
+}
+
+// Start 在dir下监听kubelet.sock
+func Start(dir string) (*Kubelet, error) {
+	k := &Kubelet{
+		dir:           dir,
+		socket:        filepath.Join(dir, filepath.Base(pluginapi.KubeletSocket)),
+		server:        grpc.NewServer(),
+		registrations: make(chan *pluginapi.RegisterRequest, 16),
+	}
+	if err := os.Remove(k.socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", k.socket)
+	if err != nil {
+		return nil, fmt.Errorf("listen unix %s failed: %w", k.socket, err)
+	}
+	pluginapi.RegisterRegistrationServer(k.server, k)
+	go k.server.Serve(listener)
+	return k, nil
+}
+
+func (k *Kubelet) SocketPath() string {
+	return k.socket
+}
+
+// Register 实现pluginapi.RegistrationServer
+func (k *Kubelet) Register(_ context.Context, req *pluginapi.RegisterRequest) (*pluginapi.Empty, error) {
+	if req.Version != pluginapi.Version {
+		return nil, fmt.Errorf("unsupported device plugin API version %q", req.Version)
+	}
+	k.registrations <- req
+	return &pluginapi.Empty{}, nil
+}
+
+// WaitForRegistration 等待插件注册
+func (k *Kubelet) WaitForRegistration(timeout time.Duration) (*pluginapi.RegisterRequest, error) {
+	select {
+	case req := <-k.registrations:
+		return req, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no registration within %s", timeout)
+	}
+}
+
+// Connect 像kubelet一样连接注册请求中的插件endpoint
+func (k *Kubelet) Connect(req *pluginapi.RegisterRequest) (*PluginClient, error) {
+	socket := filepath.Join(k.dir, req.Endpoint)
+	ctx, cancel := context.WithTimeout(context.Background(), common.ConnectTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connect to plugin %s failed: %w", socket, err)
+	}
+	return newPluginClient(conn, req), nil
+}
+
+func (k *Kubelet) Stop() {
+	k.server.Stop()
+	os.Remove(k.socket)
+}
@@ -0,0 +1,31 @@
+package fake_kubelet
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// Close按main的顺序停止插件后不残留协程：后台循环、ListAndWatch、gRPC服务和监听kubelet重启的协程都已退出
+func TestHarnessCloseLeavesNoGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	config := newTestConfig(t)
+	h, err := NewHarness(config, idleUsage())
+	if err != nil {
+		t.Fatalf("NewHarness: %v", err)
+	}
+	if _, err := h.StartPod("job-1", 2); err != nil {
+		h.Close()
+		t.Fatalf("StartPod: %v", err)
+	}
+	if err := h.SetUsage(busyUsage()); err != nil {
+		h.Close()
+		t.Fatalf("SetUsage: %v", err)
+	}
+	if err := h.RestartKubelet(); err != nil {
+		h.Close()
+		t.Fatalf("RestartKubelet: %v", err)
+	}
+	h.Close()
+}
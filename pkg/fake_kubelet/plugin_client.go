@@ -0,0 +1,167 @@
+package fake_kubelet
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// PluginClient kubelet一侧的插件连接，记录ListAndWatch收到的最新设备列表
+type PluginClient struct {
+	conn     *grpc.ClientConn
+	client   pluginapi.DevicePluginClient
+	resource string
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	devices []*pluginapi.Device
+	updates int   // 收到的设备列表次数
+	err     error // ListAndWatch结束的原因
+	cancel  context.CancelFunc
+}
+
+func newPluginClient(conn *grpc.ClientConn, req *pluginapi.RegisterRequest) *PluginClient {
+	c := &PluginClient{
+		conn:     conn,
+		client:   pluginapi.NewDevicePluginClient(conn),
+		resource: req.ResourceName,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *PluginClient) ResourceName() string {
+	return c.resource
+}
+
+// Watch 打开ListAndWatch流并在后台持续接收设备列表
+func (c *PluginClient) Watch() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.client.ListAndWatch(ctx, &pluginapi.Empty{})
+	if err != nil {
+		cancel()
+		return fmt.Errorf("ListAndWatch failed: %w", err)
+	}
+	c.cancel = cancel
+
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			c.mu.Lock()
+			if err != nil {
+				c.err = err
+				c.cond.Broadcast()
+				c.mu.Unlock()
+				return
+			}
+			c.devices = resp.Devices
+			c.updates++
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Devices 最新的设备列表
+func (c *PluginClient) Devices() []*pluginapi.Device {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.devices)
+}
+
+// HealthyDeviceIDs 最新设备列表中健康设备的ID
+func (c *PluginClient) HealthyDeviceIDs() []string {
+	var ids []string
+	for _, dev := range c.Devices() {
+		if dev.Health == pluginapi.Healthy {
+			ids = append(ids, dev.ID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Updates 收到的设备列表次数
+func (c *PluginClient) Updates() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updates
+}
+
+// WaitForDevices 等待设备列表满足条件，流结束或超时返回错误
+func (c *PluginClient) WaitForDevices(cond func([]*pluginapi.Device) bool, timeout time.Duration) error {
+	return c.waitFor(func() bool { return cond(c.devices) }, timeout)
+}
+
+// WaitForDeviceCount 等待设备数量变为n
+func (c *PluginClient) WaitForDeviceCount(n int, timeout time.Duration) error {
+	return c.WaitForDevices(func(devs []*pluginapi.Device) bool { return len(devs) == n }, timeout)
+}
+
+// WaitForUpdates 等待累计收到的设备列表次数超过n
+func (c *PluginClient) WaitForUpdates(n int, timeout time.Duration) error {
+	return c.waitFor(func() bool { return c.updates > n }, timeout)
+}
+
+// WaitForEnd 等待插件结束ListAndWatch流
+func (c *PluginClient) WaitForEnd(timeout time.Duration) error {
+	return c.waitFor(func() bool { return c.err != nil }, timeout)
+}
+
+// cond在持有锁时调用
+func (c *PluginClient) waitFor(cond func() bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !cond() {
+		if c.err != nil {
+			return fmt.Errorf("ListAndWatch ended: %w", c.err)
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("device list did not reach the expected state within %s, last list has %d devices after %d updates",
+				timeout, len(c.devices), c.updates)
+		}
+		c.cond.Wait()
+	}
+	return nil
+}
+
+// Allocate 为一个容器分配设备
+func (c *PluginClient) Allocate(ids ...string) (*pluginapi.ContainerAllocateResponse, error) {
+	resp, err := c.client.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: ids}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.ContainerResponses) != 1 {
+		return nil, fmt.Errorf("expected 1 container response, got %d", len(resp.ContainerResponses))
+	}
+	return resp.ContainerResponses[0], nil
+}
+
+// PreStartContainer 和kubelet一样在容器启动前调用
+func (c *PluginClient) PreStartContainer(ids ...string) error {
+	_, err := c.client.PreStartContainer(context.Background(), &pluginapi.PreStartContainerRequest{DevicesIDs: ids})
+	return err
+}
+
+func (c *PluginClient) Close() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.conn.Close()
+}
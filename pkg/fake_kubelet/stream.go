@@ -0,0 +1,89 @@
+package fake_kubelet
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// ListAndWatchStream 不经过gRPC直接调用ListAndWatch时使用的假流
+// 记录发送的设备列表，可以取消上下文模拟kubelet断开，或者让发送失败
+type ListAndWatchStream struct {
+	grpc.ServerStream // 只实现Context和Send，其余方法不会被调用
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	responses []*pluginapi.ListAndWatchResponse
+	sendErr   error // 非空时Send返回该错误
+}
+
+var _ pluginapi.DevicePlugin_ListAndWatchServer = &ListAndWatchStream{}
+
+func NewListAndWatchStream() *ListAndWatchStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &ListAndWatchStream{ctx: ctx, cancel: cancel}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *ListAndWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *ListAndWatchStream) Send(resp *pluginapi.ListAndWatchResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	s.responses = append(s.responses, resp)
+	s.cond.Broadcast()
+	return nil
+}
+
+// Disconnect 模拟kubelet断开连接
+func (s *ListAndWatchStream) Disconnect() {
+	s.cancel()
+}
+
+// FailSends 之后的Send都返回err
+func (s *ListAndWatchStream) FailSends(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sendErr = err
+}
+
+// Responses 已发送的设备列表
+func (s *ListAndWatchStream) Responses() []*pluginapi.ListAndWatchResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pluginapi.ListAndWatchResponse(nil), s.responses...)
+}
+
+// WaitForResponses 等待至少发送n个设备列表
+func (s *ListAndWatchStream) WaitForResponses(n int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.responses) < n {
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("got %d responses within %s, want %d", len(s.responses), timeout, n)
+		}
+		s.cond.Wait()
+	}
+	return nil
+}
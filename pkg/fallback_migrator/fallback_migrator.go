@@ -2,103 +2,331 @@ package fallback_migrator
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"liuyang/colocation-memory-device-plugin/pkg/common"
-	"os"
+	"liuyang/colocation-memory-device-plugin/pkg/utils"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
-func MigratePodToAnotherNode(yamlPath string) {
+// 自动注入的ServiceAccount token卷，重建时由准入控制重新注入
+const serviceAccountVolumePrefix = "kube-api-access-"
 
+// 测试中缩短
+var (
+	deleteWaitInterval = 2 * time.Second
+	deleteWaitTimeout  = 2 * time.Minute
+
+	// 驱逐被PodDisruptionBudget阻止时的重试间隔和超时
+	evictRetryInterval = 5 * time.Second
+	evictRetryTimeout  = 2 * time.Minute
+)
+
+// ErrPodNotOnNode API Server中的Pod不在当前节点上(已被删除重建或调度到其他节点)，没有发起驱逐
+var ErrPodNotOnNode = errors.New("pod is not on this node")
+
+// 插件维护的内存层级注解描述的是Pod在当前节点上的状态，重建的Pod不继承
+var tierAnnotations = []string{
+	common.AnnotationTier,
+	common.AnnotationSwappedBlocks,
+	common.AnnotationLastMigration,
+	common.AnnotationMigrations,
+}
+
+type FallbackMigrator struct {
+	clientset     kubernetes.Interface
+	nodeName      string        // 当前节点名称，Pod不会被调度回该节点
+	taint         bool          // 驱逐时是否给节点打上临时污点
+	taintDuration time.Duration // 临时污点的持续时间
+
+	taintMu    sync.Mutex
+	taintTimer *time.Timer // 到期后移除临时污点
+}
+
+func NewFallbackMigrator(config *common.Config) (*FallbackMigrator, error) {
 	// 加载 kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", common.KubeConfigPath)
+	restConfig, err := clientcmd.BuildConfigFromFlags("", common.KubeConfigPath)
 	if err != nil {
-		klog.Error("[MigratePodToAnotherNode] ", err)
-		return
+		return nil, err
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
-		klog.Error("[MigratePodToAnotherNode] ", err)
-		return
+		return nil, err
 	}
 
-	// 读取 YAML 文件
-	data, err := os.ReadFile(yamlPath)
+	f := &FallbackMigrator{
+		clientset:     clientset,
+		nodeName:      config.NodeName,
+		taint:         config.FallbackTaint,
+		taintDuration: config.FallbackTaintDuration,
+	}
+	f.removeStaleTaint()
+	return f, nil
+}
+
+// 上次运行时进程在临时污点到期前退出，污点会一直留在节点上；启动时没有进行中的驱逐，直接移除
+func (f *FallbackMigrator) removeStaleTaint() {
+	if f.nodeName == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), common.ConnectTimeout)
+	defer cancel()
+	removed, err := f.updateNodeTaint(ctx, false)
 	if err != nil {
-		klog.Error("[MigratePodToAnotherNode] ", err)
+		klog.Errorf("[NewFallbackMigrator] remove stale taint from node %s failed: %v", f.nodeName, err)
 		return
 	}
+	if removed {
+		klog.Infof("[NewFallbackMigrator] stale taint %s removed from node %s", common.FallbackTaintKey, f.nodeName)
+	}
+}
+
+// Shutdown 停止临时污点的计时器并立即移除污点，退出后不会再有人移除它
+func (f *FallbackMigrator) Shutdown(ctx context.Context) {
+	f.taintMu.Lock()
+	defer f.taintMu.Unlock()
 
-	// 解码 YAML 到 Pod 对象
-	pod := &corev1.Pod{}
-	if err := yaml.Unmarshal(data, pod); err != nil {
-		klog.Error("[MigratePodToAnotherNode] ", err)
+	if f.taintTimer == nil {
 		return
 	}
+	f.taintTimer.Stop()
+	f.taintTimer = nil
+	if _, err := f.updateNodeTaint(ctx, false); err != nil {
+		klog.Errorf("[Shutdown] remove taint from node %s failed: %v", f.nodeName, err)
+		return
+	}
+	klog.Infof("[Shutdown] taint %s removed from node %s", common.FallbackTaintKey, f.nodeName)
+}
 
-	namespace := pod.Namespace
-	if namespace == "" {
-		namespace = "default"
+// MigratePodToAnotherNode 把Pod迁移到其他节点
+// 通过Eviction子资源驱逐Pod，遵守PodDisruptionBudget
+// 有控制器的Pod(Job、ReplicaSet、StatefulSet等)驱逐后由控制器重新调度，避免重复创建
+// 裸Pod根据API Server中的当前对象重建，并设置反亲和性禁止调度回当前节点
+// 等待PodDisruptionBudget和旧Pod删除可能需要数分钟，ctx取消后立即返回
+func (f *FallbackMigrator) MigratePodToAnotherNode(ctx context.Context, namespace, podName string) error {
+	podClient := f.clientset.CoreV1().Pods(namespace)
+
+	// 获取现有的 Pod
+	existingPod, err := podClient.Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get pod %s/%s failed: %w", namespace, podName, err)
+	}
+	if existingPod.Spec.NodeName != f.nodeName {
+		return fmt.Errorf("pod %s/%s is on node %q: %w", namespace, podName, existingPod.Spec.NodeName, ErrPodNotOnNode)
 	}
 
-	// 获取现有的同名 Pod
-	existingPod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
-	if err == nil {
-		// 如果 Pod 存在并且在 cxl-server 节点上，删除它
-		if existingPod.Spec.NodeName == "cxl-server" {
-			klog.Info("[MigratePodToAnotherNode] Existing Pod found on cxl-server, deleting it...")
+	// 临时污点防止调度器把Pod(尤其是控制器重建的Pod)放回内存紧张的节点
+	if f.taint {
+		if err := f.applyTemporaryTaint(ctx); err != nil {
+			klog.Errorf("[MigratePodToAnotherNode] apply taint to node %s failed: %v", f.nodeName, err)
+		}
+	}
 
-			err = clientset.CoreV1().Pods(namespace).Delete(context.Background(), existingPod.Name, metav1.DeleteOptions{})
-			if err != nil {
-				klog.Error("[MigratePodToAnotherNode] ", err)
-				return
-			}
+	if owner := metav1.GetControllerOf(existingPod); owner != nil {
+		klog.Infof("[MigratePodToAnotherNode] Pod %s/%s is owned by %s %s, evicting it for rescheduling", namespace, podName, owner.Kind, owner.Name)
+		return f.evictPod(ctx, namespace, podName)
+	}
 
-		} else {
-			klog.Info("[MigratePodToAnotherNode] Existing Pod found, not deleting...")
+	pod := buildReplacementPod(existingPod, f.nodeName)
+
+	klog.Infof("[MigratePodToAnotherNode] Bare pod %s/%s found on %s, evicting it...", namespace, podName, f.nodeName)
+	if err := f.evictPod(ctx, namespace, podName); err != nil {
+		return err
+	}
+
+	// 等待旧Pod删除完成，否则同名Pod无法创建
+	err = wait.PollUntilContextTimeout(ctx, deleteWaitInterval, deleteWaitTimeout, true, func(ctx context.Context) (bool, error) {
+		_, err := podClient.Get(ctx, podName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait for pod %s/%s to be deleted failed: %w", namespace, podName, err)
+	}
+
+	// 创建 Pod
+	createdPod, err := podClient.Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("create pod %s/%s failed: %w", namespace, podName, err)
+	}
+
+	klog.Infof("[MigratePodToAnotherNode] Pod %s created successfully in namespace %s", createdPod.Name, namespace)
+	return nil
+}
+
+// 通过policy/v1 Eviction子资源驱逐Pod
+// 被PodDisruptionBudget阻止时API Server返回429，此时等待后重试
+func (f *FallbackMigrator) evictPod(ctx context.Context, namespace, podName string) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: namespace,
+		},
+	}
+
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, evictRetryInterval, evictRetryTimeout, true, func(ctx context.Context) (bool, error) {
+		lastErr = f.clientset.CoreV1().Pods(namespace).EvictV1(ctx, eviction)
+		switch {
+		case lastErr == nil, apierrors.IsNotFound(lastErr):
+			return true, nil
+		case apierrors.IsTooManyRequests(lastErr):
+			klog.Infof("[evictPod] eviction of pod %s/%s blocked by PodDisruptionBudget, retrying: %v", namespace, podName, lastErr)
+			return false, nil
+		default:
+			return false, lastErr
+		}
+	})
+	if err != nil {
+		if lastErr != nil {
+			err = lastErr
+		}
+		return fmt.Errorf("evict pod %s/%s failed: %w", namespace, podName, err)
+	}
+	return nil
+}
+
+// 给节点打上临时NoSchedule污点，taintDuration后自动移除，重复调用会延长持续时间
+func (f *FallbackMigrator) applyTemporaryTaint(ctx context.Context) error {
+	f.taintMu.Lock()
+	defer f.taintMu.Unlock()
+
+	if f.taintTimer != nil && f.taintTimer.Reset(f.taintDuration) {
+		return nil
+	}
+
+	if _, err := f.updateNodeTaint(ctx, true); err != nil {
+		return err
+	}
+	klog.Infof("[applyTemporaryTaint] node %s tainted with %s for %s", f.nodeName, common.FallbackTaintKey, f.taintDuration)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(f.taintDuration, func() {
+		f.taintMu.Lock()
+		defer f.taintMu.Unlock()
+		// 已经被新的污点周期取代
+		if f.taintTimer != timer {
+			return
+		}
+		f.taintTimer = nil
+		ctx, cancel := context.WithTimeout(context.Background(), common.ConnectTimeout)
+		defer cancel()
+		if _, err := f.updateNodeTaint(ctx, false); err != nil {
+			klog.Errorf("[applyTemporaryTaint] remove taint from node %s failed: %v", f.nodeName, err)
 			return
 		}
-	} else {
-		klog.Info("[MigratePodToAnotherNode] No existing Pod found, creating a new one...")
-	}
-
-	// 设置反亲和性，禁止调度到 cxl-server
-	pod.Spec.Affinity = &corev1.Affinity{
-		NodeAffinity: &corev1.NodeAffinity{
-			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
-				NodeSelectorTerms: []corev1.NodeSelectorTerm{
-					{
-						MatchExpressions: []corev1.NodeSelectorRequirement{
-							{
-								Key:      "kubernetes.io/hostname",
-								Operator: corev1.NodeSelectorOpNotIn,
-								Values:   []string{"cxl-server"},
-							},
-						},
-					},
-				},
-			},
+		klog.Infof("[applyTemporaryTaint] taint %s removed from node %s", common.FallbackTaintKey, f.nodeName)
+	})
+	f.taintTimer = timer
+	return nil
+}
+
+// 添加或移除兜底迁移污点，返回节点的污点是否发生了变化
+func (f *FallbackMigrator) updateNodeTaint(ctx context.Context, add bool) (bool, error) {
+	return utils.PatchNodeTaint(ctx, f.clientset, f.nodeName, common.FallbackTaintKey, add)
+}
+
+// 根据API Server中的Pod对象构造新的Pod，去掉节点相关字段和状态
+func buildReplacementPod(existingPod *corev1.Pod, nodeName string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        existingPod.Name,
+			Namespace:   existingPod.Namespace,
+			Labels:      maps.Clone(existingPod.Labels),
+			Annotations: replacementAnnotations(existingPod.Annotations),
+			Finalizers:  slices.Clone(existingPod.Finalizers),
 		},
+		Spec: *existingPod.Spec.DeepCopy(),
 	}
 
-	// 清除 metadata.uid/resourceVersion 否则无法重新创建
-	pod.ResourceVersion = ""
-	pod.UID = ""
+	// 清除调度结果，由调度器重新选择节点
+	pod.Spec.NodeName = ""
 
-	// 创建 Pod
-	podClient := clientset.CoreV1().Pods(namespace)
-	createdPod, err := podClient.Create(context.Background(), pod, metav1.CreateOptions{})
-	if err != nil {
-		klog.Error("[MigratePodToAnotherNode] ", err)
-		return
+	// 去掉自动注入的ServiceAccount token卷
+	pod.Spec.Volumes = removeServiceAccountVolumes(pod.Spec.Volumes)
+	for i := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[i].VolumeMounts = removeServiceAccountMounts(pod.Spec.InitContainers[i].VolumeMounts)
 	}
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].VolumeMounts = removeServiceAccountMounts(pod.Spec.Containers[i].VolumeMounts)
+	}
+	pod.Spec.EphemeralContainers = nil
+
+	addNodeAntiAffinity(pod, nodeName)
+	return pod
+}
+
+// 复制Pod的注解，去掉插件维护的内存层级注解
+func replacementAnnotations(annotations map[string]string) map[string]string {
+	result := maps.Clone(annotations)
+	for _, key := range tierAnnotations {
+		delete(result, key)
+	}
+	return result
+}
 
-	klog.Infof("[MigratePodToAnotherNode] Pod %s created successfully in namespace %s\n", createdPod.Name, namespace)
+// 设置反亲和性，禁止调度到指定节点
+// 按节点名称(metadata.name)匹配，主机名标签不一定等于节点名称
+// NodeSelectorTerms之间是或的关系，所以需要在每个term中都加上约束
+func addNodeAntiAffinity(pod *corev1.Pod, nodeName string) {
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      metav1.ObjectNameField,
+		Operator: corev1.NodeSelectorOpNotIn,
+		Values:   []string{nodeName},
+	}
+
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	nodeAffinity := pod.Spec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	selector := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(selector.NodeSelectorTerms) == 0 {
+		selector.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for i := range selector.NodeSelectorTerms {
+		selector.NodeSelectorTerms[i].MatchFields = append(selector.NodeSelectorTerms[i].MatchFields, requirement)
+	}
+}
+
+func removeServiceAccountVolumes(volumes []corev1.Volume) []corev1.Volume {
+	var result []corev1.Volume
+	for _, v := range volumes {
+		if !strings.HasPrefix(v.Name, serviceAccountVolumePrefix) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func removeServiceAccountMounts(mounts []corev1.VolumeMount) []corev1.VolumeMount {
+	var result []corev1.VolumeMount
+	for _, m := range mounts {
+		if !strings.HasPrefix(m.Name, serviceAccountVolumePrefix) {
+			result = append(result, m)
+		}
+	}
+	return result
 }
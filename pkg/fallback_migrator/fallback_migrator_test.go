@@ -0,0 +1,360 @@
+package fallback_migrator
+
+import (
+	"context"
+	"errors"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNodeName = "node-1"
+
+func init() {
+	deleteWaitInterval = 10 * time.Millisecond
+	evictRetryInterval = 10 * time.Millisecond
+	evictRetryTimeout = 5 * time.Second
+}
+
+func newTestMigrator(taint bool, objects ...runtime.Object) (*FallbackMigrator, *fake.Clientset) {
+	objects = append(objects, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}})
+	clientset := fake.NewSimpleClientset(objects...)
+	return &FallbackMigrator{
+		clientset:     clientset,
+		nodeName:      testNodeName,
+		taint:         taint,
+		taintDuration: time.Hour,
+	}, clientset
+}
+
+func testPod(name, nodeName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       corev1.PodSpec{NodeName: nodeName},
+	}
+}
+
+func ownedPod(name string) *corev1.Pod {
+	pod := testPod(name, testNodeName)
+	controller := true
+	pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "job", UID: "uid-job", Controller: &controller}}
+	return pod
+}
+
+// 驱逐前failures次返回err，之后删除Pod，返回驱逐请求的次数
+func evictionReactor(clientset *fake.Clientset, failures int, err error) func() int {
+	var mu sync.Mutex
+	calls := 0
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= failures {
+			return true, nil, err
+		}
+		create := action.(k8stesting.CreateAction)
+		eviction := create.GetObject().(metav1.Object)
+		podsResource := corev1.SchemeGroupVersion.WithResource("pods")
+		return true, nil, clientset.Tracker().Delete(podsResource, eviction.GetNamespace(), eviction.GetName())
+	})
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+func nodeTainted(t *testing.T, clientset *fake.Clientset) bool {
+	t.Helper()
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), testNodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	return slices.ContainsFunc(node.Spec.Taints, func(taint corev1.Taint) bool {
+		return taint.Key == common.FallbackTaintKey
+	})
+}
+
+// Pod已经不在当前节点上时不驱逐，返回ErrPodNotOnNode，调用方据此保留块
+func TestMigratePodNotOnNode(t *testing.T) {
+	f, clientset := newTestMigrator(true, testPod("job-1", "node-2"))
+	calls := evictionReactor(clientset, 0, nil)
+
+	err := f.MigratePodToAnotherNode(context.Background(), "default", "job-1")
+	if !errors.Is(err, ErrPodNotOnNode) {
+		t.Fatalf("got %v, want ErrPodNotOnNode", err)
+	}
+	if calls() != 0 {
+		t.Errorf("got %d evictions, want 0", calls())
+	}
+	if nodeTainted(t, clientset) {
+		t.Errorf("node tainted although nothing was evicted")
+	}
+}
+
+// 驱逐被PodDisruptionBudget阻止(429)时重试，其它错误立即返回
+func TestEvictPodRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantErr   bool
+		wantCalls int
+	}{
+		{"success", 0, nil, false, 1},
+		{"blocked by pdb", 2, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0), false, 3},
+		{"forbidden", 1, apierrors.NewForbidden(corev1.Resource("pods"), "job-1", errors.New("denied")), true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, clientset := newTestMigrator(false, ownedPod("job-1"))
+			calls := evictionReactor(clientset, tt.failures, tt.err)
+
+			err := f.MigratePodToAnotherNode(context.Background(), "default", "job-1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls() != tt.wantCalls {
+				t.Errorf("got %d evictions, want %d", calls(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+// 一直被PodDisruptionBudget阻止时ctx取消后返回最后一次的错误
+func TestEvictPodRetryCanceled(t *testing.T) {
+	f, clientset := newTestMigrator(false, ownedPod("job-1"))
+	evictionReactor(clientset, 1<<30, apierrors.NewTooManyRequests("pdb", 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := f.MigratePodToAnotherNode(ctx, "default", "job-1")
+	if !apierrors.IsTooManyRequests(errors.Unwrap(err)) {
+		t.Errorf("got %v, want the 429 error", err)
+	}
+}
+
+// 裸Pod驱逐后等待删除完成，再在其他节点上重建
+func TestMigrateBarePod(t *testing.T) {
+	f, clientset := newTestMigrator(false, testPod("job-1", testNodeName))
+	evictionReactor(clientset, 0, nil)
+
+	if err := f.MigratePodToAnotherNode(context.Background(), "default", "job-1"); err != nil {
+		t.Fatalf("MigratePodToAnotherNode: %v", err)
+	}
+	pod, err := clientset.CoreV1().Pods("default").Get(context.Background(), "job-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("replacement pod not created: %v", err)
+	}
+	if pod.Spec.NodeName != "" || pod.Spec.Affinity == nil {
+		t.Errorf("got nodeName %q affinity %v, want an unscheduled pod with anti-affinity", pod.Spec.NodeName, pod.Spec.Affinity)
+	}
+}
+
+// 驱逐时打上临时污点，重复驱逐只延长持续时间，到期或Shutdown时移除，其它污点保持不变
+func TestTemporaryTaint(t *testing.T) {
+	other := corev1.Taint{Key: "example.com/other", Effect: corev1.TaintEffectNoSchedule}
+	f, clientset := newTestMigrator(true, ownedPod("job-1"), ownedPod("job-2"))
+	node, _ := clientset.CoreV1().Nodes().Get(context.Background(), testNodeName, metav1.GetOptions{})
+	node.Spec.Taints = []corev1.Taint{other}
+	if _, err := clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	evictionReactor(clientset, 0, nil)
+
+	for _, name := range []string{"job-1", "job-2"} {
+		if err := f.MigratePodToAnotherNode(context.Background(), "default", name); err != nil {
+			t.Fatalf("MigratePodToAnotherNode(%s): %v", name, err)
+		}
+		if !nodeTainted(t, clientset) {
+			t.Fatalf("node not tainted after evicting %s", name)
+		}
+	}
+	patches := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "patch" && action.GetResource().Resource == "nodes" {
+			patches++
+		}
+	}
+	if patches != 1 {
+		t.Errorf("got %d node patches, want 1", patches)
+	}
+
+	f.Shutdown(context.Background())
+	if nodeTainted(t, clientset) {
+		t.Errorf("taint not removed on shutdown")
+	}
+	node, _ = clientset.CoreV1().Nodes().Get(context.Background(), testNodeName, metav1.GetOptions{})
+	if !slices.ContainsFunc(node.Spec.Taints, func(taint corev1.Taint) bool { return taint.Key == other.Key }) {
+		t.Errorf("taint %s was removed", other.Key)
+	}
+}
+
+// 污点在taintDuration后自动移除；上次运行遗留的污点在启动时移除
+func TestTemporaryTaintExpires(t *testing.T) {
+	f, clientset := newTestMigrator(true)
+	f.taintDuration = 20 * time.Millisecond
+	if err := f.applyTemporaryTaint(context.Background()); err != nil {
+		t.Fatalf("applyTemporaryTaint: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for nodeTainted(t, clientset) {
+		if time.Now().After(deadline) {
+			t.Fatalf("taint not removed after %s", f.taintDuration)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := f.updateNodeTaint(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	f.removeStaleTaint()
+	if nodeTainted(t, clientset) {
+		t.Errorf("stale taint not removed")
+	}
+}
+
+// 重建的Pod复制元数据和spec，去掉节点、状态、ServiceAccount卷和内存层级注解
+func TestBuildReplacementPod(t *testing.T) {
+	existing := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "job-1",
+			Namespace:       "default",
+			UID:             "uid-1",
+			ResourceVersion: "42",
+			Labels:          map[string]string{"app": "batch"},
+			Annotations: map[string]string{
+				"example.com/keep":             "yes",
+				common.AnnotationTier:          "cxl",
+				common.AnnotationSwappedBlocks: "2",
+				common.AnnotationMigrations:    "1",
+			},
+			Finalizers: []string{"example.com/cleanup"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: testNodeName,
+			Volumes: []corev1.Volume{
+				{Name: "data"},
+				{Name: serviceAccountVolumePrefix + "abcde"},
+			},
+			InitContainers: []corev1.Container{{
+				Name:         "init",
+				VolumeMounts: []corev1.VolumeMount{{Name: serviceAccountVolumePrefix + "abcde"}},
+			}},
+			Containers: []corev1.Container{{
+				Name:         "main",
+				VolumeMounts: []corev1.VolumeMount{{Name: "data"}, {Name: serviceAccountVolumePrefix + "abcde"}},
+			}},
+			EphemeralContainers: []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug"}}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.0.0.1"},
+	}
+
+	pod := buildReplacementPod(existing, testNodeName)
+
+	if pod.Name != "job-1" || pod.Namespace != "default" || pod.Labels["app"] != "batch" {
+		t.Errorf("got metadata %+v", pod.ObjectMeta)
+	}
+	if pod.UID != "" || pod.ResourceVersion != "" {
+		t.Errorf("got uid %q resourceVersion %q, want them cleared", pod.UID, pod.ResourceVersion)
+	}
+	if !slices.Equal(pod.Finalizers, []string{"example.com/cleanup"}) {
+		t.Errorf("got finalizers %v", pod.Finalizers)
+	}
+	wantAnnotations := map[string]string{"example.com/keep": "yes"}
+	if len(pod.Annotations) != len(wantAnnotations) || pod.Annotations["example.com/keep"] != "yes" {
+		t.Errorf("got annotations %v, want %v", pod.Annotations, wantAnnotations)
+	}
+	if pod.Spec.NodeName != "" || pod.Status.Phase != "" || pod.Status.PodIP != "" {
+		t.Errorf("got nodeName %q status %+v, want them cleared", pod.Spec.NodeName, pod.Status)
+	}
+	if len(pod.Spec.Volumes) != 1 || pod.Spec.Volumes[0].Name != "data" {
+		t.Errorf("got volumes %v", pod.Spec.Volumes)
+	}
+	if len(pod.Spec.InitContainers[0].VolumeMounts) != 0 || len(pod.Spec.Containers[0].VolumeMounts) != 1 {
+		t.Errorf("service account mounts not removed: %v %v", pod.Spec.InitContainers[0].VolumeMounts, pod.Spec.Containers[0].VolumeMounts)
+	}
+	if pod.Spec.EphemeralContainers != nil {
+		t.Errorf("got ephemeral containers %v", pod.Spec.EphemeralContainers)
+	}
+
+	// 重建的Pod不和原对象共享可变字段
+	pod.Labels["app"] = "changed"
+	pod.Finalizers[0] = "changed"
+	pod.Spec.Containers[0].Name = "changed"
+	if existing.Labels["app"] != "batch" || existing.Finalizers[0] != "example.com/cleanup" || existing.Spec.Containers[0].Name != "main" {
+		t.Errorf("replacement pod shares fields with the existing pod")
+	}
+	if existing.Spec.Affinity != nil {
+		t.Errorf("existing pod affinity modified")
+	}
+}
+
+// 反亲和性按metadata.name排除当前节点，已有的每个term都加上约束，原有的表达式保留
+func TestAddNodeAntiAffinity(t *testing.T) {
+	notOnNode := corev1.NodeSelectorRequirement{
+		Key:      metav1.ObjectNameField,
+		Operator: corev1.NodeSelectorOpNotIn,
+		Values:   []string{testNodeName},
+	}
+	zoneA := corev1.NodeSelectorRequirement{Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}
+	zoneB := corev1.NodeSelectorRequirement{Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}}
+	preferred := []corev1.PreferredSchedulingTerm{{Weight: 1, Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{zoneA}}}}
+
+	tests := []struct {
+		name     string
+		affinity *corev1.Affinity
+		want     []corev1.NodeSelectorTerm
+	}{
+		{
+			name:     "no affinity",
+			affinity: nil,
+			want:     []corev1.NodeSelectorTerm{{MatchFields: []corev1.NodeSelectorRequirement{notOnNode}}},
+		},
+		{
+			name:     "preferred only",
+			affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{PreferredDuringSchedulingIgnoredDuringExecution: preferred}},
+			want:     []corev1.NodeSelectorTerm{{MatchFields: []corev1.NodeSelectorRequirement{notOnNode}}},
+		},
+		{
+			name: "existing terms",
+			affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{MatchExpressions: []corev1.NodeSelectorRequirement{zoneA}},
+					{MatchExpressions: []corev1.NodeSelectorRequirement{zoneB}},
+				}},
+			}},
+			want: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{zoneA}, MatchFields: []corev1.NodeSelectorRequirement{notOnNode}},
+				{MatchExpressions: []corev1.NodeSelectorRequirement{zoneB}, MatchFields: []corev1.NodeSelectorRequirement{notOnNode}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Affinity: tt.affinity}}
+			addNodeAntiAffinity(pod, testNodeName)
+
+			got := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got terms %+v, want %+v", got, tt.want)
+			}
+			if tt.affinity != nil && !reflect.DeepEqual(pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, tt.affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution) {
+				t.Errorf("preferred terms changed")
+			}
+		})
+	}
+}
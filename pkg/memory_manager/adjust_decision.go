@@ -0,0 +1,109 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-5-8
+adjustDevices的决策记录，供节点状态上报等外部组件使用
+*/
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AdjustDecision 一次adjustDevices的决策
+type AdjustDecision struct {
+	ID            string    `json:"id"`                      // 决策ID，关联审计日志
+	Time          time.Time `json:"time"`                    // 决策时间
+	ColocMemory   uint64    `json:"colocMemory"`             // 决策时的可用混部内存
+	PrevBlocks    int       `json:"prevBlocks"`              // 调整前的块数
+	CurrentBlocks int       `json:"currentBlocks"`           // 调整后的块数
+	AddedBlocks   int       `json:"addedBlocks,omitempty"`   // 新增的空闲块数
+	RemovedUnused int       `json:"removedUnused,omitempty"` // 删除的空闲块数
+	SwappedBlocks int       `json:"swappedBlocks,omitempty"` // 交换到池化内存的已用块数
+	SwappedPods   []string  `json:"swappedPods,omitempty"`   // 交换到池化内存的Pod
+	EvictedBlocks int       `json:"evictedBlocks,omitempty"` // 兜底驱逐删除的块数
+	EvictedPods   []string  `json:"evictedPods,omitempty"`   // 兜底驱逐的Pod
+	SkippedPods   []string  `json:"skippedPods,omitempty"`   // 池化内存容量不足或迁移失败被跳过的Pod
+}
+
+// 调整动作: add / remove / none
+func (d *AdjustDecision) Action() string {
+	switch {
+	case d.CurrentBlocks > d.PrevBlocks:
+		return "add"
+	case d.CurrentBlocks < d.PrevBlocks:
+		return "remove"
+	default:
+		return "none"
+	}
+}
+
+// DeepCopy 复制决策，兜底驱逐完成时会在锁内补充决策，锁外使用时需要复制
+func (d *AdjustDecision) DeepCopy() *AdjustDecision {
+	if d == nil {
+		return nil
+	}
+	c := *d
+	c.SwappedPods = slices.Clone(d.SwappedPods)
+	c.EvictedPods = slices.Clone(d.EvictedPods)
+	c.SkippedPods = slices.Clone(d.SkippedPods)
+	return &c
+}
+
+// 本次调整是否发生了交换或驱逐
+func (d *AdjustDecision) HasSwapOut() bool {
+	return d.SwappedBlocks > 0 || d.EvictedBlocks > 0
+}
+
+// 记录交换出去的Pod，nil时忽略(不在adjustDevices中发生的交换)
+func (d *AdjustDecision) RecordSwapOut(podName string, blocks int) {
+	if d == nil || blocks == 0 {
+		return
+	}
+	d.SwappedBlocks += blocks
+	d.SwappedPods = append(d.SwappedPods, podName)
+}
+
+// 记录兜底驱逐的Pod
+func (d *AdjustDecision) RecordEviction(podName string, blocks int) {
+	if d == nil {
+		return
+	}
+	d.EvictedBlocks += blocks
+	d.EvictedPods = append(d.EvictedPods, podName)
+}
+
+// 记录被跳过的Pod
+func (d *AdjustDecision) RecordSkip(podName string) {
+	if d == nil {
+		return
+	}
+	d.SkippedPods = append(d.SkippedPods, podName)
+}
+
+func (d *AdjustDecision) String() string {
+	parts := []string{
+		fmt.Sprintf("action=%s", d.Action()),
+		fmt.Sprintf("colocMemory=%d", d.ColocMemory),
+		fmt.Sprintf("blocks=%d->%d", d.PrevBlocks, d.CurrentBlocks),
+	}
+	if d.AddedBlocks > 0 {
+		parts = append(parts, fmt.Sprintf("added=%d", d.AddedBlocks))
+	}
+	if d.RemovedUnused > 0 {
+		parts = append(parts, fmt.Sprintf("removedUnused=%d", d.RemovedUnused))
+	}
+	if d.SwappedBlocks > 0 {
+		parts = append(parts, fmt.Sprintf("swapped=%d%v", d.SwappedBlocks, d.SwappedPods))
+	}
+	if d.EvictedBlocks > 0 {
+		parts = append(parts, fmt.Sprintf("evicted=%d%v", d.EvictedBlocks, d.EvictedPods))
+	}
+	if len(d.SkippedPods) > 0 {
+		parts = append(parts, fmt.Sprintf("skipped=%v", d.SkippedPods))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,28 @@
+package memory_manager
+
+import (
+	"slices"
+	"testing"
+)
+
+// 副本和原决策不共享Pod列表，之后补充到原决策的驱逐不影响副本
+func TestAdjustDecisionDeepCopy(t *testing.T) {
+	d := &AdjustDecision{ID: "d-1", CurrentBlocks: 4}
+	d.RecordSwapOut("job-1", 2)
+	d.RecordSkip("job-2")
+
+	c := d.DeepCopy()
+	d.RecordEviction("job-3", 1)
+	d.SwappedPods[0] = "changed"
+	d.SkippedPods = append(d.SkippedPods, "job-4")
+
+	if c.ID != "d-1" || c.CurrentBlocks != 4 || c.SwappedBlocks != 2 || c.EvictedBlocks != 0 {
+		t.Errorf("got copy %+v", c)
+	}
+	if !slices.Equal(c.SwappedPods, []string{"job-1"}) || c.EvictedPods != nil || !slices.Equal(c.SkippedPods, []string{"job-2"}) {
+		t.Errorf("copy shares pod lists with the original: %+v", c)
+	}
+	if (*AdjustDecision)(nil).DeepCopy() != nil {
+		t.Errorf("DeepCopy of nil decision is not nil")
+	}
+}
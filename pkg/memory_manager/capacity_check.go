@@ -0,0 +1,71 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-5-2
+迁移前检查目标节点容量，扣除正在进行中的迁移，避免CXL节点已满时迁移失败或页面滞留
+*/
+
+import (
+	"errors"
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+
+	"k8s.io/klog/v2"
+)
+
+var ErrNodeCapacityExceeded = errors.New("numa node capacity exceeded")
+
+// 预留目标节点的容量，成功后需要调用ReleaseNodeCapacity释放
+func (m *MemoryManager) ReserveNodeCapacity(node int, bytes uint64) error {
+	m.inflightMu.Lock()
+	defer m.inflightMu.Unlock()
+
+	info, err := m.System.NumaMemInfo(node)
+	if err != nil {
+		return err
+	}
+
+	inflight := m.inflightBytes[node]
+	if info.Free < inflight || info.Free-inflight < bytes {
+		return fmt.Errorf("%w: node %d has %d bytes free, %d bytes in flight, need %d",
+			ErrNodeCapacityExceeded, node, info.Free, inflight, bytes)
+	}
+	m.inflightBytes[node] += bytes
+	return nil
+}
+
+// 迁移结束后释放预留的容量
+func (m *MemoryManager) ReleaseNodeCapacity(node int, bytes uint64) {
+	m.inflightMu.Lock()
+	defer m.inflightMu.Unlock()
+
+	m.inflightBytes[node] -= min(bytes, m.inflightBytes[node])
+	if m.inflightBytes[node] == 0 {
+		delete(m.inflightBytes, node)
+	}
+}
+
+// 估算整Pod迁移需要的字节数：优先使用Pod在源节点上的实际驻留内存，读取失败时按绑定块数估算
+func (m *MemoryManager) EstimateSwapBytes(podName string, srcNode string) uint64 {
+	podInfo, ok := m.Pod2PodInfo[podName]
+	if !ok {
+		return 0
+	}
+	estimate := uint64(len(podInfo.BindColocIds)) * common.BlockSize
+
+	srcNodes, err := parseNodeList(srcNode)
+	if err != nil {
+		return estimate
+	}
+	var resident uint64
+	usage := m.podNumaUsage(m.podTasks(podInfo))
+	for _, id := range srcNodes {
+		resident += usage[id]
+	}
+	if resident == 0 {
+		klog.Warningf("[EstimateSwapBytes] 无法读取 pod %s 的驻留内存, 按绑定块数估算为 %d 字节", podName, estimate)
+		return estimate
+	}
+	return resident
+}
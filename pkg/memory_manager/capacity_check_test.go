@@ -0,0 +1,73 @@
+package memory_manager
+
+import (
+	"errors"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"testing"
+)
+
+// 按节点返回固定的空闲内存
+type freeMemSystem struct {
+	SystemReader
+	free map[int]uint64
+}
+
+func (s freeMemSystem) NumaMemInfo(node int) (NumaMemInfo, error) {
+	free, ok := s.free[node]
+	if !ok {
+		return NumaMemInfo{}, errors.New("no such node")
+	}
+	return NumaMemInfo{Free: free}, nil
+}
+
+// 预留扣除进行中的迁移，释放后容量恢复，释放多于预留的字节数不会下溢
+func TestReserveNodeCapacity(t *testing.T) {
+	const block = common.BlockSize
+	m := newMemoryManager(&common.Config{}, nil, nil, freeMemSystem{free: map[int]uint64{2: 4 * block}})
+
+	if err := m.ReserveNodeCapacity(2, 3*block); err != nil {
+		t.Fatalf("reserve 3 blocks: %v", err)
+	}
+	// 只剩1个块没有被预留
+	if err := m.ReserveNodeCapacity(2, 2*block); !errors.Is(err, ErrNodeCapacityExceeded) {
+		t.Errorf("reserve 2 more blocks = %v, want %v", err, ErrNodeCapacityExceeded)
+	}
+	if err := m.ReserveNodeCapacity(2, block); err != nil {
+		t.Errorf("reserve the last block: %v", err)
+	}
+	if got := m.inflightBytes[2]; got != 4*block {
+		t.Errorf("inflight = %d, want %d", got, 4*block)
+	}
+
+	m.ReleaseNodeCapacity(2, 3*block)
+	if err := m.ReserveNodeCapacity(2, 2*block); err != nil {
+		t.Errorf("reserve after release: %v", err)
+	}
+	m.ReleaseNodeCapacity(2, 10*block)
+	if _, ok := m.inflightBytes[2]; ok {
+		t.Errorf("inflight = %d after releasing everything, want no entry", m.inflightBytes[2])
+	}
+
+	// 读取节点信息失败时不预留
+	if err := m.ReserveNodeCapacity(3, block); err == nil || errors.Is(err, ErrNodeCapacityExceeded) {
+		t.Errorf("reserve on an unknown node = %v, want the read error", err)
+	}
+	if _, ok := m.inflightBytes[3]; ok {
+		t.Error("reserved capacity on an unknown node")
+	}
+}
+
+// 空闲内存少于已预留的字节数时(其他进程占用了CXL节点)，任何预留都失败
+func TestReserveNodeCapacityFreeBelowInflight(t *testing.T) {
+	const block = common.BlockSize
+	system := freeMemSystem{free: map[int]uint64{2: 4 * block}}
+	m := newMemoryManager(&common.Config{}, nil, nil, system)
+	if err := m.ReserveNodeCapacity(2, 3*block); err != nil {
+		t.Fatalf("reserve 3 blocks: %v", err)
+	}
+
+	system.free[2] = block
+	if err := m.ReserveNodeCapacity(2, 1); !errors.Is(err, ErrNodeCapacityExceeded) {
+		t.Errorf("reserve = %v, want %v", err, ErrNodeCapacityExceeded)
+	}
+}
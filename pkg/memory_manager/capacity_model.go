@@ -0,0 +1,198 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-6-5
+混部内存容量模型：从DRAM节点的MemTotal出发，依次扣除系统预留、在线任务和安全水位
+
+	系统部分 = max(节点预留, 非k8s使用量)
+	  节点预留     = 节点Capacity - Allocatable (kube-reserved + system-reserved + 驱逐阈值)
+	  非k8s使用量 = MemTotal - 可用内存 - kubepods使用量 (系统守护进程、内核等)
+	  可用内存按节点meminfo估算，可回收的页缓存和内核对象不算作已用，见EstimateAvailable
+	在线任务 = Guaranteed + Burstable + BestEffort中的非混部Pod
+	混部内存 = MemTotal - 系统部分 - 在线任务 - 安全水位
+
+混部Pod自身的使用量不扣除：已绑定Pod的块也在混部内存中
+*/
+
+import (
+	"context"
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// QoSUsage kubepods各QoS类别的内存使用量，按配置的核算方式计算(见common.MemoryAccounting*)
+// Guaranteed Pod直接位于kubepods.slice下，没有单独的slice，用总量减去另外两类得到
+type QoSUsage struct {
+	Total      uint64 // kubepods.slice
+	Burstable  uint64 // kubepods-burstable.slice
+	BestEffort uint64 // kubepods-besteffort.slice
+}
+
+func (u QoSUsage) Guaranteed() uint64 {
+	return subClamp(u.Total, u.Burstable+u.BestEffort)
+}
+
+// CapacityInput 计算容量需要的原始数据
+type CapacityInput struct {
+	Nodes         []NumaMemInfo // DRAM节点的内存信息
+	NodeReserved  uint64        // 节点Capacity - Allocatable，未知时为0
+	Pods          QoSUsage      // 各QoS类别的使用量
+	ColocPodsUsed uint64        // 混部Pod的使用量，包含在BestEffort中
+	SafetyRatio   float64       // 安全水位占MemTotal的比例
+}
+
+// CapacityBreakdown 一次容量计算的全部中间结果
+type CapacityBreakdown struct {
+	NodeTotal       uint64 `json:"nodeTotal"`       // DRAM节点MemTotal之和
+	NodeFree        uint64 `json:"nodeFree"`        // DRAM节点MemFree之和
+	NodeAvailable   uint64 `json:"nodeAvailable"`   // DRAM节点估算的可用内存之和
+	NodeReserved    uint64 `json:"nodeReserved"`    // kube-reserved + system-reserved + 驱逐阈值
+	NodeAllocatable uint64 `json:"nodeAllocatable"` // NodeTotal - NodeReserved
+
+	KubepodsUsed   uint64 `json:"kubepodsUsed"`   // 所有Pod的使用量，以下按配置的核算方式计算
+	GuaranteedUsed uint64 `json:"guaranteedUsed"` // Guaranteed Pod
+	BurstableUsed  uint64 `json:"burstableUsed"`  // Burstable Pod
+	BestEffortUsed uint64 `json:"bestEffortUsed"` // BestEffort Pod，包含混部Pod
+	ColocPodsUsed  uint64 `json:"colocPodsUsed"`  // 混部Pod
+	OnlineUsed     uint64 `json:"onlineUsed"`     // Guaranteed + Burstable + BestEffort中的非混部Pod
+
+	SystemUsed    uint64 `json:"systemUsed"`    // 非k8s使用量: NodeTotal - NodeAvailable - KubepodsUsed
+	SystemReserve uint64 `json:"systemReserve"` // max(NodeReserved, SystemUsed)
+	SafetyMargin  uint64 `json:"safetyMargin"`  // NodeTotal * 安全水位
+
+	ColocMemory uint64 `json:"colocMemory"` // NodeTotal - SystemReserve - OnlineUsed - SafetyMargin，不小于0
+}
+
+// ComputeCapacity 根据原始数据计算混部内存，不读取系统状态
+func ComputeCapacity(in CapacityInput) CapacityBreakdown {
+	var b CapacityBreakdown
+	for _, node := range in.Nodes {
+		b.NodeTotal += node.Total
+		b.NodeFree += node.Free
+		b.NodeAvailable += node.Available
+	}
+	b.NodeReserved = min(in.NodeReserved, b.NodeTotal)
+	b.NodeAllocatable = b.NodeTotal - b.NodeReserved
+
+	b.KubepodsUsed = in.Pods.Total
+	b.GuaranteedUsed = in.Pods.Guaranteed()
+	b.BurstableUsed = in.Pods.Burstable
+	b.BestEffortUsed = in.Pods.BestEffort
+	b.ColocPodsUsed = min(in.ColocPodsUsed, in.Pods.BestEffort)
+	b.OnlineUsed = b.GuaranteedUsed + b.BurstableUsed + (b.BestEffortUsed - b.ColocPodsUsed)
+
+	// 可用内存已经扣除了可回收的页缓存，kubepods按working-set核算时两者口径一致
+	// kubepods的使用量可能包含其他节点(如CXL)上的页面，这里不会小于0
+	b.SystemUsed = subClamp(b.NodeTotal-min(b.NodeAvailable, b.NodeTotal), b.KubepodsUsed)
+	b.SystemReserve = max(b.NodeReserved, b.SystemUsed)
+	b.SafetyMargin = uint64(float64(b.NodeTotal) * in.SafetyRatio)
+
+	b.ColocMemory = subClamp(b.NodeTotal, b.SystemReserve+b.OnlineUsed+b.SafetyMargin)
+	return b
+}
+
+func (b CapacityBreakdown) String() string {
+	terms := []string{
+		fmt.Sprintf("nodeTotal=%d", b.NodeTotal),
+		fmt.Sprintf("nodeFree=%d", b.NodeFree),
+		fmt.Sprintf("nodeAvailable=%d", b.NodeAvailable),
+		fmt.Sprintf("nodeReserved=%d", b.NodeReserved),
+		fmt.Sprintf("guaranteed=%d", b.GuaranteedUsed),
+		fmt.Sprintf("burstable=%d", b.BurstableUsed),
+		fmt.Sprintf("bestEffort=%d", b.BestEffortUsed),
+		fmt.Sprintf("colocPods=%d", b.ColocPodsUsed),
+		fmt.Sprintf("online=%d", b.OnlineUsed),
+		fmt.Sprintf("system=%d", b.SystemUsed),
+		fmt.Sprintf("systemReserve=%d", b.SystemReserve),
+		fmt.Sprintf("safety=%d", b.SafetyMargin),
+		fmt.Sprintf("colocMemory=%d", b.ColocMemory),
+	}
+	return strings.Join(terms, " ")
+}
+
+func subClamp(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+// 读取当前节点的数据并计算容量
+func (m *MemoryManager) computeCapacity() (CapacityBreakdown, error) {
+	in := CapacityInput{
+		NodeReserved: m.nodeReserved(),
+		SafetyRatio:  common.SafetyWatermark,
+	}
+	for _, node := range m.dramNodes() {
+		info, err := m.System.NumaMemInfo(node)
+		if err != nil {
+			return CapacityBreakdown{}, err
+		}
+		in.Nodes = append(in.Nodes, info)
+	}
+
+	pods, err := m.System.PodsUsage()
+	if err != nil {
+		return CapacityBreakdown{}, err
+	}
+	in.Pods = pods
+	in.ColocPodsUsed = m.colocPodsUsage()
+	return ComputeCapacity(in), nil
+}
+
+// DRAM节点，拓扑未知时使用节点0和1
+func (m *MemoryManager) dramNodes() []int {
+	if m.Topology != nil && len(m.Topology.DramNodes) > 0 {
+		return m.Topology.DramNodes
+	}
+	return []int{0, 1}
+}
+
+// 混部Pod在DRAM节点上的使用量：优先读取Pod的cgroup，没有cgroup时统计进程的驻留内存
+func (m *MemoryManager) colocPodsUsage() uint64 {
+	var used uint64
+	for _, podInfo := range m.Pod2PodInfo {
+		if podInfo.CgroupPath != "" {
+			if usage, err := m.System.CgroupMemoryUsage(podInfo.CgroupPath); err == nil {
+				used += usage
+				continue
+			}
+		}
+		usage := m.podNumaUsage(m.podTasks(podInfo))
+		for _, node := range m.dramNodes() {
+			used += usage[node]
+		}
+	}
+	return used
+}
+
+// 节点Capacity - Allocatable中的内存，按NodeAllocatableRefreshInterval缓存
+// 没有k8s客户端或读取失败时沿用上次的值
+func (m *MemoryManager) nodeReserved() uint64 {
+	if m.KubeClient == nil || m.Config == nil || m.Config.NodeName == "" {
+		return m.reserved
+	}
+	if !m.reservedAt.IsZero() && time.Since(m.reservedAt) < common.NodeAllocatableRefreshInterval {
+		return m.reserved
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), common.ConnectTimeout)
+	defer cancel()
+	node, err := m.KubeClient.CoreV1().Nodes().Get(ctx, m.Config.NodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Warningf("[nodeReserved] 读取节点 %s 的Allocatable失败, 沿用 %d 字节: %v", m.Config.NodeName, m.reserved, err)
+		return m.reserved
+	}
+	capacity := node.Status.Capacity.Memory().Value()
+	allocatable := node.Status.Allocatable.Memory().Value()
+	m.reserved = uint64(max(capacity-allocatable, 0))
+	m.reservedAt = time.Now()
+	klog.Infof("[nodeReserved] 节点 %s capacity=%d allocatable=%d reserved=%d", m.Config.NodeName, capacity, allocatable, m.reserved)
+	return m.reserved
+}
@@ -0,0 +1,179 @@
+package memory_manager
+
+import "testing"
+
+const gib = 1 << 30
+
+// 两个32GiB的DRAM节点，available为每个节点估算的可用内存
+func twoDramNodes(free, available uint64) []NumaMemInfo {
+	node := NumaMemInfo{Total: 32 * gib, Free: free, Available: available}
+	return []NumaMemInfo{node, node}
+}
+
+func TestComputeCapacity(t *testing.T) {
+	tests := []struct {
+		name string
+		in   CapacityInput
+		want CapacityBreakdown
+	}{
+		{
+			name: "empty",
+			in:   CapacityInput{SafetyRatio: 0.125},
+			want: CapacityBreakdown{},
+		},
+		{
+			// 非k8s使用量 = 64 - 40 - 10 = 14 < 节点预留16
+			name: "node reserved dominates",
+			in: CapacityInput{
+				Nodes:         twoDramNodes(10*gib, 20*gib),
+				NodeReserved:  16 * gib,
+				Pods:          QoSUsage{Total: 10 * gib, Burstable: 4 * gib, BestEffort: 3 * gib},
+				ColocPodsUsed: 1 * gib,
+				SafetyRatio:   0.125,
+			},
+			want: CapacityBreakdown{
+				NodeTotal: 64 * gib, NodeFree: 20 * gib, NodeAvailable: 40 * gib, NodeReserved: 16 * gib, NodeAllocatable: 48 * gib,
+				KubepodsUsed: 10 * gib, GuaranteedUsed: 3 * gib, BurstableUsed: 4 * gib, BestEffortUsed: 3 * gib, ColocPodsUsed: 1 * gib, OnlineUsed: 9 * gib,
+				SystemUsed: 14 * gib, SystemReserve: 16 * gib, SafetyMargin: 8 * gib,
+				ColocMemory: 31 * gib, // 64 - 16 - 9 - 8
+			},
+		},
+		{
+			// 系统守护进程和内核用得比预留的多
+			name: "system used dominates",
+			in: CapacityInput{
+				Nodes:         twoDramNodes(10*gib, 20*gib),
+				NodeReserved:  4 * gib,
+				Pods:          QoSUsage{Total: 10 * gib, Burstable: 4 * gib, BestEffort: 3 * gib},
+				ColocPodsUsed: 1 * gib,
+				SafetyRatio:   0.125,
+			},
+			want: CapacityBreakdown{
+				NodeTotal: 64 * gib, NodeFree: 20 * gib, NodeAvailable: 40 * gib, NodeReserved: 4 * gib, NodeAllocatable: 60 * gib,
+				KubepodsUsed: 10 * gib, GuaranteedUsed: 3 * gib, BurstableUsed: 4 * gib, BestEffortUsed: 3 * gib, ColocPodsUsed: 1 * gib, OnlineUsed: 9 * gib,
+				SystemUsed: 14 * gib, SystemReserve: 14 * gib, SafetyMargin: 8 * gib,
+				ColocMemory: 33 * gib, // 64 - 14 - 9 - 8
+			},
+		},
+		{
+			// 估算的可用内存超过MemTotal时按MemTotal计算，非k8s使用量为0
+			name: "available above total",
+			in: CapacityInput{
+				Nodes:         twoDramNodes(30*gib, 40*gib),
+				NodeReserved:  2 * gib,
+				Pods:          QoSUsage{Total: 10 * gib, Burstable: 4 * gib, BestEffort: 3 * gib},
+				ColocPodsUsed: 1 * gib,
+				SafetyRatio:   0.125,
+			},
+			want: CapacityBreakdown{
+				NodeTotal: 64 * gib, NodeFree: 60 * gib, NodeAvailable: 80 * gib, NodeReserved: 2 * gib, NodeAllocatable: 62 * gib,
+				KubepodsUsed: 10 * gib, GuaranteedUsed: 3 * gib, BurstableUsed: 4 * gib, BestEffortUsed: 3 * gib, ColocPodsUsed: 1 * gib, OnlineUsed: 9 * gib,
+				SystemUsed: 0, SystemReserve: 2 * gib, SafetyMargin: 8 * gib,
+				ColocMemory: 45 * gib, // 64 - 2 - 9 - 8
+			},
+		},
+		{
+			// kubepods包含CXL节点上的页面，超过DRAM的已用内存时非k8s使用量为0
+			name: "kubepods above dram used",
+			in: CapacityInput{
+				Nodes:       twoDramNodes(10*gib, 20*gib),
+				Pods:        QoSUsage{Total: 30 * gib, Burstable: 10 * gib, BestEffort: 5 * gib},
+				SafetyRatio: 0.125,
+			},
+			want: CapacityBreakdown{
+				NodeTotal: 64 * gib, NodeFree: 20 * gib, NodeAvailable: 40 * gib, NodeAllocatable: 64 * gib,
+				KubepodsUsed: 30 * gib, GuaranteedUsed: 15 * gib, BurstableUsed: 10 * gib, BestEffortUsed: 5 * gib, OnlineUsed: 30 * gib,
+				SystemUsed: 0, SystemReserve: 0, SafetyMargin: 8 * gib,
+				ColocMemory: 26 * gib, // 64 - 0 - 30 - 8
+			},
+		},
+		{
+			// 混部Pod的使用量和BestEffort分别读取，前者较大时按BestEffort截断，在线任务中不会出现负数
+			name: "coloc pods above best effort",
+			in: CapacityInput{
+				Nodes:         twoDramNodes(10*gib, 20*gib),
+				NodeReserved:  16 * gib,
+				Pods:          QoSUsage{Total: 10 * gib, Burstable: 4 * gib, BestEffort: 3 * gib},
+				ColocPodsUsed: 5 * gib,
+				SafetyRatio:   0.125,
+			},
+			want: CapacityBreakdown{
+				NodeTotal: 64 * gib, NodeFree: 20 * gib, NodeAvailable: 40 * gib, NodeReserved: 16 * gib, NodeAllocatable: 48 * gib,
+				KubepodsUsed: 10 * gib, GuaranteedUsed: 3 * gib, BurstableUsed: 4 * gib, BestEffortUsed: 3 * gib, ColocPodsUsed: 3 * gib, OnlineUsed: 7 * gib,
+				SystemUsed: 14 * gib, SystemReserve: 16 * gib, SafetyMargin: 8 * gib,
+				ColocMemory: 33 * gib, // 64 - 16 - 7 - 8
+			},
+		},
+		{
+			// Guaranteed = kubepods - Burstable - BestEffort，三者不是同时读取的，差值为负时为0
+			name: "guaranteed floors at zero",
+			in: CapacityInput{
+				Nodes:         twoDramNodes(10*gib, 20*gib),
+				NodeReserved:  16 * gib,
+				Pods:          QoSUsage{Total: 5 * gib, Burstable: 4 * gib, BestEffort: 3 * gib},
+				ColocPodsUsed: 1 * gib,
+				SafetyRatio:   0.125,
+			},
+			want: CapacityBreakdown{
+				NodeTotal: 64 * gib, NodeFree: 20 * gib, NodeAvailable: 40 * gib, NodeReserved: 16 * gib, NodeAllocatable: 48 * gib,
+				KubepodsUsed: 5 * gib, GuaranteedUsed: 0, BurstableUsed: 4 * gib, BestEffortUsed: 3 * gib, ColocPodsUsed: 1 * gib, OnlineUsed: 6 * gib,
+				SystemUsed: 19 * gib, SystemReserve: 19 * gib, SafetyMargin: 8 * gib,
+				ColocMemory: 31 * gib, // 64 - 19 - 6 - 8
+			},
+		},
+		{
+			// 节点预留不超过MemTotal
+			name: "reserved above total",
+			in: CapacityInput{
+				Nodes:        []NumaMemInfo{{Total: 8 * gib, Free: 4 * gib, Available: 6 * gib}},
+				NodeReserved: 16 * gib,
+				SafetyRatio:  0.125,
+			},
+			want: CapacityBreakdown{
+				NodeTotal: 8 * gib, NodeFree: 4 * gib, NodeAvailable: 6 * gib, NodeReserved: 8 * gib, NodeAllocatable: 0,
+				SystemUsed: 2 * gib, SystemReserve: 8 * gib, SafetyMargin: 1 * gib,
+				ColocMemory: 0,
+			},
+		},
+		{
+			// 扣除项之和超过MemTotal时混部内存为0而不是回绕
+			name: "zero floor",
+			in: CapacityInput{
+				Nodes:        twoDramNodes(2*gib, 4*gib),
+				NodeReserved: 10 * gib,
+				Pods:         QoSUsage{Total: 50 * gib, Burstable: 50 * gib},
+				SafetyRatio:  0.125,
+			},
+			want: CapacityBreakdown{
+				NodeTotal: 64 * gib, NodeFree: 4 * gib, NodeAvailable: 8 * gib, NodeReserved: 10 * gib, NodeAllocatable: 54 * gib,
+				KubepodsUsed: 50 * gib, BurstableUsed: 50 * gib, OnlineUsed: 50 * gib,
+				SystemUsed: 6 * gib, SystemReserve: 10 * gib, SafetyMargin: 8 * gib,
+				ColocMemory: 0, // 64 - 10 - 50 - 8 < 0
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComputeCapacity(tt.in); got != tt.want {
+				t.Errorf("ComputeCapacity() =\n  %+v\nwant\n  %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQoSUsageGuaranteed(t *testing.T) {
+	tests := []struct {
+		usage QoSUsage
+		want  uint64
+	}{
+		{QoSUsage{}, 0},
+		{QoSUsage{Total: 10, Burstable: 4, BestEffort: 3}, 3},
+		{QoSUsage{Total: 7, Burstable: 4, BestEffort: 3}, 0},
+		{QoSUsage{Total: 5, Burstable: 4, BestEffort: 3}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.usage.Guaranteed(); got != tt.want {
+			t.Errorf("%+v.Guaranteed() = %d, want %d", tt.usage, got, tt.want)
+		}
+	}
+}
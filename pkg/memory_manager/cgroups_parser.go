@@ -7,15 +7,20 @@ cgroups内存资源解析
 */
 
 import (
+	"fmt"
+	"io/fs"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
 // 由于混部任务没有申请原生资源类型，k8s会自动将Pod归类为best effort
-// 混部任务内存使用情况：/sys/fs/cgroup/kubepods.slice/kubepods-besteffort.slice/memory.current
-// 其他任务内存使用情况：/sys/fs/cgroup/kubepods.slice/kubepods-burstable.slice/memory.current
-// （这里没有保证guaranteed）
+// 混部任务内存使用情况：/sys/fs/cgroup/kubepods.slice/kubepods-besteffort.slice
+// 其他任务内存使用情况：/sys/fs/cgroup/kubepods.slice/kubepods-burstable.slice
+// guaranteed任务直接位于kubepods.slice下，用kubepods.slice的使用量减去另外两类得到
+// memory.current包含可回收的页缓存，使用量按Config.MemoryAccounting从memory.stat计算
 // 这里可以参考混部大框：https://www.bilibili.com/opus/698938934644703479
 
 func GetCgroupsMemoryInfo(cgroupPath string) (uint64, error) {
@@ -31,3 +36,133 @@ func GetCgroupsMemoryInfo(cgroupPath string) (uint64, error) {
 	}
 	return usage, nil
 }
+
+// MemoryStat cgroup v2 memory.stat中用于内存核算的字段，单位字节
+type MemoryStat struct {
+	Anon            uint64 // 匿名页，不含shmem
+	File            uint64 // 页缓存，包含shmem
+	ActiveFile      uint64 // 活跃的页缓存
+	InactiveFile    uint64 // 不活跃的页缓存，内存紧张时最先回收
+	Shmem           uint64 // tmpfs和共享内存，计入File但不能直接回收
+	SlabReclaimable uint64 // 可回收的slab(dentry、inode缓存等)
+}
+
+// 解析memory.stat，格式为每行一个 "key value"，未知字段忽略
+func ParseMemoryStat(data []byte) (MemoryStat, error) {
+	var stat MemoryStat
+	fields := map[string]*uint64{
+		"anon":             &stat.Anon,
+		"file":             &stat.File,
+		"active_file":      &stat.ActiveFile,
+		"inactive_file":    &stat.InactiveFile,
+		"shmem":            &stat.Shmem,
+		"slab_reclaimable": &stat.SlabReclaimable,
+	}
+	for line := range strings.SplitSeq(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return MemoryStat{}, fmt.Errorf("invalid memory.stat field %s=%q: %w", key, value, err)
+		}
+		*field = n
+	}
+	return stat, nil
+}
+
+// 读取cgroup目录下的memory.stat
+func GetMemoryStat(cgroupDir string) (MemoryStat, error) {
+	data, err := os.ReadFile(filepath.Join(cgroupDir, common.MemoryStatFile))
+	if err != nil {
+		return MemoryStat{}, err
+	}
+	return ParseMemoryStat(data)
+}
+
+// 按核算模式计算cgroup的内存使用量
+// working-set: memory.current - inactive_file，与kubelet驱逐使用的working set一致
+// anon:        只统计匿名页
+// current:     memory.current，包含全部页缓存
+func GetCgroupMemoryUsage(cgroupDir string, accounting string) (uint64, error) {
+	switch accounting {
+	case common.MemoryAccountingCurrent:
+		return GetCgroupsMemoryInfo(filepath.Join(cgroupDir, common.MemoryCurrentFile))
+	case common.MemoryAccountingAnon:
+		stat, err := GetMemoryStat(cgroupDir)
+		if err != nil {
+			return 0, err
+		}
+		return stat.Anon, nil
+	case common.MemoryAccountingWorkingSet:
+		current, err := GetCgroupsMemoryInfo(filepath.Join(cgroupDir, common.MemoryCurrentFile))
+		if err != nil {
+			return 0, err
+		}
+		stat, err := GetMemoryStat(cgroupDir)
+		if err != nil {
+			return 0, err
+		}
+		return WorkingSet(current, stat), nil
+	default:
+		return 0, fmt.Errorf("unknown memory accounting mode %q", accounting)
+	}
+}
+
+// memory.current减去不活跃的页缓存，不小于0
+func WorkingSet(current uint64, stat MemoryStat) uint64 {
+	if stat.InactiveFile > current {
+		return 0
+	}
+	return current - stat.InactiveFile
+}
+
+// 根据容器进程的pid获取Pod级别的cgroup目录
+// 例如容器cgroup是/sys/fs/cgroup/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-podxxx.slice/cri-containerd-xxx.scope
+// 那么Pod级别的cgroup是kubepods-besteffort-podxxx.slice
+func GetPodCgroupPath(pid int) (string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+
+	for line := range strings.SplitSeq(string(data), "\n") {
+		// cgroup v2的格式为 0::/path
+		if cgroupPath, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Dir(filepath.Join(common.CgroupRootPath, cgroupPath)), nil
+		}
+	}
+	return "", fmt.Errorf("failed to find cgroup v2 path for pid %d", pid)
+}
+
+// 获取cgroup及其子cgroup中的所有进程
+// cgroup v2中进程只存在于叶子节点，所以需要递归读取cgroup.procs
+func ListCgroupTasks(cgroupPath string) ([]int, error) {
+	var pids []int
+	err := filepath.WalkDir(cgroupPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "cgroup.procs" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for field := range strings.FieldsSeq(string(data)) {
+			pid, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("invalid pid %q in %s", field, path)
+			}
+			pids = append(pids, pid)
+		}
+		return nil
+	})
+	return pids, err
+}
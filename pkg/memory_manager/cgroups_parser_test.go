@@ -0,0 +1,196 @@
+package memory_manager
+
+import (
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testdata/cgroup是一个cgroup v2目录的样例: 1GiB匿名页、768MiB页缓存(其中512MiB不活跃)和40MiB内核内存
+const (
+	testCgroupCurrent    = 1920991232
+	testCgroupAnon       = 1 << 30
+	testCgroupWorkingSet = testCgroupCurrent - 512<<20
+)
+
+func TestParseMemoryStat(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "cgroup", common.MemoryStatFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseMemoryStat(data)
+	if err != nil {
+		t.Fatalf("ParseMemoryStat: %v", err)
+	}
+	want := MemoryStat{
+		Anon:            1 << 30,
+		File:            768 << 20,
+		ActiveFile:      128 << 20,
+		InactiveFile:    512 << 20,
+		Shmem:           128 << 20,
+		SlabReclaimable: 32 << 20,
+	}
+	if got != want {
+		t.Errorf("ParseMemoryStat() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMemoryStatLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    MemoryStat
+		wantErr string
+	}{
+		{name: "empty", data: ""},
+		{
+			// 空行、没有值的行和未知字段忽略，字段前后的空白不影响解析
+			name: "ignored lines",
+			data: "\n  anon 4096  \nfile\nunknown_field 1\n\ninactive_file 1024\r\n",
+			want: MemoryStat{Anon: 4096, InactiveFile: 1024},
+		},
+		{
+			// 同一字段出现多次时以最后一次为准
+			name: "repeated field",
+			data: "anon 1\nanon 2\n",
+			want: MemoryStat{Anon: 2},
+		},
+		{name: "invalid value", data: "anon 12k\n", wantErr: "anon"},
+		{name: "negative value", data: "inactive_file -1\n", wantErr: "inactive_file"},
+		{name: "overflow", data: "file 18446744073709551616\n", wantErr: "file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMemoryStat([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseMemoryStat() error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMemoryStat: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMemoryStat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkingSet(t *testing.T) {
+	tests := []struct {
+		current uint64
+		stat    MemoryStat
+		want    uint64
+	}{
+		{current: 0, want: 0},
+		{current: 100, stat: MemoryStat{InactiveFile: 30, ActiveFile: 50}, want: 70},
+		{current: 100, stat: MemoryStat{InactiveFile: 100}, want: 0},
+		// memory.current和memory.stat不是同时读取的，不活跃页缓存可能更大
+		{current: 100, stat: MemoryStat{InactiveFile: 150}, want: 0},
+	}
+	for _, tt := range tests {
+		if got := WorkingSet(tt.current, tt.stat); got != tt.want {
+			t.Errorf("WorkingSet(%d, %+v) = %d, want %d", tt.current, tt.stat, got, tt.want)
+		}
+	}
+}
+
+// 把testdata/cgroup中的文件复制到临时目录，skip中的文件不复制
+func newTestCgroup(t *testing.T, skip ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{common.MemoryCurrentFile, common.MemoryStatFile} {
+		if slices.Contains(skip, name) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", "cgroup", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGetCgroupMemoryUsage(t *testing.T) {
+	tests := []struct {
+		accounting string
+		want       uint64
+	}{
+		{common.MemoryAccountingWorkingSet, testCgroupWorkingSet},
+		{common.MemoryAccountingAnon, testCgroupAnon},
+		{common.MemoryAccountingCurrent, testCgroupCurrent},
+	}
+	dir := newTestCgroup(t)
+	for _, tt := range tests {
+		t.Run(tt.accounting, func(t *testing.T) {
+			got, err := GetCgroupMemoryUsage(dir, tt.accounting)
+			if err != nil {
+				t.Fatalf("GetCgroupMemoryUsage: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GetCgroupMemoryUsage(%s) = %d, want %d", tt.accounting, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := GetCgroupMemoryUsage(dir, "rss"); err == nil || !strings.Contains(err.Error(), "rss") {
+		t.Errorf("unknown accounting mode: error = %v, want one naming the mode", err)
+	}
+}
+
+// 每种核算方式只读取它需要的文件，缺少时返回读取错误
+func TestGetCgroupMemoryUsageMissingFiles(t *testing.T) {
+	tests := []struct {
+		accounting string
+		missing    string
+		wantErr    bool
+	}{
+		{common.MemoryAccountingCurrent, common.MemoryStatFile, false},
+		{common.MemoryAccountingCurrent, common.MemoryCurrentFile, true},
+		{common.MemoryAccountingAnon, common.MemoryCurrentFile, false},
+		{common.MemoryAccountingAnon, common.MemoryStatFile, true},
+		{common.MemoryAccountingWorkingSet, common.MemoryCurrentFile, true},
+		{common.MemoryAccountingWorkingSet, common.MemoryStatFile, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accounting+" without "+tt.missing, func(t *testing.T) {
+			_, err := GetCgroupMemoryUsage(newTestCgroup(t, tt.missing), tt.accounting)
+			if tt.wantErr && !os.IsNotExist(err) {
+				t.Errorf("error = %v, want not exist", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestGetCgroupsMemoryInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), common.MemoryCurrentFile)
+	for _, tt := range []struct {
+		data    string
+		want    uint64
+		wantErr bool
+	}{
+		{data: "4096\n", want: 4096},
+		{data: " 4096 ", want: 4096},
+		{data: "max\n", wantErr: true},
+		{data: "", wantErr: true},
+	} {
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := GetCgroupsMemoryInfo(path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("GetCgroupsMemoryInfo(%q) = %d, %v, want %d, error %v", tt.data, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
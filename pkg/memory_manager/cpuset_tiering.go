@@ -0,0 +1,127 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-4-24
+通过cgroup的cpuset.mems限制Pod新分配内存所在的NUMA节点
+迁移只会移动已有的页面，如果不限制cpuset.mems，Pod后续分配的内存仍会落在DRAM节点上
+*/
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const cpusetMemsFile = "cpuset.mems"
+
+// 写入cpuset.mems，测试中替换以记录写入顺序
+var writeCpusetMems = os.WriteFile
+
+// 把Pod cgroup的cpuset.mems设置为nodes，并记录原值用于恢复
+// cgroup v2下修改cpuset.mems会把不在nodes上的页面迁移过去，所以只在整Pod迁移后调用
+func (m *MemoryManager) SetPodMemoryNodes(podName string, nodes string) error {
+	podInfo, ok := m.Pod2PodInfo[podName]
+	if !ok {
+		return fmt.Errorf("pod %s not found", podName)
+	}
+	if podInfo.CgroupPath == "" {
+		return fmt.Errorf("pod %s has no cgroup path", podName)
+	}
+
+	files, err := podCpusetFiles(podInfo.CgroupPath)
+	if err != nil {
+		klog.Errorf("[SetPodMemoryNodes] 读取 pod %s 的cpuset失败: %v", podName, err)
+		return err
+	}
+
+	// 已经设置过的Pod保留最初的值
+	if podInfo.OrigCpusetMems == nil {
+		podInfo.OrigCpusetMems = files
+	}
+
+	// 先写父cgroup，子cgroup的cpuset.mems必须是父cgroup的子集
+	for _, path := range sortedByDepth(files) {
+		// 子cgroup为空表示继承父cgroup，不需要修改
+		if path != filepath.Join(podInfo.CgroupPath, cpusetMemsFile) && files[path] == "" {
+			continue
+		}
+		if err := writeCpusetMems(path, []byte(nodes), 0644); err != nil {
+			klog.Errorf("[SetPodMemoryNodes] 设置 %s 为 %s 失败: %v", path, nodes, err)
+			return err
+		}
+	}
+
+	klog.Infof("[SetPodMemoryNodes] pod %s 的cpuset.mems设置为 %s", podName, nodes)
+	return nil
+}
+
+// 恢复Pod cgroup原来的cpuset.mems
+func (m *MemoryManager) RestorePodMemoryNodes(podName string) error {
+	podInfo, ok := m.Pod2PodInfo[podName]
+	if !ok {
+		return fmt.Errorf("pod %s not found", podName)
+	}
+	if podInfo.OrigCpusetMems == nil {
+		return nil
+	}
+
+	// 先放宽父cgroup，再恢复子cgroup
+	for _, path := range sortedByDepth(podInfo.OrigCpusetMems) {
+		// 空值表示继承父cgroup，需要写入换行才能清空
+		if err := writeCpusetMems(path, []byte(podInfo.OrigCpusetMems[path]+"\n"), 0644); err != nil {
+			klog.Errorf("[RestorePodMemoryNodes] 恢复 %s 失败: %v", path, err)
+			return err
+		}
+	}
+	podInfo.OrigCpusetMems = nil
+
+	klog.Infof("[RestorePodMemoryNodes] pod %s 的cpuset.mems已恢复", podName)
+	return nil
+}
+
+// 读取Pod cgroup及其子cgroup的cpuset.mems, 返回 文件路径 -> 当前值
+func podCpusetFiles(cgroupPath string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(cgroupPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != cpusetMemsFile {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[path] = strings.TrimSpace(string(data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := files[filepath.Join(cgroupPath, cpusetMemsFile)]; !ok {
+		return nil, fmt.Errorf("cpuset controller is not enabled for %s", cgroupPath)
+	}
+	return files, nil
+}
+
+// 按目录深度从浅到深排序
+func sortedByDepth(files map[string]string) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	slices.SortFunc(paths, func(a, b string) int {
+		if c := strings.Count(a, "/") - strings.Count(b, "/"); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return paths
+}
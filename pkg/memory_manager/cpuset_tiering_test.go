@@ -0,0 +1,125 @@
+package memory_manager
+
+import (
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// 在临时目录中创建Pod的cgroup树，cpuset为 相对路径 -> cpuset.mems的内容
+func newTestCpusetTree(t *testing.T, cpuset map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for rel, mems := range cpuset {
+		path := filepath.Join(dir, rel, cpusetMemsFile)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(mems+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// 记录cpuset.mems的写入顺序(相对cgroup目录的路径)，仍然写入文件
+func recordCpusetWrites(t *testing.T, dir string) *[]string {
+	t.Helper()
+	var writes []string
+	orig := writeCpusetMems
+	writeCpusetMems = func(path string, data []byte, perm os.FileMode) error {
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writes = append(writes, rel)
+		return orig(path, data, perm)
+	}
+	t.Cleanup(func() { writeCpusetMems = orig })
+	return &writes
+}
+
+func readCpusetTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files, err := podCpusetFiles(dir)
+	if err != nil {
+		t.Fatalf("podCpusetFiles: %v", err)
+	}
+	tree := make(map[string]string)
+	for path, mems := range files {
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree[rel] = mems
+	}
+	return tree
+}
+
+// 设置时从父cgroup写到子cgroup，继承父cgroup的子cgroup不写；恢复时同样先放宽父cgroup，最后恢复子cgroup
+func TestPodMemoryNodesDepthOrder(t *testing.T) {
+	orig := map[string]string{
+		".":           "0-1",
+		"inherit":     "",
+		"app":         "0-1",
+		"app/worker":  "0",
+		"app/sidecar": "1",
+	}
+	dir := newTestCpusetTree(t, orig)
+	m := newMemoryManager(&common.Config{}, nil, nil, nil)
+	m.Pod2PodInfo["job-1"] = &PodInfo{Name: "job-1", CgroupPath: dir}
+	writes := recordCpusetWrites(t, dir)
+
+	if err := m.SetPodMemoryNodes("job-1", "2"); err != nil {
+		t.Fatalf("SetPodMemoryNodes: %v", err)
+	}
+	if want := []string{".", "app", "app/sidecar", "app/worker"}; !slices.Equal(*writes, want) {
+		t.Errorf("set wrote %v, want %v", *writes, want)
+	}
+	want := map[string]string{".": "2", "inherit": "", "app": "2", "app/worker": "2", "app/sidecar": "2"}
+	if got := readCpusetTree(t, dir); !maps.Equal(got, want) {
+		t.Errorf("cpuset after set = %v, want %v", got, want)
+	}
+
+	// 再次设置时保留最初的值
+	if err := m.SetPodMemoryNodes("job-1", "2-3"); err != nil {
+		t.Fatalf("SetPodMemoryNodes again: %v", err)
+	}
+	*writes = nil
+	if err := m.RestorePodMemoryNodes("job-1"); err != nil {
+		t.Fatalf("RestorePodMemoryNodes: %v", err)
+	}
+	if want := []string{".", "app", "inherit", "app/sidecar", "app/worker"}; !slices.Equal(*writes, want) {
+		t.Errorf("restore wrote %v, want %v", *writes, want)
+	}
+	if got := readCpusetTree(t, dir); !maps.Equal(got, orig) {
+		t.Errorf("cpuset after restore = %v, want %v", got, orig)
+	}
+	if m.Pod2PodInfo["job-1"].OrigCpusetMems != nil {
+		t.Error("OrigCpusetMems kept after restore")
+	}
+
+	// 没有设置过的Pod不需要恢复
+	*writes = nil
+	if err := m.RestorePodMemoryNodes("job-1"); err != nil || len(*writes) != 0 {
+		t.Errorf("second restore: err %v writes %v, want no writes", err, *writes)
+	}
+}
+
+// 没有启用cpuset控制器的Pod不修改任何文件，也不记录原值
+func TestSetPodMemoryNodesNoCpuset(t *testing.T) {
+	dir := newTestCpusetTree(t, map[string]string{"app": "0-1"})
+	m := newMemoryManager(&common.Config{}, nil, nil, nil)
+	m.Pod2PodInfo["job-1"] = &PodInfo{Name: "job-1", CgroupPath: dir}
+	writes := recordCpusetWrites(t, dir)
+
+	if err := m.SetPodMemoryNodes("job-1", "2"); err == nil {
+		t.Fatal("SetPodMemoryNodes succeeded without cpuset.mems in the pod cgroup")
+	}
+	if len(*writes) != 0 || m.Pod2PodInfo["job-1"].OrigCpusetMems != nil {
+		t.Errorf("writes %v orig %v, want none", *writes, m.Pod2PodInfo["job-1"].OrigCpusetMems)
+	}
+}
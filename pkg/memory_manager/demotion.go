@@ -0,0 +1,153 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-4-26
+基于内核内存分层的降级迁移：
+开启/sys/kernel/mm/numa/demotion_enabled后，对cgroup写memory.reclaim回收的冷页面会被降级到CXL节点而不是直接丢弃
+相比migrate_pages整体迁移，这种方式只迁移冷内存
+*/
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// 内核的NUMA降级开关，测试中替换为临时文件
+var demotionEnabledPath = "/sys/kernel/mm/numa/demotion_enabled"
+
+// 写入memory.reclaim，测试中替换以模拟内核回收不足时返回EAGAIN
+var writeMemoryReclaim = os.WriteFile
+
+// DemotionResult 一次降级回收的结果
+type DemotionResult struct {
+	Requested uint64 // 请求回收的字节数
+	Reclaimed uint64 // 源节点上减少的字节数
+	Demoted   uint64 // 目标节点上增加的字节数，即实际降级的字节数
+}
+
+// 检查内核是否开启了NUMA降级
+func DemotionEnabled() bool {
+	data, err := os.ReadFile(demotionEnabledPath)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(data)) == "true"
+}
+
+// 通过memory.reclaim从Pod的cgroup回收bytes字节，并统计其中有多少被降级到dstNode
+// memory.reclaim不能指定节点，内核会从Pod所在的所有节点回收，srcNode只决定Reclaimed统计哪些节点
+func (m *MemoryManager) DemotePod(podName string, srcNode string, dstNode string, bytes uint64) (*DemotionResult, error) {
+	startTime := time.Now()
+
+	podInfo, ok := m.Pod2PodInfo[podName]
+	if !ok {
+		klog.Errorf("[DemotePod] Pod %s 不存在", podName)
+		return nil, fmt.Errorf("pod %s not found", podName)
+	}
+	if podInfo.CgroupPath == "" {
+		return nil, fmt.Errorf("pod %s has no cgroup path", podName)
+	}
+	if !DemotionEnabled() {
+		return nil, fmt.Errorf("numa demotion is not enabled, check %s", demotionEnabledPath)
+	}
+
+	srcNodes, err := parseNodeList(srcNode)
+	if err != nil {
+		return nil, err
+	}
+	dstNodes, err := parseNodeList(dstNode)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := GetCgroupNumaStat(podInfo.CgroupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pids := m.podTasks(podInfo)
+	report := m.newMigrationReport(srcNode, dstNode, pids)
+	defer m.recordMigration(podInfo, report, pids)
+
+	// 内核回收不到请求的字节数时返回EAGAIN，此时按实际回收量统计
+	reclaimPath := filepath.Join(podInfo.CgroupPath, "memory.reclaim")
+	err = writeMemoryReclaim(reclaimPath, []byte(strconv.FormatUint(bytes, 10)), 0644)
+	if err != nil && !errors.Is(err, syscall.EAGAIN) {
+		klog.Errorf("[DemotePod] 写入 %s 失败: %v", reclaimPath, err)
+		m.RecordPodEvent(podInfo, corev1.EventTypeWarning, EventMigrationFailed,
+			"Failed to reclaim %d bytes for demotion to NUMA node %s: %v", bytes, dstNode, err)
+		return nil, err
+	}
+
+	after, err := GetCgroupNumaStat(podInfo.CgroupPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DemotionResult{
+		Requested: bytes,
+		Reclaimed: nodesDelta(before, after, srcNodes),
+		Demoted:   nodesDelta(after, before, dstNodes),
+	}
+	klog.Infof("[DemotePod] pod %s 请求回收 %d 字节, 节点 %s 减少 %d 字节, 降级到节点 %s %d 字节, 耗时: %s",
+		podName, result.Requested, srcNode, result.Reclaimed, dstNode, result.Demoted, time.Since(startTime))
+	return result, nil
+}
+
+// 统计nodes上from比to多出的字节数
+func nodesDelta(from, to map[int]uint64, nodes []int) uint64 {
+	var delta uint64
+	for _, id := range nodes {
+		if from[id] > to[id] {
+			delta += from[id] - to[id]
+		}
+	}
+	return delta
+}
+
+// 解析cgroup v2的memory.numa_stat, 返回每个节点上anon+file的字节数
+// 格式: anon N0=1234 N1=5678
+func GetCgroupNumaStat(cgroupPath string) (map[int]uint64, error) {
+	data, err := os.ReadFile(filepath.Join(cgroupPath, "memory.numa_stat"))
+	if err != nil {
+		return nil, err
+	}
+	return parseCgroupNumaStat(data), nil
+}
+
+// 累加anon和file两行中各节点的字节数，其他行和无法解析的字段被忽略
+func parseCgroupNumaStat(data []byte) map[int]uint64 {
+	usage := make(map[int]uint64)
+	for line := range strings.SplitSeq(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "anon" && fields[0] != "file") {
+			continue
+		}
+		for _, field := range fields[1:] {
+			node, value, ok := strings.Cut(strings.TrimPrefix(field, "N"), "=")
+			if !ok {
+				continue
+			}
+			id, err := strconv.Atoi(node)
+			if err != nil {
+				continue
+			}
+			bytes, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			usage[id] += bytes
+		}
+	}
+	return usage
+}
@@ -0,0 +1,139 @@
+package memory_manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"maps"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+const mib = 1 << 20
+
+func TestParseCgroupNumaStatFixture(t *testing.T) {
+	got := parseCgroupNumaStat(readTestdata(t, "cgroup/memory.numa_stat"))
+	// 只统计anon和file，anon_thp、shmem等子项已经包含在内
+	want := map[int]uint64{
+		0: 1024*mib + 256*mib,
+		1: 512*mib + 128*mib,
+		2: 4096,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("parseCgroupNumaStat = %v, want %v", got, want)
+	}
+}
+
+func TestParseCgroupNumaStat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[int]uint64
+	}{
+		{"empty", "", map[int]uint64{}},
+		{"anon and file summed", "anon N0=10 N1=20\nfile N0=1 N1=2\n", map[int]uint64{0: 11, 1: 22}},
+		{"other lines ignored", "anon_thp N0=10\nactive_anon N0=10\nshmem N1=5\n", map[int]uint64{}},
+		{"bad fields skipped", "anon N0=10 Nx=1 N1=abc N2 N3=-1 N4=4\n", map[int]uint64{0: 10, 4: 4}},
+		{"no value", "file\n", map[int]uint64{}},
+		{"no trailing newline", "anon N1=7", map[int]uint64{1: 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCgroupNumaStat([]byte(tt.data)); !maps.Equal(got, tt.want) {
+				t.Errorf("parseCgroupNumaStat = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 在临时目录中准备开启降级的内核开关和Pod的cgroup，reclaim模拟一次memory.reclaim写入
+func newDemotionTest(t *testing.T, stat map[int]uint64, reclaim func(stat map[int]uint64) error) *MemoryManager {
+	t.Helper()
+	dir := t.TempDir()
+	enabled := filepath.Join(dir, "demotion_enabled")
+	if err := os.WriteFile(enabled, []byte("true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cgroup := filepath.Join(dir, "pod")
+	if err := os.Mkdir(cgroup, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeNumaStat := func() {
+		data := fmt.Sprintf("anon N0=%d N1=%d N2=%d\nfile N0=0 N1=0 N2=0\n", stat[0], stat[1], stat[2])
+		if err := os.WriteFile(filepath.Join(cgroup, "memory.numa_stat"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeNumaStat()
+
+	origEnabled, origReclaim := demotionEnabledPath, writeMemoryReclaim
+	demotionEnabledPath = enabled
+	writeMemoryReclaim = func(path string, data []byte, perm os.FileMode) error {
+		if want := filepath.Join(cgroup, "memory.reclaim"); path != want {
+			t.Errorf("reclaim written to %s, want %s", path, want)
+		}
+		err := reclaim(stat)
+		writeNumaStat()
+		if err != nil {
+			return &fs.PathError{Op: "write", Path: path, Err: err}
+		}
+		return nil
+	}
+	t.Cleanup(func() { demotionEnabledPath, writeMemoryReclaim = origEnabled, origReclaim })
+
+	m := newMemoryManager(&common.Config{}, nil, nil, numaMapsSystem{})
+	m.Pod2PodInfo["job-1"] = &PodInfo{Name: "job-1", CgroupPath: cgroup, Pid: -1}
+	return m
+}
+
+// 内核回收不到请求的字节数时返回EAGAIN，按实际回收量统计；其他节点上被回收的内存不计入Reclaimed
+func TestDemotePodEAGAIN(t *testing.T) {
+	m := newDemotionTest(t, map[int]uint64{0: 4096 * mib, 1: 1024 * mib}, func(stat map[int]uint64) error {
+		stat[0] -= 512 * mib
+		stat[1] -= 128 * mib
+		stat[2] += 256 * mib
+		return syscall.EAGAIN
+	})
+
+	result, err := m.DemotePod("job-1", "0", "2", 1024*mib)
+	if err != nil {
+		t.Fatalf("DemotePod: %v", err)
+	}
+	want := DemotionResult{Requested: 1024 * mib, Reclaimed: 512 * mib, Demoted: 256 * mib}
+	if *result != want {
+		t.Errorf("DemotePod = %+v, want %+v", *result, want)
+	}
+	if m.Pod2PodInfo["job-1"].LastMigration == nil {
+		t.Error("migration report not recorded")
+	}
+}
+
+// 其他写入错误返回给调用方
+func TestDemotePodReclaimError(t *testing.T) {
+	m := newDemotionTest(t, map[int]uint64{0: 4096 * mib}, func(map[int]uint64) error {
+		return syscall.EBUSY
+	})
+
+	result, err := m.DemotePod("job-1", "0", "2", 1024*mib)
+	if !errors.Is(err, syscall.EBUSY) || result != nil {
+		t.Errorf("DemotePod = %+v, %v, want %v", result, err, syscall.EBUSY)
+	}
+}
+
+// 内核没有开启降级时不写memory.reclaim，避免直接丢弃页面
+func TestDemotePodDisabled(t *testing.T) {
+	m := newDemotionTest(t, map[int]uint64{0: 4096 * mib}, func(map[int]uint64) error {
+		t.Error("memory.reclaim written with demotion disabled")
+		return nil
+	})
+	if err := os.WriteFile(demotionEnabledPath, []byte("false\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.DemotePod("job-1", "0", "2", 1024*mib); err == nil {
+		t.Error("DemotePod succeeded with demotion disabled")
+	}
+}
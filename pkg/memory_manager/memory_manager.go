@@ -7,18 +7,24 @@ date:2025-3-19
 */
 
 // 增量式的内存管理
-// 1. 初始化读取系统内存(numa0,numa1)、k8s在线任务内存、安全水位，混部内存 = 系统内存 - k8s在线任务内存 - 安全水位
+// 1. 初始化读取系统内存(numa0,numa1)、节点预留、各QoS类别的Pod内存、安全水位，混部内存 = 系统内存 - 系统部分 - 在线任务内存 - 安全水位，见capacity_model.go
 // 2. 混部内存虚拟化分块： 混部资源 = 混部内存 / 512M，混部资源注册为colocationMemory0,colocationMemory1...
 // 3. 维护混部资源为队列，动态监测每当有混部资源增加/减少时，从队尾开始相应增减colocationMemory
 
 import (
+	"context"
 	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/audit"
 	"liuyang/colocation-memory-device-plugin/pkg/common"
 	"liuyang/colocation-memory-device-plugin/pkg/utils"
-	"path"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
 
@@ -30,14 +36,57 @@ type ColocMemoryBlockMetaData struct {
 }
 
 type PodInfo struct {
-	Name         string   // Pod名称
-	BindColocIds []string // 绑定的混部内存块ID
-	Pid          int      // 进程ID
-	SwapColocIds []string // 交换到池化内存的混部内存块ID
+	Name         string    // Pod名称
+	Namespace    string    // Pod所在的namespace
+	UID          types.UID // Pod的UID，用于发出事件
+	BindColocIds []string  // 绑定的混部内存块ID
+	Pid          int       // 进程ID
+	CgroupPath   string    // Pod级别的cgroup目录
+	SwapColocIds []string  // 交换到池化内存的混部内存块ID
+	SwappedBytes uint64    // 部分迁移模式下实际迁移到池化内存的字节数
+
+	OrigCpusetMems map[string]string // 交换出去前cgroup的cpuset.mems, 文件路径 -> 原值
+	LastMigration  *MigrationReport  // 最近一次迁移的校验结果
+	SwapNode       string            // 交换到的池化内存节点
+	MigrationCount int               // 成功交换到池化内存的次数
+}
+
+// Pod当前所在的内存层级
+const (
+	TierDRAM  = "dram"  // 全部在本地DRAM
+	TierCXL   = "cxl"   // 全部交换到池化内存
+	TierMixed = "mixed" // 部分迁移，同时使用两层内存
+)
+
+func (p *PodInfo) Tier() string {
+	switch {
+	case len(p.SwapColocIds) == 0:
+		return TierDRAM
+	case len(p.BindColocIds) == 0:
+		return TierCXL
+	default:
+		return TierMixed
+	}
 }
 
 type MemoryManager struct {
-	TotalMemory        uint64                               // 系统总内存 (NUMA0 + NUMA1)
+	Config     *common.Config       // 运行时配置
+	Topology   *NumaTopology        // NUMA拓扑
+	Migrator   PageMigrator         // 页面迁移器
+	System     SystemReader         // 读取节点和进程的内存信息
+	KubeClient kubernetes.Interface // 访问API Server，更新Pod注解等
+	Recorder   record.EventRecorder // 在Pod上发出迁移相关的事件
+	Audit      *audit.Logger        // 块生命周期审计日志
+
+	events      record.EventBroadcaster // Recorder的事件广播器，Shutdown时停止
+	annotations *annotationQueue        // 待写入的Pod注解
+
+	// 保护块账本、Pod信息和以下的内存状态
+	// Pod事件处理在修改时持有，设备监视器的调整、回收和管理接口在整个操作期间持有
+	mu sync.Mutex
+
+	Capacity           CapacityBreakdown                    // 最近一次容量计算的明细
+	TotalMemory        uint64                               // DRAM节点总内存 (NUMA0 + NUMA1)
 	OnlinePodsUsed     uint64                               // 在线任务内存使用量
 	SafetyMargin       uint64                               // 安全水位
 	ColocMemory        uint64                               // 可用混部内存
@@ -46,28 +95,126 @@ type MemoryManager struct {
 
 	Pod2PodInfo    map[string]*PodInfo // Pod名称 -> Pod信息
 	LastUpdateTime time.Time           // 上次更新时间
+	LastDecision   *AdjustDecision     // 上次调整设备的决策
 
 	PodCreateRunning       atomic.Bool // 是否正在监视Pod事件
 	PeriodicReclaimRunning atomic.Bool // 是否正在定期回收Pod事件
 
+	inflightMu    sync.Mutex     // 保护inflightBytes
+	inflightBytes map[int]uint64 // 节点 -> 正在迁移到该节点的字节数
+
+	reserved   uint64    // 节点Capacity - Allocatable中的内存
+	reservedAt time.Time // 上次读取节点Allocatable的时间
+
+	wg sync.WaitGroup // Pod事件监听和等待Pod启动的协程
 }
 
-func NewMemoryManager() *MemoryManager {
-	mm := &MemoryManager{
-		Uuid2ColocMetaData:     make(map[string]*ColocMemoryBlockMetaData),
-		Pod2PodInfo:            make(map[string]*PodInfo),
-		PodCreateRunning:       atomic.Bool{},
-		PeriodicReclaimRunning: atomic.Bool{},
+// Lock 锁定块账本和Pod信息
+func (m *MemoryManager) Lock() {
+	m.mu.Lock()
+}
+
+func (m *MemoryManager) Unlock() {
+	m.mu.Unlock()
+}
+
+// ctx取消后停止监听Pod事件，退出前调用Shutdown等待协程结束
+func NewMemoryManager(ctx context.Context, config *common.Config) *MemoryManager {
+	topo, err := GetNumaTopology()
+	if err != nil {
+		klog.Fatalf("[NewMemoryManager] 读取NUMA拓扑失败: %v", err)
+	}
+	migrator, err := NewPageMigrator(config.MigratorBackend, topo)
+	if err != nil {
+		klog.Fatalf("[NewMemoryManager] 初始化页面迁移器失败: %v", err)
 	}
-	mm.PodCreateRunning.Store(false)
-	mm.PeriodicReclaimRunning.Store(false)
-	err := mm.Initialize()
+	system, err := NewHostSystem(config.MemoryAccounting)
+	if err != nil {
+		klog.Fatalf("[NewMemoryManager] 初始化内存核算失败: %v", err)
+	}
+	mm := newMemoryManager(config, topo, migrator, system)
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		klog.Errorf("[NewMemoryManager] 初始化k8s客户端失败: %v", err)
+	} else {
+		mm.KubeClient = kubeClient
+		mm.events, mm.Recorder = newEventRecorder(kubeClient, config.NodeName)
+		mm.wg.Add(1)
+		go func() {
+			defer mm.wg.Done()
+			mm.annotations.run(kubeClient)
+		}()
+	}
+	if config.AuditLogPath != "" {
+		auditLogger, err := audit.NewLogger(config.AuditLogPath, config.AuditLogMaxSize, config.AuditLogMaxBackups)
+		if err != nil {
+			klog.Errorf("[NewMemoryManager] 初始化审计日志失败: %v", err)
+		} else {
+			mm.Audit = auditLogger
+		}
+	}
+	if config.MigrationMode == common.MigrationModeDemotion && !DemotionEnabled() {
+		klog.Warningf("[NewMemoryManager] 降级迁移模式需要开启 %s", demotionEnabledPath)
+	}
+	err = mm.Initialize()
 	if err != nil {
 		klog.Fatalf("[NewMemoryManager] 初始化内存信息失败: %v", err)
 	}
+	// 监听k8s的pod事件
+	mm.wg.Add(1)
+	go func() {
+		defer mm.wg.Done()
+		mm.WatchPods(ctx)
+	}()
 	return mm
 }
 
+// Shutdown 写完排队的Pod注解，等待Pod相关的协程退出，然后停止事件广播器并关闭审计日志
+func (m *MemoryManager) Shutdown() {
+	if m.annotations != nil {
+		m.annotations.shutdown()
+	}
+	m.wg.Wait()
+	if m.events != nil {
+		m.events.Shutdown()
+	}
+	if err := m.Audit.Close(); err != nil {
+		klog.Errorf("[Shutdown] 关闭审计日志失败: %v", err)
+	}
+}
+
+// NewOfflineMemoryManager 使用给定的拓扑、迁移器和内存数据创建MemoryManager
+// 不连接API Server，也不监听Pod事件，Pod通过AddPod和RemovePod维护，供模拟器使用
+func NewOfflineMemoryManager(config *common.Config, topo *NumaTopology, migrator PageMigrator, system SystemReader) (*MemoryManager, error) {
+	mm := newMemoryManager(config, topo, migrator, system)
+	if err := mm.Initialize(); err != nil {
+		return nil, err
+	}
+	return mm, nil
+}
+
+func newMemoryManager(config *common.Config, topo *NumaTopology, migrator PageMigrator, system SystemReader) *MemoryManager {
+	return &MemoryManager{
+		Config:             config,
+		Topology:           topo,
+		Migrator:           migrator,
+		System:             system,
+		Uuid2ColocMetaData: make(map[string]*ColocMemoryBlockMetaData),
+		Pod2PodInfo:        make(map[string]*PodInfo),
+		inflightBytes:      make(map[int]uint64),
+		annotations:        newAnnotationQueue(),
+	}
+}
+
+func newKubeClient() (kubernetes.Interface, error) {
+	// 加载 kubeconfig
+	config, err := clientcmd.BuildConfigFromFlags("", common.KubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
 // 初始化内存信息
 func (m *MemoryManager) Initialize() error {
 	m.UpdateState()
@@ -82,63 +229,27 @@ func (m *MemoryManager) Initialize() error {
 			BindPod:    "",
 			UpdateTime: time.Now(),
 		}
+		m.Audit.Log(audit.Record{Event: audit.EventCreated, Block: blockUuid, Tier: TierDRAM, Reason: "startup"})
 	}
 	// 记录上次块数
 	m.PrevBlocks = currentBlocks
 
-	// 监听k8s的pod事件
-	go m.WatchPods()
 	klog.Info("[NewMemoryManager] 初始化内存信息: ", m.Uuid2ColocMetaData)
 	return nil
 }
 
 // 更新内存状态
 func (m *MemoryManager) UpdateState() {
-
-	total, onlinePodsUsed, err := getSystemMemeoryInfo()
+	capacity, err := m.computeCapacity()
 	if err != nil {
+		klog.Errorf("[UpdateState] 计算混部内存容量失败: %v", err)
 		return
 	}
+	klog.Info("[UpdateState] ", capacity)
 
-	m.TotalMemory = total
-	m.OnlinePodsUsed = onlinePodsUsed
-	m.SafetyMargin = uint64(float64(total) * common.SafetyWatermark)
-	m.calculateColocationMemory()
-}
-
-// 重新计算混部内存
-func (m *MemoryManager) calculateColocationMemory() {
-	// 计算可用混部内存
-	available := int64(m.TotalMemory) - int64(m.OnlinePodsUsed) - int64(m.SafetyMargin)
-	if available < 0 {
-		m.ColocMemory = 0
-	} else {
-		m.ColocMemory = uint64(available)
-	}
-}
-
-// 获取合并的NUMA信息
-func getSystemMemeoryInfo() (total, k8sUsed uint64, err error) {
-	// TODO: 这里写死了NUMA0,1
-	// 获取NUMA0信息
-	node0, err := GetNumaMemInfo(0)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	// 获取NUMA1信息
-	node1, err := GetNumaMemInfo(1)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	// 合并K8s使用量
-	k8sOnlineMemoryPath := path.Join(common.K8sPodsBasePath, common.BurstablePath)
-	k8sOnlineMemoryUsage, err := GetCgroupsMemoryInfo(k8sOnlineMemoryPath)
-	if err != nil {
-		return 0, 0, err
-	}
-	klog.Info("[getSystemMemoryInfo] k8sOnlineMemoryUsage:", k8sOnlineMemoryUsage)
-
-	return node0.Free + node1.Free, k8sOnlineMemoryUsage, nil
+	m.Capacity = capacity
+	m.TotalMemory = capacity.NodeTotal
+	m.OnlinePodsUsed = capacity.OnlineUsed
+	m.SafetyMargin = capacity.SafetyMargin
+	m.ColocMemory = capacity.ColocMemory
 }
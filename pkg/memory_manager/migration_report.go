@@ -0,0 +1,283 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-4-28
+迁移结果校验：迁移前后解析/proc/<pid>/numa_maps统计Pod在各节点上的驻留内存
+同时记录/proc/vmstat中pgmigrate_success和pgmigrate_fail的增量
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// MigrationReport 一次迁移的校验结果
+type MigrationReport struct {
+	SrcNode          string         // 源节点
+	DstNode          string         // 目标节点
+	StartTime        time.Time      // 开始时间
+	Duration         time.Duration  // 迁移耗时
+	BeforeNodeBytes  map[int]uint64 // 迁移前各节点上的驻留字节数
+	AfterNodeBytes   map[int]uint64 // 迁移后各节点上的驻留字节数
+	PgmigrateSuccess uint64         // 迁移期间内核成功迁移的页面数(全局计数)
+	PgmigrateFail    uint64         // 迁移期间内核迁移失败的页面数(全局计数)
+
+	startSuccess  uint64
+	startFail     uint64
+	startCounters bool // 迁移前是否读到了内核迁移计数，没有读到时不计算增量
+}
+
+// 迁移前记录各节点驻留内存和内核迁移计数
+func (m *MemoryManager) newMigrationReport(srcNode, dstNode string, pids []int) *MigrationReport {
+	report := &MigrationReport{
+		SrcNode:         srcNode,
+		DstNode:         dstNode,
+		StartTime:       time.Now(),
+		BeforeNodeBytes: m.podNumaUsage(pids),
+	}
+	success, fail, err := GetPgmigrateCounters()
+	if err != nil {
+		klog.Warningf("[newMigrationReport] 读取内核迁移计数失败, 不统计本次迁移的pgmigrate增量: %v", err)
+		return report
+	}
+	report.startSuccess, report.startFail, report.startCounters = success, fail, true
+	return report
+}
+
+// 迁移后再次统计，得到前后对比
+func (r *MigrationReport) finish(afterNodeBytes map[int]uint64) {
+	r.Duration = time.Since(r.StartTime)
+	r.AfterNodeBytes = afterNodeBytes
+	if !r.startCounters {
+		return
+	}
+	success, fail, err := GetPgmigrateCounters()
+	if err != nil {
+		klog.Warningf("[recordMigration] 读取内核迁移计数失败, 不统计本次迁移的pgmigrate增量: %v", err)
+		return
+	}
+	// 计数只增不减，防御性地处理回绕
+	if success >= r.startSuccess && fail >= r.startFail {
+		r.PgmigrateSuccess = success - r.startSuccess
+		r.PgmigrateFail = fail - r.startFail
+	}
+}
+
+// nodes上迁移后比迁移前增加的字节数
+func (r *MigrationReport) BytesMovedTo(nodes string) uint64 {
+	ids, err := parseNodeList(nodes)
+	if err != nil {
+		return 0
+	}
+	return nodesDelta(r.AfterNodeBytes, r.BeforeNodeBytes, ids)
+}
+
+func (r *MigrationReport) String() string {
+	return fmt.Sprintf("before [%s] after [%s] pgmigrate_success=%d pgmigrate_fail=%d duration=%s",
+		formatNodeBytes(r.BeforeNodeBytes), formatNodeBytes(r.AfterNodeBytes), r.PgmigrateSuccess, r.PgmigrateFail, r.Duration)
+}
+
+func formatNodeBytes(nodeBytes map[int]uint64) string {
+	parts := make([]string, 0, len(nodeBytes))
+	for _, id := range slices.Sorted(maps.Keys(nodeBytes)) {
+		parts = append(parts, fmt.Sprintf("N%d=%d", id, nodeBytes[id]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// 获取Pod最近一次迁移的校验结果
+func (m *MemoryManager) GetMigrationReport(podName string) (*MigrationReport, bool) {
+	podInfo, ok := m.Pod2PodInfo[podName]
+	if !ok || podInfo.LastMigration == nil {
+		return nil, false
+	}
+	return podInfo.LastMigration, true
+}
+
+// 完成迁移校验并记录到PodInfo
+func (m *MemoryManager) recordMigration(podInfo *PodInfo, report *MigrationReport, pids []int) {
+	report.finish(m.podNumaUsage(pids))
+	podInfo.LastMigration = report
+	klog.Infof("[recordMigration] pod %s 从节点 %s 到节点 %s 迁移校验: %s", podInfo.Name, report.SrcNode, report.DstNode, report)
+}
+
+// 汇总一组进程在各节点上的驻留字节数，读取失败的进程(如已退出)会被跳过
+func GetPodNumaUsage(pids []int) map[int]uint64 {
+	return podNumaUsage(HostSystem, pids)
+}
+
+func (m *MemoryManager) podNumaUsage(pids []int) map[int]uint64 {
+	return podNumaUsage(m.System, pids)
+}
+
+// 私有映射按进程累加；同一个文件(共享库、共享内存)的页面在page cache中只有一份，
+// 多个进程映射时按节点取最大值，避免每个进程重复计算一次
+func podNumaUsage(system SystemReader, pids []int) map[int]uint64 {
+	usage := make(map[int]uint64)
+	files := make(map[string]map[int]uint64)
+	for _, pid := range pids {
+		procUsage, err := system.ProcessNumaUsage(pid)
+		if err != nil {
+			klog.Warningf("[GetPodNumaUsage] 读取进程 %d 的numa_maps失败: %v", pid, err)
+			continue
+		}
+		for id, bytes := range procUsage.Private {
+			usage[id] += bytes
+		}
+		for file, nodeBytes := range procUsage.Files {
+			if files[file] == nil {
+				files[file] = make(map[int]uint64)
+			}
+			for id, bytes := range nodeBytes {
+				files[file][id] = max(files[file][id], bytes)
+			}
+		}
+	}
+	for _, nodeBytes := range files {
+		for id, bytes := range nodeBytes {
+			usage[id] += bytes
+		}
+	}
+	return usage
+}
+
+// NumaMapsUsage 一个进程在各节点上的驻留字节数
+type NumaMapsUsage struct {
+	Private map[int]uint64            // 匿名映射和有私有页面的文件映射，节点 -> 字节数
+	Files   map[string]map[int]uint64 // 只有page cache页面的文件映射(包括共享内存)，文件 -> 节点 -> 字节数
+}
+
+// 读取/proc/<pid>/numa_maps, 返回进程在各节点上的驻留字节数
+func GetProcessNumaUsage(pid int) (*NumaMapsUsage, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/numa_maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseNumaMaps(f)
+}
+
+// 解析numa_maps，每行一个映射
+// 格式: 7f0000000000 default file=/usr/lib/libc.so.6 mapped=3 mapmax=5 N0=2 N1=1 kernelpagesize_kB=4
+// 带anon=的映射包含进程私有的页面，按进程累加；只有page cache页面的文件映射可能与其他进程共享，按文件记录
+func parseNumaMaps(r io.Reader) (*NumaMapsUsage, error) {
+	usage := &NumaMapsUsage{
+		Private: make(map[int]uint64),
+		Files:   make(map[string]map[int]uint64),
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry := parseNumaMapsEntry(scanner.Text())
+		if len(entry.pages) == 0 {
+			continue
+		}
+
+		nodeBytes := usage.Private
+		if entry.file != "" && !entry.anon {
+			if usage.Files[entry.file] == nil {
+				usage.Files[entry.file] = make(map[int]uint64)
+			}
+			nodeBytes = usage.Files[entry.file]
+		}
+		for id, n := range entry.pages {
+			nodeBytes[id] += n * entry.pageSize
+		}
+	}
+	return usage, scanner.Err()
+}
+
+// numa_maps中的一个映射
+type numaMapsEntry struct {
+	start    uint64         // 映射的起始地址
+	file     string         // 映射的文件，匿名映射为空
+	anon     bool           // 是否有匿名(私有)页面
+	pageSize uint64         // 页面大小
+	pages    map[int]uint64 // 节点 -> 驻留的页面数
+}
+
+// 解析numa_maps的一行，无法识别的字段被忽略
+func parseNumaMapsEntry(line string) numaMapsEntry {
+	entry := numaMapsEntry{pageSize: 4096, pages: make(map[int]uint64)}
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		entry.start, _ = strconv.ParseUint(fields[0], 16, 64)
+	}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "kernelpagesize_kB":
+			if kb, err := strconv.ParseUint(value, 10, 64); err == nil {
+				entry.pageSize = kb * 1024
+			}
+			continue
+		case key == "file":
+			entry.file = value
+			continue
+		case key == "anon":
+			entry.anon = true
+			continue
+		case len(key) < 2 || key[0] != 'N':
+			continue
+		}
+		id, err := strconv.Atoi(key[1:])
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		entry.pages[id] += n
+	}
+	return entry
+}
+
+// 读取/proc/vmstat中的pgmigrate_success和pgmigrate_fail
+func GetPgmigrateCounters() (success, fail uint64, err error) {
+	data, err := os.ReadFile("/proc/vmstat")
+	if err != nil {
+		return 0, 0, err
+	}
+	return parsePgmigrateCounters(string(data))
+}
+
+// 解析vmstat内容，每行一个"名称 值"，缺少任一计数时返回错误
+func parsePgmigrateCounters(data string) (success, fail uint64, err error) {
+	found := 0
+	for line := range strings.SplitSeq(data, "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		var counter *uint64
+		switch key {
+		case "pgmigrate_success":
+			counter = &success
+		case "pgmigrate_fail":
+			counter = &fail
+		default:
+			continue
+		}
+		if *counter, err = strconv.ParseUint(strings.TrimSpace(value), 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+		found++
+	}
+	if found != 2 {
+		return 0, 0, fmt.Errorf("pgmigrate_success or pgmigrate_fail not found in vmstat")
+	}
+	return success, fail, nil
+}
@@ -0,0 +1,128 @@
+package memory_manager
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"testing"
+)
+
+const hugePageSize = 2 << 20
+
+func parseNumaMapsFixture(t *testing.T, name string) *NumaMapsUsage {
+	t.Helper()
+	usage, err := parseNumaMaps(bytes.NewReader(readTestdata(t, name)))
+	if err != nil {
+		t.Fatalf("parseNumaMaps(%s): %v", name, err)
+	}
+	return usage
+}
+
+// 匿名映射和有anon页面的文件映射计入私有内存，只有page cache页面的文件映射按文件记录，大页按kernelpagesize_kB计算
+func TestParseNumaMapsFixture(t *testing.T) {
+	usage := parseNumaMapsFixture(t, "numa_maps_a")
+
+	wantPrivate := map[int]uint64{
+		0: (1 + 200 + 4 + 8) * testPageSize,
+		1: 56*testPageSize + 2*hugePageSize,
+		2: 1024 * testPageSize,
+	}
+	if !maps.Equal(usage.Private, wantPrivate) {
+		t.Errorf("private = %v, want %v", usage.Private, wantPrivate)
+	}
+	wantFiles := map[string]map[int]uint64{
+		"/usr/bin/worker":                     {0: 2 * testPageSize},
+		"/usr/lib/x86_64-linux-gnu/libc.so.6": {0: (37 + 190) * testPageSize},
+		"/dev/shm/cache":                      {0: 256 * testPageSize, 1: 256 * testPageSize},
+	}
+	if len(usage.Files) != len(wantFiles) {
+		t.Errorf("files = %v, want %v", usage.Files, wantFiles)
+	}
+	for file, want := range wantFiles {
+		if got := usage.Files[file]; !maps.Equal(got, want) {
+			t.Errorf("file %s = %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestParseNumaMapsEmpty(t *testing.T) {
+	usage, err := parseNumaMaps(bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage.Private) != 0 || len(usage.Files) != 0 {
+		t.Errorf("got %+v for empty numa_maps", usage)
+	}
+}
+
+// 按进程返回固定的numa_maps解析结果
+type numaMapsSystem struct {
+	SystemReader
+	usage map[int]*NumaMapsUsage
+}
+
+func (s numaMapsSystem) ProcessNumaUsage(pid int) (*NumaMapsUsage, error) {
+	usage, ok := s.usage[pid]
+	if !ok {
+		return nil, errors.New("no such process")
+	}
+	return usage, nil
+}
+
+// 私有内存按进程累加，同一个文件的页面在多个进程中只计算一次(按节点取最大值)，读取失败的进程被跳过
+func TestPodNumaUsageSharedPages(t *testing.T) {
+	system := numaMapsSystem{usage: map[int]*NumaMapsUsage{
+		100: parseNumaMapsFixture(t, "numa_maps_a"),
+		101: parseNumaMapsFixture(t, "numa_maps_b"),
+	}}
+
+	got := podNumaUsage(system, []int{100, 101, 102})
+	want := map[int]uint64{
+		// 私有213页 + worker 2页 + libc max(227,137)页 + shm max(256,128)页
+		0: (213 + 2 + 227 + 256) * testPageSize,
+		// 私有56+64页和2个大页 + shm max(256,384)页
+		1: (56+64+384)*testPageSize + 2*hugePageSize,
+		2: 1024 * testPageSize,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("podNumaUsage = %v, want %v", got, want)
+	}
+}
+
+func TestParsePgmigrateCountersFixture(t *testing.T) {
+	success, fail, err := parsePgmigrateCounters(string(readTestdata(t, "vmstat")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if success != 1048576 || fail != 17 {
+		t.Errorf("got success=%d fail=%d, want 1048576/17", success, fail)
+	}
+}
+
+func TestParsePgmigrateCountersErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"missing fail", "pgmigrate_success 10\n"},
+		{"missing success", "pgmigrate_fail 1\n"},
+		{"invalid value", "pgmigrate_success x\npgmigrate_fail 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parsePgmigrateCounters(tt.data); err == nil {
+				t.Errorf("parsePgmigrateCounters(%q) succeeded, want error", tt.data)
+			}
+		})
+	}
+}
+
+// 迁移前没有读到内核计数时不计算增量，否则增量会变成开机以来的累计值
+func TestMigrationReportWithoutStartCounters(t *testing.T) {
+	report := &MigrationReport{}
+	report.finish(nil)
+	if report.PgmigrateSuccess != 0 || report.PgmigrateFail != 0 {
+		t.Errorf("got success=%d fail=%d without start counters, want 0/0", report.PgmigrateSuccess, report.PgmigrateFail)
+	}
+}
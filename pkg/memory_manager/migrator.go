@@ -0,0 +1,121 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-4-22
+页面迁移器：把一组进程的页面从源节点迁移到目标节点
+*/
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+)
+
+// PidMigrationResult 单个进程的迁移结果
+type PidMigrationResult struct {
+	Pid      int           // 进程ID
+	NotMoved int           // 未能迁移的页面数
+	Errno    syscall.Errno // 系统调用错误码，0表示成功
+	Err      error         // 其他错误(如外部命令执行失败)
+}
+
+func (r PidMigrationResult) Failed() bool {
+	return r.Errno != 0 || r.Err != nil
+}
+
+// MigrationResult 一次迁移中所有进程的结果
+type MigrationResult struct {
+	Pids []PidMigrationResult
+}
+
+// 未迁移的页面总数
+func (r *MigrationResult) NotMoved() int {
+	total := 0
+	for _, p := range r.Pids {
+		total += p.NotMoved
+	}
+	return total
+}
+
+// 迁移失败的进程
+func (r *MigrationResult) Failed() []PidMigrationResult {
+	var failed []PidMigrationResult
+	for _, p := range r.Pids {
+		if p.Failed() {
+			failed = append(failed, p)
+		}
+	}
+	return failed
+}
+
+func (r *MigrationResult) String() string {
+	parts := make([]string, 0, len(r.Pids))
+	for _, p := range r.Pids {
+		switch {
+		case p.Errno != 0:
+			parts = append(parts, fmt.Sprintf("%d:errno=%d(%v)", p.Pid, int(p.Errno), p.Errno))
+		case p.Err != nil:
+			parts = append(parts, fmt.Sprintf("%d:%v", p.Pid, p.Err))
+		default:
+			parts = append(parts, fmt.Sprintf("%d:not_moved=%d", p.Pid, p.NotMoved))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// PageMigrator 把进程的页面从srcNodes迁移到dstNodes
+type PageMigrator interface {
+	MigratePages(pids []int, srcNodes, dstNodes []int) *MigrationResult
+	// MovePages 按字节数迁移单个进程的页面，用于部分迁移模式，返回实际迁移的字节数
+	MovePages(pid int, srcNodes, dstNodes []int, budget uint64) (uint64, error)
+}
+
+// 根据配置创建页面迁移器
+func NewPageMigrator(backend string, topo *NumaTopology) (PageMigrator, error) {
+	switch backend {
+	case common.MigratorBackendSyscall:
+		return NewSyscallMigrator(topo), nil
+	case common.MigratorBackendMigratepages:
+		return &execMigrator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown migrator backend %q", backend)
+	}
+}
+
+// execMigrator 调用numactl的migratepages命令，需要镜像中安装numactl
+type execMigrator struct{}
+
+func (e *execMigrator) MigratePages(pids []int, srcNodes, dstNodes []int) *MigrationResult {
+	result := &MigrationResult{}
+	for _, pid := range pids {
+		cmd := exec.Command("migratepages", strconv.Itoa(pid), formatNodeList(srcNodes), formatNodeList(dstNodes))
+		r := PidMigrationResult{Pid: pid}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			r.Err = fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+		result.Pids = append(result.Pids, r)
+	}
+	return result
+}
+
+// migratepages命令不支持按字节数迁移，部分迁移统一使用move_pages(2)
+func (e *execMigrator) MovePages(pid int, srcNodes, dstNodes []int, budget uint64) (uint64, error) {
+	return movePagesByBytes(pid, srcNodes, dstNodes, budget)
+}
+
+func (s *SyscallMigrator) MovePages(pid int, srcNodes, dstNodes []int, budget uint64) (uint64, error) {
+	return movePagesByBytes(pid, srcNodes, dstNodes, budget)
+}
+
+func formatNodeList(nodes []int) string {
+	ids := make([]string, 0, len(nodes))
+	for _, id := range nodes {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return strings.Join(ids, ",")
+}
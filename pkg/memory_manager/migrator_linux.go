@@ -0,0 +1,52 @@
+//go:build linux
+
+package memory_manager
+
+import (
+	"slices"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SyscallMigrator 通过migrate_pages(2)在进程内迁移页面，不依赖外部命令
+type SyscallMigrator struct {
+	topo *NumaTopology
+}
+
+func NewSyscallMigrator(topo *NumaTopology) *SyscallMigrator {
+	return &SyscallMigrator{topo: topo}
+}
+
+func (s *SyscallMigrator) MigratePages(pids []int, srcNodes, dstNodes []int) *MigrationResult {
+	result := &MigrationResult{}
+	if err := s.topo.Validate(append(slices.Clone(srcNodes), dstNodes...)); err != nil {
+		for _, pid := range pids {
+			result.Pids = append(result.Pids, PidMigrationResult{Pid: pid, Err: err})
+		}
+		return result
+	}
+
+	oldMask := s.topo.NodeMask(srcNodes)
+	newMask := s.topo.NodeMask(dstNodes)
+	// maxnode是位图的位数，与libnuma一致需要多传一位
+	maxNode := uintptr(len(oldMask)*64 + 1)
+
+	for _, pid := range pids {
+		r := PidMigrationResult{Pid: pid}
+		notMoved, _, errno := unix.Syscall6(unix.SYS_MIGRATE_PAGES,
+			uintptr(pid),
+			maxNode,
+			uintptr(unsafe.Pointer(&oldMask[0])),
+			uintptr(unsafe.Pointer(&newMask[0])),
+			0, 0)
+		if errno != 0 {
+			r.Errno = syscall.Errno(errno)
+		} else {
+			r.NotMoved = int(notMoved)
+		}
+		result.Pids = append(result.Pids, r)
+	}
+	return result
+}
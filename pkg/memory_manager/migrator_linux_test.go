@@ -0,0 +1,66 @@
+//go:build linux
+
+package memory_manager
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// 源掩码和目标掩码相同时migrate_pages不移动任何页面，单节点机器上也能验证系统调用的参数
+func TestSyscallMigratorSameNode(t *testing.T) {
+	topo, err := GetNumaTopology()
+	if err != nil {
+		t.Skipf("no NUMA topology: %v", err)
+	}
+	node := topo.Online[0]
+	pid := os.Getpid()
+
+	result := NewSyscallMigrator(topo).MigratePages([]int{pid}, []int{node}, []int{node})
+	if len(result.Pids) != 1 {
+		t.Fatalf("got %d pid results, want 1", len(result.Pids))
+	}
+	r := result.Pids[0]
+	if r.Errno == syscall.ENOSYS || r.Errno == syscall.EPERM {
+		t.Skipf("migrate_pages not permitted here: %v", r.Errno)
+	}
+	if r.Pid != pid {
+		t.Errorf("Pid = %d, want %d", r.Pid, pid)
+	}
+	if r.Failed() {
+		t.Fatalf("migration failed: %s", result)
+	}
+	if failed := result.Failed(); len(failed) != 0 {
+		t.Errorf("Failed() = %v, want none", failed)
+	}
+	if result.NotMoved() != 0 {
+		t.Errorf("NotMoved() = %d, want 0", result.NotMoved())
+	}
+	if want := "not_moved=0"; !strings.Contains(result.String(), want) {
+		t.Errorf("String() = %q, want it to contain %q", result.String(), want)
+	}
+}
+
+// 节点不在线时不调用系统调用，每个进程都记录同一个错误
+func TestSyscallMigratorOfflineNode(t *testing.T) {
+	topo := &NumaTopology{Online: []int{0}, DramNodes: []int{0}, MaxNode: 0}
+	pids := []int{os.Getpid(), os.Getppid()}
+
+	result := NewSyscallMigrator(topo).MigratePages(pids, []int{0}, []int{2})
+	if len(result.Pids) != len(pids) {
+		t.Fatalf("got %d pid results, want %d", len(result.Pids), len(pids))
+	}
+	for i, r := range result.Pids {
+		if r.Pid != pids[i] {
+			t.Errorf("Pids[%d].Pid = %d, want %d", i, r.Pid, pids[i])
+		}
+		if r.Err == nil || r.Errno != 0 {
+			t.Errorf("Pids[%d] = %+v, want a validation error and no errno", i, r)
+		}
+	}
+	if got := len(result.Failed()); got != len(pids) {
+		t.Errorf("len(Failed()) = %d, want %d", got, len(pids))
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package memory_manager
+
+import "syscall"
+
+type SyscallMigrator struct {
+	topo *NumaTopology
+}
+
+func NewSyscallMigrator(topo *NumaTopology) *SyscallMigrator {
+	return &SyscallMigrator{topo: topo}
+}
+
+func (s *SyscallMigrator) MigratePages(pids []int, srcNodes, dstNodes []int) *MigrationResult {
+	result := &MigrationResult{}
+	for _, pid := range pids {
+		result.Pids = append(result.Pids, PidMigrationResult{Pid: pid, Errno: syscall.ENOSYS})
+	}
+	return result
+}
@@ -4,9 +4,12 @@ package memory_manager
 author:liuyang
 date:2025-3-28
 NUMA节点内存资源解析
+按字段名解析/sys/devices/system/node/nodeN/meminfo的全部字段，并参考内核si_mem_available估算节点的可用内存
 */
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"strconv"
@@ -17,6 +20,89 @@ type NumaMemInfo struct {
 	Total uint64 // 总内存（字节）
 	Free  uint64 // 空闲内存（字节）
 	Used  uint64 // 已用内存（字节）
+
+	// 估算的可用内存（字节），空闲内存加上可以回收的页缓存和内核对象，扣除水位线，见EstimateAvailable
+	Available uint64
+
+	SwapCached     uint64
+	Active         uint64
+	Inactive       uint64
+	ActiveAnon     uint64 // Active(anon)
+	InactiveAnon   uint64 // Inactive(anon)
+	ActiveFile     uint64 // Active(file)
+	InactiveFile   uint64 // Inactive(file)
+	Unevictable    uint64
+	Mlocked        uint64
+	Dirty          uint64
+	Writeback      uint64
+	FilePages      uint64 // 页缓存，包含Shmem
+	Mapped         uint64
+	AnonPages      uint64
+	Shmem          uint64 // tmpfs和共享内存，不在file LRU上，不能直接回收
+	KernelStack    uint64
+	PageTables     uint64
+	SecPageTables  uint64
+	NFSUnstable    uint64 // NFS_Unstable
+	Bounce         uint64
+	WritebackTmp   uint64
+	KReclaimable   uint64 // 可回收的内核内存，包含SReclaimable
+	Slab           uint64
+	SReclaimable   uint64
+	SUnreclaim     uint64
+	AnonHugePages  uint64
+	ShmemHugePages uint64
+	ShmemPmdMapped uint64
+	FileHugePages  uint64
+	FilePmdMapped  uint64
+	Unaccepted     uint64
+
+	// 大页池，单位是页数而不是字节
+	HugePagesTotal uint64
+	HugePagesFree  uint64
+	HugePagesSurp  uint64
+}
+
+// 字段名 -> NumaMemInfo中的字段
+func (info *NumaMemInfo) fields() map[string]*uint64 {
+	return map[string]*uint64{
+		"MemTotal":        &info.Total,
+		"MemFree":         &info.Free,
+		"MemUsed":         &info.Used,
+		"SwapCached":      &info.SwapCached,
+		"Active":          &info.Active,
+		"Inactive":        &info.Inactive,
+		"Active(anon)":    &info.ActiveAnon,
+		"Inactive(anon)":  &info.InactiveAnon,
+		"Active(file)":    &info.ActiveFile,
+		"Inactive(file)":  &info.InactiveFile,
+		"Unevictable":     &info.Unevictable,
+		"Mlocked":         &info.Mlocked,
+		"Dirty":           &info.Dirty,
+		"Writeback":       &info.Writeback,
+		"FilePages":       &info.FilePages,
+		"Mapped":          &info.Mapped,
+		"AnonPages":       &info.AnonPages,
+		"Shmem":           &info.Shmem,
+		"KernelStack":     &info.KernelStack,
+		"PageTables":      &info.PageTables,
+		"SecPageTables":   &info.SecPageTables,
+		"NFS_Unstable":    &info.NFSUnstable,
+		"Bounce":          &info.Bounce,
+		"WritebackTmp":    &info.WritebackTmp,
+		"KReclaimable":    &info.KReclaimable,
+		"Slab":            &info.Slab,
+		"SReclaimable":    &info.SReclaimable,
+		"SUnreclaim":      &info.SUnreclaim,
+		"AnonHugePages":   &info.AnonHugePages,
+		"ShmemHugePages":  &info.ShmemHugePages,
+		"ShmemPmdMapped":  &info.ShmemPmdMapped,
+		"FileHugePages":   &info.FileHugePages,
+		"FilePmdMapped":   &info.FilePmdMapped,
+		"Unaccepted":      &info.Unaccepted,
+		"HugePages_Total": &info.HugePagesTotal,
+		"HugePages_Free":  &info.HugePagesFree,
+		"HugePages_Surp":  &info.HugePagesSurp,
+	}
 }
 
 // 获取指定NUMA节点的内存信息
@@ -26,39 +112,138 @@ func GetNumaMemInfo(nodeID int) (NumaMemInfo, error) {
 	if err != nil {
 		return NumaMemInfo{}, fmt.Errorf("读取文件失败: %v", err)
 	}
+	info, err := ParseNumaMemInfo(data)
+	if err != nil {
+		return NumaMemInfo{}, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+
+	// 读取水位线失败时按0估算，可用内存会偏大一些
+	var wmark Watermarks
+	if zoneinfo, err := os.ReadFile("/proc/zoneinfo"); err == nil {
+		wmark = ParseZoneWatermarks(zoneinfo, os.Getpagesize())[nodeID]
+	}
+	info.Available = EstimateAvailable(info, wmark)
+	return info, nil
+}
 
+// 解析节点meminfo，每行格式为 "Node <id> <key>: <value> [kB]"
+// 按字段名而不是位置匹配，未知字段忽略；带kB单位的转换为字节，大页字段是页数
+func ParseNumaMemInfo(data []byte) (NumaMemInfo, error) {
 	var info NumaMemInfo
-	lines := strings.SplitSeq(string(data), "\n")
-	for line := range lines {
-		fields := strings.Fields(line)
-		if len(fields) < 4 {
+	fields := info.fields()
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 {
 			continue
 		}
-
-		// 解析字段（单位：kB）
-		key := fields[2]
-		value, err := strconv.ParseUint(fields[3], 10, 64)
+		if len(parts) < 4 || len(parts) > 5 || parts[0] != "Node" {
+			return NumaMemInfo{}, fmt.Errorf("unexpected line %q", scanner.Text())
+		}
+		key, ok := strings.CutSuffix(parts[2], ":")
+		if !ok {
+			return NumaMemInfo{}, fmt.Errorf("missing ':' after key in line %q", scanner.Text())
+		}
+		value, err := strconv.ParseUint(parts[3], 10, 64)
 		if err != nil {
-			continue
+			return NumaMemInfo{}, fmt.Errorf("invalid value for %s: %w", key, err)
 		}
-
-		// 转换为字节
-		valueBytes := value * 1024
-
-		switch key {
-		case "MemTotal:":
-			info.Total = valueBytes
-		case "MemFree:":
-			info.Free = valueBytes
-		case "MemUsed:":
-			info.Used = valueBytes
+		if len(parts) == 5 {
+			if parts[4] != "kB" {
+				return NumaMemInfo{}, fmt.Errorf("unknown unit %q for %s", parts[4], key)
+			}
+			if value > (1<<64-1)/1024 {
+				return NumaMemInfo{}, fmt.Errorf("value for %s overflows: %d kB", key, value)
+			}
+			// 转换为字节
+			value *= 1024
+		}
+		if field, ok := fields[key]; ok {
+			*field = value
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return NumaMemInfo{}, err
+	}
 
 	// 如果未直接提供Used，则计算
-	if info.Used == 0 && info.Total > 0 {
+	if info.Used == 0 && info.Total > info.Free {
 		info.Used = info.Total - info.Free
 	}
-
 	return info, nil
 }
+
+// Watermarks 节点上所有zone的水位线之和（字节）
+type Watermarks struct {
+	Min  uint64
+	Low  uint64
+	High uint64
+}
+
+// 解析/proc/zoneinfo，返回节点 -> 水位线
+// 每个zone以 "Node <id>, zone <name>" 开始，其后的 "min/low/high <pages>" 为该zone的水位线
+func ParseZoneWatermarks(data []byte, pageSize int) map[int]Watermarks {
+	result := make(map[int]Watermarks)
+	node := -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "Node "); ok {
+			id, _, _ := strings.Cut(rest, ",")
+			n, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				node = -1
+				continue
+			}
+			node = n
+			continue
+		}
+		if node < 0 {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		pages, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		wmark := result[node]
+		switch parts[0] {
+		case "min":
+			wmark.Min += pages * uint64(pageSize)
+		case "low":
+			wmark.Low += pages * uint64(pageSize)
+		case "high":
+			wmark.High += pages * uint64(pageSize)
+		default:
+			continue
+		}
+		result[node] = wmark
+	}
+	return result
+}
+
+// EstimateAvailable 参考内核si_mem_available估算节点在不换出的情况下还能分配的内存
+// 可用 = 空闲 - 预留(high水位) + 页缓存 - min(页缓存/2, low水位) + 可回收内核内存 - min(可回收内核内存/2, low水位)
+// 页缓存只统计file LRU(Active(file)+Inactive(file))，不包含不能直接回收的Shmem
+func EstimateAvailable(info NumaMemInfo, wmark Watermarks) uint64 {
+	available := int64(info.Free) - int64(wmark.High)
+
+	pagecache := info.ActiveFile + info.InactiveFile
+	available += int64(pagecache - min(pagecache/2, wmark.Low))
+
+	reclaimable := info.KReclaimable
+	if reclaimable == 0 {
+		// 旧内核没有KReclaimable
+		reclaimable = info.SReclaimable
+	}
+	available += int64(reclaimable - min(reclaimable/2, wmark.Low))
+
+	if available < 0 {
+		return 0
+	}
+	return min(uint64(available), info.Total)
+}
@@ -0,0 +1,297 @@
+package memory_manager
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata中的node0_meminfo和zoneinfo取自同一台单NUMA节点的机器，页大小4KiB
+const testPageSize = 4096
+
+func readTestdata(t testing.TB, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseNumaMemInfoFixture(t *testing.T) {
+	info, err := ParseNumaMemInfo(readTestdata(t, "node0_meminfo"))
+	if err != nil {
+		t.Fatalf("ParseNumaMemInfo: %v", err)
+	}
+	fields := []struct {
+		name string
+		got  uint64
+		want uint64
+	}{
+		{"Total", info.Total, 6158152 << 10},
+		{"Free", info.Free, 760752 << 10},
+		{"Used", info.Used, 5397400 << 10},
+		{"Active", info.Active, 2933076 << 10},
+		{"ActiveAnon", info.ActiveAnon, 20 << 10},
+		{"InactiveAnon", info.InactiveAnon, 201696 << 10},
+		{"ActiveFile", info.ActiveFile, 2933056 << 10},
+		{"InactiveFile", info.InactiveFile, 1826304 << 10},
+		{"FilePages", info.FilePages, 4768844 << 10},
+		{"Shmem", info.Shmem, 9484 << 10},
+		{"NFSUnstable", info.NFSUnstable, 0},
+		{"KReclaimable", info.KReclaimable, 198208 << 10},
+		{"SReclaimable", info.SReclaimable, 198208 << 10},
+		{"SUnreclaim", info.SUnreclaim, 34452 << 10},
+		{"FileHugePages", info.FileHugePages, 4096 << 10},
+		{"HugePagesTotal", info.HugePagesTotal, 0},
+		// 解析不估算可用内存，见EstimateAvailable
+		{"Available", info.Available, 0},
+	}
+	for _, f := range fields {
+		if f.got != f.want {
+			t.Errorf("%s = %d, want %d", f.name, f.got, f.want)
+		}
+	}
+}
+
+func TestParseNumaMemInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want NumaMemInfo
+	}{
+		{name: "empty", data: ""},
+		{
+			// 没有MemUsed时由MemTotal - MemFree得到
+			name: "used derived",
+			data: "Node 1 MemTotal: 8 kB\nNode 1 MemFree: 3 kB\n",
+			want: NumaMemInfo{Total: 8 << 10, Free: 3 << 10, Used: 5 << 10},
+		},
+		{
+			// 大页字段是页数，不乘1024；未知字段和空行忽略，字段顺序不影响结果
+			name: "hugepages and unknown fields",
+			data: "\nNode 0 HugePages_Total:     4\nNode 0 NewField:   12 kB\nNode 0 HugePages_Free: 1\nNode 0 MemFree: 1 kB\nNode 0 MemTotal: 2 kB\n",
+			want: NumaMemInfo{Total: 2 << 10, Free: 1 << 10, Used: 1 << 10, HugePagesTotal: 4, HugePagesFree: 1},
+		},
+		{
+			// 最大的不溢出的值
+			name: "largest value",
+			data: "Node 0 MemTotal: 18014398509481983 kB\n",
+			want: NumaMemInfo{Total: 18014398509481983 << 10, Used: 18014398509481983 << 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNumaMemInfo([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseNumaMemInfo: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseNumaMemInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNumaMemInfoErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		// 18014398509481984 kB = 2^64字节
+		{name: "overflow", data: "Node 0 MemTotal: 18014398509481984 kB\n", wantErr: "overflows"},
+		{name: "overflow max uint64", data: "Node 0 MemFree: 18446744073709551615 kB\n", wantErr: "overflows"},
+		{name: "value out of range", data: "Node 0 MemFree: 18446744073709551616 kB\n", wantErr: "invalid value for MemFree"},
+		{name: "unknown unit", data: "Node 0 MemTotal: 8 MB\n", wantErr: `unknown unit "MB" for MemTotal`},
+		{name: "unknown unit on page count", data: "Node 0 HugePages_Total: 4 pages\n", wantErr: `unknown unit "pages"`},
+		{name: "negative value", data: "Node 0 MemTotal: -8 kB\n", wantErr: "invalid value for MemTotal"},
+		{name: "missing colon", data: "Node 0 MemTotal 8 kB\n", wantErr: "missing ':'"},
+		{name: "not a node line", data: "MemTotal:        8 kB\n", wantErr: "unexpected line"},
+		{name: "too many fields", data: "Node 0 MemTotal: 8 kB extra\n", wantErr: "unexpected line"},
+		{name: "bad line after good ones", data: "Node 0 MemTotal: 8 kB\nNode 0 MemFree:\n", wantErr: "unexpected line"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseNumaMemInfo([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseNumaMemInfo() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if info != (NumaMemInfo{}) {
+				t.Errorf("ParseNumaMemInfo() = %+v on error, want zero value", info)
+			}
+		})
+	}
+}
+
+func FuzzParseNumaMemInfo(f *testing.F) {
+	f.Add(readTestdata(f, "node0_meminfo"))
+	f.Add([]byte("Node 0 MemTotal: 8 kB\nNode 0 MemFree: 3 kB\n"))
+	f.Add([]byte("Node 0 MemTotal: 18014398509481984 kB\n"))
+	f.Add([]byte("Node 0 HugePages_Total: 4\n"))
+	f.Add([]byte("Node 0 MemTotal: 8 MB\n"))
+	f.Add([]byte("Node 0 MemUsed: 1 kB\nNode 0 MemTotal: 1 kB\nNode 0 MemFree: 8 kB\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info, err := ParseNumaMemInfo(data)
+		if err != nil {
+			if info != (NumaMemInfo{}) {
+				t.Fatalf("ParseNumaMemInfo() = %+v with error %v, want zero value", info, err)
+			}
+			return
+		}
+		again, err := ParseNumaMemInfo(data)
+		if err != nil || again != info {
+			t.Fatalf("second parse = %+v, %v, want %+v", again, err, info)
+		}
+		// 没有直接提供MemUsed(或为0)时Used不超过Total
+		if !bytes.Contains(data, []byte("MemUsed")) && info.Used > info.Total {
+			t.Fatalf("Used %d > Total %d", info.Used, info.Total)
+		}
+		if info.Available != 0 {
+			t.Fatalf("Available = %d, parsing must not estimate it", info.Available)
+		}
+	})
+}
+
+func TestParseZoneWatermarksFixture(t *testing.T) {
+	got := ParseZoneWatermarks(readTestdata(t, "zoneinfo"), testPageSize)
+	// DMA + DMA32 + Normal + Movable + Device五个zone的水位线之和
+	want := map[int]Watermarks{
+		0: {
+			Min:  (42 + 8498 + 11939 + 32 + 0) * testPageSize,
+			Low:  (52 + 10622 + 14027 + 32 + 0) * testPageSize,
+			High: (62 + 12746 + 16115 + 32 + 0) * testPageSize,
+		},
+	}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("ParseZoneWatermarks() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseZoneWatermarks(t *testing.T) {
+	data := `Node 0, zone   Normal
+  pages free     1000
+        min      10
+        low      20
+        high     30
+        spanned  4096
+  pagesets
+    cpu: 0
+              count: 5
+              high:  100
+Node 1, zone   Normal
+        min      1
+        low      2
+        high     3
+Node 1, zone  Movable
+        min      4
+        low      5
+        high     x
+Node x, zone   Normal
+        min      1000
+Node 2, zone   Normal
+        min      7
+`
+	got := ParseZoneWatermarks([]byte(data), 10)
+	want := map[int]Watermarks{
+		0: {Min: 100, Low: 200, High: 300},
+		// 无法解析的水位线忽略
+		1: {Min: 50, Low: 70, High: 30},
+		// 无法解析节点号的zone不计入任何节点
+		2: {Min: 70},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParseZoneWatermarks() = %+v, want %+v", got, want)
+	}
+	for node, w := range want {
+		if got[node] != w {
+			t.Errorf("node %d = %+v, want %+v", node, got[node], w)
+		}
+	}
+
+	if got := ParseZoneWatermarks(nil, testPageSize); len(got) != 0 {
+		t.Errorf("ParseZoneWatermarks(nil) = %+v, want empty", got)
+	}
+}
+
+func TestEstimateAvailable(t *testing.T) {
+	tests := []struct {
+		name  string
+		info  NumaMemInfo
+		wmark Watermarks
+		want  uint64
+	}{
+		{name: "empty"},
+		{
+			// 100 - 10 + (60 - min(30, 20)) + (40 - min(20, 20))
+			name:  "watermarks",
+			info:  NumaMemInfo{Total: 1000, Free: 100, ActiveFile: 20, InactiveFile: 40, KReclaimable: 40, SReclaimable: 30},
+			wmark: Watermarks{Min: 5, Low: 20, High: 10},
+			want:  100 - 10 + 40 + 20,
+		},
+		{
+			// 页缓存和可回收内核内存的一半小于low水位时只扣一半
+			name:  "half of reclaimable",
+			info:  NumaMemInfo{Total: 1000, Free: 100, ActiveFile: 10, InactiveFile: 10, KReclaimable: 8},
+			wmark: Watermarks{Low: 50, High: 0},
+			want:  100 + 10 + 4,
+		},
+		{
+			// Shmem不在file LRU上，不算作可用
+			name: "shmem not reclaimable",
+			info: NumaMemInfo{Total: 1000, Free: 100, FilePages: 500, Shmem: 480, InactiveFile: 20},
+			want: 120,
+		},
+		{
+			// 旧内核没有KReclaimable，使用SReclaimable
+			name: "sreclaimable fallback",
+			info: NumaMemInfo{Total: 1000, Free: 100, SReclaimable: 60},
+			want: 160,
+		},
+		{
+			name:  "floors at zero",
+			info:  NumaMemInfo{Total: 1000, Free: 10},
+			wmark: Watermarks{High: 100},
+			want:  0,
+		},
+		{
+			name: "capped at total",
+			info: NumaMemInfo{Total: 100, Free: 90, InactiveFile: 100},
+			want: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateAvailable(tt.info, tt.wmark); got != tt.want {
+				t.Errorf("EstimateAvailable() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// 用同一台机器的meminfo和zoneinfo估算，结果和手工按si_mem_available计算的一致
+func TestEstimateAvailableFixture(t *testing.T) {
+	info, err := ParseNumaMemInfo(readTestdata(t, "node0_meminfo"))
+	if err != nil {
+		t.Fatalf("ParseNumaMemInfo: %v", err)
+	}
+	wmark := ParseZoneWatermarks(readTestdata(t, "zoneinfo"), testPageSize)[0]
+
+	const (
+		free        = 760752 << 10
+		high        = 28955 * testPageSize
+		low         = 24733 * testPageSize
+		pagecache   = (2933056 + 1826304) << 10
+		reclaimable = 198208 << 10
+	)
+	want := uint64(free - high + pagecache - min(pagecache/2, low) + reclaimable - min(reclaimable/2, low))
+	if got := EstimateAvailable(info, wmark); got != want {
+		t.Errorf("EstimateAvailable() = %d, want %d", got, want)
+	}
+	if want > info.Total || want < info.Free {
+		t.Errorf("estimate %d outside [MemFree %d, MemTotal %d]", want, info.Free, info.Total)
+	}
+}
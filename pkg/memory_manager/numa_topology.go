@@ -0,0 +1,80 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-4-22
+NUMA拓扑解析：区分带CPU的DRAM节点和只有内存的CXL节点
+*/
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const numaNodeBasePath = "/sys/devices/system/node"
+
+type NumaTopology struct {
+	Online    []int // 在线的NUMA节点
+	DramNodes []int // 带CPU的本地内存节点
+	CxlNodes  []int // 无CPU的内存节点(CXL池化内存)
+	MaxNode   int   // 系统可能存在的最大节点号，用于构造节点掩码
+}
+
+// 读取NUMA拓扑
+func GetNumaTopology() (*NumaTopology, error) {
+	online, err := readNodeListFile(filepath.Join(numaNodeBasePath, "online"))
+	if err != nil {
+		return nil, err
+	}
+	possible, err := readNodeListFile(filepath.Join(numaNodeBasePath, "possible"))
+	if err != nil {
+		possible = online
+	}
+
+	topo := &NumaTopology{Online: online}
+	for _, id := range possible {
+		topo.MaxNode = max(topo.MaxNode, id)
+	}
+	for _, id := range online {
+		cpus, err := readNodeListFile(filepath.Join(numaNodeBasePath, fmt.Sprintf("node%d", id), "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		if len(cpus) > 0 {
+			topo.DramNodes = append(topo.DramNodes, id)
+		} else {
+			topo.CxlNodes = append(topo.CxlNodes, id)
+		}
+	}
+	return topo, nil
+}
+
+// 检查节点是否都在线
+func (t *NumaTopology) Validate(nodes []int) error {
+	for _, id := range nodes {
+		if !slices.Contains(t.Online, id) {
+			return fmt.Errorf("numa node %d is not online (online: %v)", id, t.Online)
+		}
+	}
+	return nil
+}
+
+// 构造migrate_pages/set_mempolicy使用的节点位图
+func (t *NumaTopology) NodeMask(nodes []int) []uint64 {
+	mask := make([]uint64, t.MaxNode/64+1)
+	for _, id := range nodes {
+		mask[id/64] |= 1 << (id % 64)
+	}
+	return mask
+}
+
+func readNodeListFile(path string) ([]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	return parseNodeList(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,241 @@
+//go:build linux
+
+package memory_manager
+
+/**
+author:liuyang
+date:2025-4-20
+基于move_pages(2)的按字节数迁移页面，用于部分迁移模式
+*/
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+const (
+	movePagesBatch = 4096    // 单次move_pages调用的页面数
+	mpolMfMove     = 1 << 1  // MPOL_MF_MOVE: 只迁移独占的页面
+	pagemapPresent = 1 << 63 // pagemap条目的第63位: 页面驻留在内存中
+)
+
+// movePagesByBytes 把pid在srcNodes上的页面迁移到dstNodes，直到迁移字节数达到budget
+// 根据numa_maps跳过在srcNodes上没有页面的VMA，根据pagemap跳过没有驻留的页面，
+// 一个VMA在srcNodes上的页面都找到后不再扫描它剩下的地址
+// 多个目标节点时按页面轮流分配，返回实际迁移的字节数
+func movePagesByBytes(pid int, srcNodes []int, dstNodes []int, budget uint64) (uint64, error) {
+	pageSize := uint64(os.Getpagesize())
+	vmas, err := readWritableVmas(pid)
+	if err != nil {
+		return 0, err
+	}
+	srcPages, err := readVmaNodePages(pid, srcNodes, pageSize)
+	if err != nil {
+		return 0, err
+	}
+	pagemap, err := os.Open(fmt.Sprintf("/proc/%d/pagemap", pid))
+	if err != nil {
+		klog.Warningf("[movePagesByBytes] 读取进程 %d 的pagemap失败, 逐页查询页面所在节点: %v", pid, err)
+		pagemap = nil
+	} else {
+		defer pagemap.Close()
+	}
+
+	limit := budget / pageSize
+	var moved uint64
+	for _, vma := range vmas {
+		if moved >= limit {
+			break
+		}
+		// 读取maps和numa_maps之间新建的VMA没有统计，整个扫描
+		remaining, ok := srcPages[uint64(vma[0])]
+		if !ok {
+			remaining = uint64(vma[1]-vma[0]) / pageSize
+		}
+		if remaining == 0 {
+			continue
+		}
+		n, err := moveVmaPages(pid, pagemap, vma, srcNodes, dstNodes, remaining, limit-moved, pageSize)
+		moved += n
+		if err != nil {
+			return moved * pageSize, err
+		}
+	}
+	return moved * pageSize, nil
+}
+
+// 分批扫描一个VMA，找到remaining个位于srcNodes上的页面或迁移了limit个页面后停止，返回迁移的页面数
+func moveVmaPages(pid int, pagemap *os.File, vma [2]uintptr, srcNodes, dstNodes []int, remaining, limit, pageSize uint64) (uint64, error) {
+	var moved uint64
+	pages := make([]uintptr, 0, movePagesBatch)
+	for start := vma[0]; start < vma[1] && remaining > 0 && moved < limit; {
+		end := min(vma[1], start+movePagesBatch*uintptr(pageSize))
+		var err error
+		pages, err = residentPages(pagemap, start, end, pageSize, pages[:0])
+		if err != nil {
+			return moved, err
+		}
+		start = end
+		if len(pages) == 0 {
+			continue
+		}
+
+		found, n, err := movePagesBatchTo(pid, pages, srcNodes, dstNodes, limit-moved)
+		moved += n
+		remaining -= min(found, remaining)
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// residentPages 把[start, end)中驻留在内存中的页面追加到pages，pagemap为nil时追加所有页面
+// pagemap每个页面一个8字节的条目，没有驻留的页面(从未访问或已换出)不需要查询和迁移
+func residentPages(pagemap *os.File, start, end uintptr, pageSize uint64, pages []uintptr) ([]uintptr, error) {
+	n := int(uint64(end-start) / pageSize)
+	if pagemap == nil {
+		for i := range n {
+			pages = append(pages, start+uintptr(uint64(i)*pageSize))
+		}
+		return pages, nil
+	}
+
+	buf := make([]byte, n*8)
+	if _, err := pagemap.ReadAt(buf, int64(uint64(start)/pageSize*8)); err != nil {
+		return pages, fmt.Errorf("read pagemap at %#x: %w", start, err)
+	}
+	for i := range n {
+		if binary.NativeEndian.Uint64(buf[i*8:])&pagemapPresent != 0 {
+			pages = append(pages, start+uintptr(uint64(i)*pageSize))
+		}
+	}
+	return pages, nil
+}
+
+// readVmaNodePages 读取/proc/<pid>/numa_maps，返回每个VMA(按起始地址)在nodes上驻留的页面数(以pageSize计)
+func readVmaNodePages(pid int, nodes []int, pageSize uint64) (map[uint64]uint64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/numa_maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[uint64]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := parseNumaMapsEntry(scanner.Text())
+		var pages uint64
+		for _, node := range nodes {
+			pages += entry.pages[node]
+		}
+		result[entry.start] = pages * entry.pageSize / pageSize
+	}
+	return result, scanner.Err()
+}
+
+// movePagesBatchTo 先查询一批页面所在节点，再把位于srcNodes上的最多limit个页面迁移到dstNodes
+// 返回这批页面中位于srcNodes上的页面数和迁移成功的页面数
+func movePagesBatchTo(pid int, pages []uintptr, srcNodes []int, dstNodes []int, limit uint64) (uint64, uint64, error) {
+	status := make([]int32, len(pages))
+	// nodes为空时move_pages只查询页面所在节点
+	if err := movePages(pid, pages, nil, status); err != nil {
+		return 0, 0, err
+	}
+
+	var found uint64
+	candidates := make([]uintptr, 0, min(uint64(len(pages)), limit))
+	for i, node := range status {
+		// 负值表示页面不存在或无法访问
+		if node < 0 || !slices.Contains(srcNodes, int(node)) {
+			continue
+		}
+		found++
+		if uint64(len(candidates)) < limit {
+			candidates = append(candidates, pages[i])
+		}
+	}
+	if len(candidates) == 0 {
+		return found, 0, nil
+	}
+
+	nodes := make([]int32, len(candidates))
+	for i := range nodes {
+		nodes[i] = int32(dstNodes[i%len(dstNodes)])
+	}
+	status = status[:len(candidates)]
+	if err := movePages(pid, candidates, nodes, status); err != nil {
+		return found, 0, err
+	}
+
+	var moved uint64
+	for _, node := range status {
+		if node >= 0 && slices.Contains(dstNodes, int(node)) {
+			moved++
+		}
+	}
+	return found, moved, nil
+}
+
+func movePages(pid int, pages []uintptr, nodes []int32, status []int32) error {
+	var nodesPtr uintptr
+	if nodes != nil {
+		nodesPtr = uintptr(unsafe.Pointer(&nodes[0]))
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_MOVE_PAGES,
+		uintptr(pid),
+		uintptr(len(pages)),
+		uintptr(unsafe.Pointer(&pages[0])),
+		nodesPtr,
+		uintptr(unsafe.Pointer(&status[0])),
+		mpolMfMove)
+	if errno != 0 {
+		return fmt.Errorf("move_pages pid %d: %w", pid, errno)
+	}
+	return nil
+}
+
+// readWritableVmas 读取/proc/<pid>/maps中可写的私有映射(堆、栈、匿名内存等)
+func readWritableVmas(pid int) ([][2]uintptr, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vmas [][2]uintptr
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[1], "rw") || fields[1][3] != 'p' {
+			continue
+		}
+		// [vsyscall]等特殊映射不能迁移
+		if len(fields) >= 6 && strings.HasPrefix(fields[5], "[v") {
+			continue
+		}
+		start, end, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			continue
+		}
+		s, err := strconv.ParseUint(start, 16, 64)
+		if err != nil {
+			continue
+		}
+		e, err := strconv.ParseUint(end, 16, 64)
+		if err != nil {
+			continue
+		}
+		vmas = append(vmas, [2]uintptr{uintptr(s), uintptr(e)})
+	}
+	return vmas, scanner.Err()
+}
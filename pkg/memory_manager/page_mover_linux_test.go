@@ -0,0 +1,141 @@
+//go:build linux
+
+package memory_manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// 映射n个页面的匿名内存，只访问touched中的页面
+// 前后各留一个不可访问的页面，避免内核把它和相邻的映射合并成一个VMA
+func mmapPages(t *testing.T, n int, touched ...int) ([]byte, uintptr) {
+	t.Helper()
+	pageSize := os.Getpagesize()
+	region, err := unix.Mmap(-1, 0, (n+2)*pageSize, unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		t.Fatalf("mmap: %v", err)
+	}
+	t.Cleanup(func() { unix.Munmap(region) })
+	mem := region[pageSize : (n+1)*pageSize]
+	if err := unix.Mprotect(mem, unix.PROT_READ|unix.PROT_WRITE); err != nil {
+		t.Fatalf("mprotect: %v", err)
+	}
+	for _, i := range touched {
+		mem[i*pageSize] = 1
+	}
+	return mem, sliceAddr(mem)
+}
+
+func sliceAddr(mem []byte) uintptr {
+	return uintptr(unsafe.Pointer(&mem[0]))
+}
+
+// 只返回访问过的页面，没有pagemap时返回全部页面
+func TestResidentPages(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+	_, start := mmapPages(t, 16, 0, 3, 7)
+	end := start + uintptr(16*pageSize)
+
+	pagemap, err := os.Open("/proc/self/pagemap")
+	if err != nil {
+		t.Skipf("pagemap not readable: %v", err)
+	}
+	defer pagemap.Close()
+
+	got, err := residentPages(pagemap, start, end, pageSize, nil)
+	if err != nil {
+		t.Fatalf("residentPages: %v", err)
+	}
+	want := []uintptr{start, start + uintptr(3*pageSize), start + uintptr(7*pageSize)}
+	if !slices.Equal(got, want) {
+		t.Errorf("resident pages = %#x, want %#x", got, want)
+	}
+
+	all, err := residentPages(nil, start, end, pageSize, nil)
+	if err != nil {
+		t.Fatalf("residentPages without pagemap: %v", err)
+	}
+	if len(all) != 16 || all[0] != start || all[15] != end-uintptr(pageSize) {
+		t.Errorf("got %d pages without pagemap, want all 16", len(all))
+	}
+}
+
+// numa_maps中统计的是映射起始地址上的页面数
+func TestReadVmaNodePages(t *testing.T) {
+	topo, err := GetNumaTopology()
+	if err != nil {
+		t.Skipf("no NUMA topology: %v", err)
+	}
+	_, start := mmapPages(t, 8, 0, 1, 2, 3)
+
+	pages, err := readVmaNodePages(os.Getpid(), topo.Online, uint64(os.Getpagesize()))
+	if err != nil {
+		t.Fatalf("readVmaNodePages: %v", err)
+	}
+	if got := pages[uint64(start)]; got != 4 {
+		t.Errorf("pages at %#x = %d, want 4", start, got)
+	}
+}
+
+// 源节点和目标节点相同时页面保持不动，但每个查询到的页面都算作迁移成功，可以在单节点机器上验证预算
+func TestMovePagesByBytesBudget(t *testing.T) {
+	topo, err := GetNumaTopology()
+	if err != nil {
+		t.Skipf("no NUMA topology: %v", err)
+	}
+	node := topo.Online[0]
+	pageSize := uint64(os.Getpagesize())
+	touched := make([]int, 64)
+	for i := range touched {
+		touched[i] = i
+	}
+	mmapPages(t, 64, touched...)
+
+	tests := []struct {
+		budget uint64
+		want   uint64
+	}{
+		{budget: 0, want: 0},
+		{budget: pageSize - 1, want: 0},
+		{budget: 8*pageSize + 100, want: 8 * pageSize},
+		{budget: 32 * pageSize, want: 32 * pageSize},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.budget), func(t *testing.T) {
+			moved, err := movePagesByBytes(os.Getpid(), []int{node}, []int{node}, tt.budget)
+			if errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EPERM) {
+				t.Skipf("move_pages not permitted here: %v", err)
+			}
+			if err != nil {
+				t.Fatalf("movePagesByBytes: %v", err)
+			}
+			if moved != tt.want {
+				t.Errorf("moved %d bytes, want %d", moved, tt.want)
+			}
+		})
+	}
+}
+
+// 没有页面位于源节点时不迁移
+func TestMovePagesByBytesNoSourcePages(t *testing.T) {
+	topo, err := GetNumaTopology()
+	if err != nil {
+		t.Skipf("no NUMA topology: %v", err)
+	}
+	node := topo.Online[0]
+	moved, err := movePagesByBytes(os.Getpid(), []int{topo.MaxNode + 1}, []int{node}, 1<<20)
+	if err != nil {
+		t.Fatalf("movePagesByBytes: %v", err)
+	}
+	if moved != 0 {
+		t.Errorf("moved %d bytes from an offline node, want 0", moved)
+	}
+}
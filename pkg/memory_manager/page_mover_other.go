@@ -0,0 +1,9 @@
+//go:build !linux
+
+package memory_manager
+
+import "errors"
+
+func movePagesByBytes(pid int, srcNodes []int, dstNodes []int, budget uint64) (uint64, error) {
+	return 0, errors.New("move_pages is only supported on linux")
+}
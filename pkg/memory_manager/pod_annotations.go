@@ -0,0 +1,110 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-5-14
+在混部Pod的注解上反映当前内存层级和交换状态，方便作业框架和kubectl get -o查看
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"strconv"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// 注解由后台协程写入，AnnotatePodTier的调用方持有m.mu，不能等待API Server
+// 队列按Pod去重，同一个Pod只保留最新的patch
+type annotationQueue struct {
+	queue workqueue.TypedInterface[types.NamespacedName]
+
+	mu      sync.Mutex
+	patches map[types.NamespacedName][]byte // Pod -> 待写入的patch
+}
+
+func newAnnotationQueue() *annotationQueue {
+	return &annotationQueue{
+		queue:   workqueue.NewTyped[types.NamespacedName](),
+		patches: make(map[types.NamespacedName][]byte),
+	}
+}
+
+func (q *annotationQueue) add(pod types.NamespacedName, patch []byte) {
+	q.mu.Lock()
+	q.patches[pod] = patch
+	q.mu.Unlock()
+	q.queue.Add(pod)
+}
+
+// 依次写入队列中的patch，每个请求带超时，队列关闭并处理完剩余的patch后返回
+func (q *annotationQueue) run(client kubernetes.Interface) {
+	for {
+		pod, shutdown := q.queue.Get()
+		if shutdown {
+			return
+		}
+		q.mu.Lock()
+		patch, ok := q.patches[pod]
+		delete(q.patches, pod)
+		q.mu.Unlock()
+
+		if ok {
+			ctx, cancel := context.WithTimeout(context.Background(), common.ConnectTimeout)
+			_, err := client.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+			cancel()
+			if err != nil {
+				klog.Errorf("[AnnotatePodTier] 更新 pod %s 的注解失败: %v", pod.Name, err)
+			}
+		}
+		q.queue.Done(pod)
+	}
+}
+
+// 等待队列中的patch写完后停止后台协程
+func (q *annotationQueue) shutdown() {
+	q.queue.ShutDownWithDrain()
+}
+
+// AnnotatePodTier 根据PodInfo更新Pod的内存层级注解，patch在调用方的锁内构造，由后台协程写入
+// 交换出去时写入层级和交换块数，迁回DRAM后清除这两个注解，迁移时间和次数保留
+func (m *MemoryManager) AnnotatePodTier(podInfo *PodInfo) {
+	if m.KubeClient == nil || podInfo == nil {
+		return
+	}
+
+	// merge patch中null表示删除注解
+	annotations := map[string]*string{
+		common.AnnotationTier:          nil,
+		common.AnnotationSwappedBlocks: nil,
+		common.AnnotationMigrations:    ptrTo(strconv.Itoa(podInfo.MigrationCount)),
+	}
+	if tier := podInfo.Tier(); tier != TierDRAM {
+		annotations[common.AnnotationTier] = ptrTo(tier)
+		annotations[common.AnnotationSwappedBlocks] = ptrTo(strconv.Itoa(len(podInfo.SwapColocIds)))
+	}
+	if podInfo.LastMigration != nil {
+		annotations[common.AnnotationLastMigration] = ptrTo(podInfo.LastMigration.StartTime.Format(time.RFC3339))
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+	})
+	if err != nil {
+		klog.Errorf("[AnnotatePodTier] 构造 pod %s 的注解失败: %v", podInfo.Name, err)
+		return
+	}
+
+	m.annotations.add(types.NamespacedName{Namespace: podInfo.Namespace, Name: podInfo.Name}, patch)
+}
+
+func ptrTo(s string) *string {
+	return &s
+}
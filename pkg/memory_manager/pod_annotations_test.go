@@ -0,0 +1,55 @@
+package memory_manager
+
+import (
+	"context"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// AnnotatePodTier只把patch放进队列，不访问API Server；同一个Pod排队的patch只写入最新的一个，Shutdown前写完
+func TestAnnotatePodTierQueued(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "job-1", Namespace: "default"},
+	})
+	m := newMemoryManager(&common.Config{}, nil, nil, nil)
+	m.KubeClient = clientset
+
+	podInfo := &PodInfo{Name: "job-1", Namespace: "default", BindColocIds: []string{"a"}, SwapColocIds: []string{"b"}, MigrationCount: 1}
+	m.AnnotatePodTier(podInfo)
+	podInfo.BindColocIds = nil
+	podInfo.SwapColocIds = []string{"a", "b"}
+	podInfo.MigrationCount = 2
+	m.AnnotatePodTier(podInfo)
+	if actions := clientset.Actions(); len(actions) != 0 {
+		t.Fatalf("got %d actions before the worker ran, want 0", len(actions))
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.annotations.run(clientset)
+	}()
+	m.Shutdown()
+
+	if actions := clientset.Actions(); len(actions) != 1 {
+		t.Errorf("got %d actions, want 1 patch", len(actions))
+	}
+	pod, err := clientset.CoreV1().Pods("default").Get(context.Background(), "job-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get pod: %v", err)
+	}
+	want := map[string]string{
+		common.AnnotationTier:          TierCXL,
+		common.AnnotationSwappedBlocks: "2",
+		common.AnnotationMigrations:    "2",
+	}
+	for key, value := range want {
+		if got := pod.Annotations[key]; got != value {
+			t.Errorf("annotation %s: got %q, want %q", key, got, value)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-5-12
+迁移、回迁和兜底驱逐时在Pod上发出Kubernetes Event，让Pod的使用者知道内存层级的变化
+EventCorrelator会对相同的事件做聚合和限流，来回抖动的Pod不会刷爆API Server
+*/
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	EventSwappedOut      = "ColocationMemorySwappedOut"      // Pod的内存被交换到池化内存
+	EventSwappedIn       = "ColocationMemorySwappedIn"       // Pod的内存迁回DRAM
+	EventMigrationFailed = "ColocationMemoryMigrationFailed" // 页面迁移失败
+	EventEvicted         = "ColocationMemoryEvicted"         // 池化内存不足，Pod被兜底驱逐
+
+	eventComponent = "colocation-memory-device-plugin"
+)
+
+// 创建事件记录器，退出时需要调用broadcaster的Shutdown停止写入事件的协程
+func newEventRecorder(clientset kubernetes.Interface, nodeName string) (record.EventBroadcaster, record.EventRecorder) {
+	// 默认的CorrelatorOptions会聚合10分钟内相似的事件，并对每个对象的事件做令牌桶限流
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster, broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent, Host: nodeName})
+}
+
+// RecordPodEvent 在Pod上发出事件
+func (m *MemoryManager) RecordPodEvent(podInfo *PodInfo, eventType, reason, messageFmt string, args ...any) {
+	if m.Recorder == nil || podInfo == nil {
+		return
+	}
+	ref := &corev1.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Namespace:  podInfo.Namespace,
+		Name:       podInfo.Name,
+		UID:        podInfo.UID,
+	}
+	m.Recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+	klog.V(4).Infof("[RecordPodEvent] pod %s/%s %s: "+messageFmt, append([]any{podInfo.Namespace, podInfo.Name, reason}, args...)...)
+}
@@ -0,0 +1,50 @@
+package memory_manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// 事件写入API Server，Shutdown之后广播器的协程全部退出
+func TestPodEventsShutdown(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	clientset := fake.NewSimpleClientset()
+	m := &MemoryManager{}
+	m.events, m.Recorder = newEventRecorder(clientset, "node-1")
+
+	podInfo := &PodInfo{Name: "job-1", Namespace: "default", UID: "uid-1"}
+	m.RecordPodEvent(podInfo, corev1.EventTypeNormal, EventSwappedOut, "Swapped %d blocks out", 2)
+
+	var events *corev1.EventList
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var err error
+		events, err = clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("list events: %v", err)
+		}
+		if len(events.Items) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("got %d events, want 1", len(events.Items))
+	}
+	e := events.Items[0]
+	if e.Reason != EventSwappedOut || e.Message != "Swapped 2 blocks out" || e.InvolvedObject.Name != "job-1" {
+		t.Errorf("event = %s %q on %s, want %s on job-1", e.Reason, e.Message, e.InvolvedObject.Name, EventSwappedOut)
+	}
+	if e.Source.Component != eventComponent || e.Source.Host != "node-1" {
+		t.Errorf("event source = %+v, want %s on node-1", e.Source, eventComponent)
+	}
+
+	m.Shutdown()
+}
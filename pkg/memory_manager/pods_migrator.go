@@ -2,33 +2,134 @@ package memory_manager
 
 import (
 	"fmt"
-	"os/exec"
+	"strconv"
+	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 )
 
-// migrate pid fromnode tonode
-func (m *MemoryManager) MigratePod(podName string, srcNode string, dstNode string) error {
+// migrate pod fromnode tonode
+// 迁移Pod cgroup下的所有进程，返回每个进程的迁移结果
+func (m *MemoryManager) MigratePod(podName string, srcNode string, dstNode string) (*MigrationResult, error) {
 	startTime := time.Now()
 
 	podInfo, ok := m.Pod2PodInfo[podName]
 	if !ok {
 		klog.Errorf("[MigratePod] Pod %s 不存在", podName)
-		return fmt.Errorf("pod %s not found", podName)
+		return nil, fmt.Errorf("pod %s not found", podName)
 	}
 
-	pid := podInfo.Pid
-
-	cmd := exec.Command("migratepages", fmt.Sprintf("%d", pid), srcNode, dstNode)
-	output, err := cmd.CombinedOutput()
+	srcNodes, err := parseNodeList(srcNode)
+	if err != nil {
+		return nil, err
+	}
+	dstNodes, err := parseNodeList(dstNode)
 	if err != nil {
-		klog.Errorf("[MigratePod] 迁移 pod %s (pid: %d) 失败: %v\nOutput: %s", podName, pid, err, string(output))
-		return fmt.Errorf("failed to migrate pages for pod %s (pid %d): %v\nOutput: %s",
-			podName, pid, err, string(output))
+		return nil, err
 	}
 
-	klog.Infof("[MigratePod] 成功迁移 pod %s (pid: %d) 从节点 %s 到节点 %s", podName, pid, srcNode, dstNode)
+	pids := m.podTasks(podInfo)
+	report := m.newMigrationReport(srcNode, dstNode, pids)
+	result := m.Migrator.MigratePages(pids, srcNodes, dstNodes)
+	m.recordMigration(podInfo, report, pids)
+	if failed := result.Failed(); len(failed) > 0 {
+		klog.Errorf("[MigratePod] 迁移 pod %s 失败 %d/%d 个进程: %s", podName, len(failed), len(pids), result)
+		m.RecordPodEvent(podInfo, corev1.EventTypeWarning, EventMigrationFailed,
+			"Failed to migrate pages from NUMA node %s to %s: %d/%d tasks failed: %s", srcNode, dstNode, len(failed), len(pids), result)
+		return result, fmt.Errorf("failed to migrate pages for pod %s: %d/%d tasks failed: %s",
+			podName, len(failed), len(pids), result)
+	}
+
+	klog.Infof("[MigratePod] 成功迁移 pod %s (pids: %v) 从节点 %s 到节点 %s, 未迁移页面数: %d", podName, pids, srcNode, dstNode, result.NotMoved())
 	klog.Infof("[MigratePod] 迁移耗时: %s", time.Since(startTime))
-	return nil
+	return result, nil
+}
+
+// 获取Pod的所有进程，读取cgroup失败时退化为只迁移容器主进程
+func (m *MemoryManager) podTasks(podInfo *PodInfo) []int {
+	if podInfo.CgroupPath != "" {
+		pids, err := ListCgroupTasks(podInfo.CgroupPath)
+		if err == nil && len(pids) > 0 {
+			return pids
+		}
+		klog.Warningf("[podTasks] 读取 pod %s 的cgroup进程失败, 只迁移主进程 %d: %v", podInfo.Name, podInfo.Pid, err)
+	}
+	return []int{podInfo.Pid}
+}
+
+// 部分迁移: 只把pod在srcNode上的bytes字节页面迁移到dstNode，返回实际迁移的字节数
+func (m *MemoryManager) MigratePodPartial(podName string, srcNode string, dstNode string, bytes uint64) (uint64, error) {
+	startTime := time.Now()
+
+	podInfo, ok := m.Pod2PodInfo[podName]
+	if !ok {
+		klog.Errorf("[MigratePodPartial] Pod %s 不存在", podName)
+		return 0, fmt.Errorf("pod %s not found", podName)
+	}
+
+	srcNodes, err := parseNodeList(srcNode)
+	if err != nil {
+		return 0, err
+	}
+	dstNodes, err := parseNodeList(dstNode)
+	if err != nil {
+		return 0, err
+	}
+	if len(dstNodes) == 0 {
+		return 0, fmt.Errorf("empty destination node list %q", dstNode)
+	}
+
+	// 依次迁移Pod的进程，直到迁移字节数达到要求
+	pids := m.podTasks(podInfo)
+	report := m.newMigrationReport(srcNode, dstNode, pids)
+	defer m.recordMigration(podInfo, report, pids)
+	var moved uint64
+	for _, pid := range pids {
+		if moved >= bytes {
+			break
+		}
+		n, err := m.Migrator.MovePages(pid, srcNodes, dstNodes, bytes-moved)
+		moved += n
+		if err != nil {
+			klog.Errorf("[MigratePodPartial] 迁移 pod %s (pid: %d) 失败, 已迁移 %d/%d 字节: %v", podName, pid, moved, bytes, err)
+			m.RecordPodEvent(podInfo, corev1.EventTypeWarning, EventMigrationFailed,
+				"Failed to move pages from NUMA node %s to %s after %d/%d bytes: %v", srcNode, dstNode, moved, bytes, err)
+			return moved, fmt.Errorf("failed to move pages for pod %s (pid %d): %w", podName, pid, err)
+		}
+	}
+
+	klog.Infof("[MigratePodPartial] 成功迁移 pod %s (pids: %v) %d/%d 字节 从节点 %s 到节点 %s", podName, pids, moved, bytes, srcNode, dstNode)
+	klog.Infof("[MigratePodPartial] 迁移耗时: %s", time.Since(startTime))
+	return moved, nil
+}
+
+// 解析NUMA节点列表，格式与migratepages一致，如 "0,1" 或 "0-2"
+func parseNodeList(nodes string) ([]int, error) {
+	var result []int
+	for part := range strings.SplitSeq(nodes, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node list %q: %w", nodes, err)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("invalid node list %q: %w", nodes, err)
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid node list %q: range %s is reversed", nodes, part)
+			}
+		}
+		for id := start; id <= end; id++ {
+			result = append(result, id)
+		}
+	}
+	return result, nil
 }
@@ -0,0 +1,34 @@
+package memory_manager
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseNodeList(t *testing.T) {
+	tests := []struct {
+		nodes   string
+		want    []int
+		wantErr bool
+	}{
+		{nodes: "", want: nil},
+		{nodes: "2", want: []int{2}},
+		{nodes: "0,1", want: []int{0, 1}},
+		{nodes: "0-2", want: []int{0, 1, 2}},
+		{nodes: " 0 , 2-3 ,", want: []int{0, 2, 3}},
+		{nodes: "3-1", wantErr: true},
+		{nodes: "a", wantErr: true},
+		{nodes: "0-", wantErr: true},
+		{nodes: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseNodeList(tt.nodes)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNodeList(%q) error = %v, wantErr %v", tt.nodes, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseNodeList(%q) = %v, want %v", tt.nodes, got, tt.want)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/audit"
 	"liuyang/colocation-memory-device-plugin/pkg/common"
 	"os"
 	"os/exec"
@@ -24,6 +25,7 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
@@ -32,7 +34,8 @@ import (
 )
 
 // TODO: 后续放在Pod: 确保Pod的ServiceAccount具有相应的RBAC权限，能够访问Kubernetes API
-func (m *MemoryManager) WatchPods() {
+// ctx取消后停止监听，并让等待中的Pod协程退出
+func (m *MemoryManager) WatchPods(ctx context.Context) {
 	klog.Info("[WatchPods] 监听Pod事件...")
 	// 加载 kubeconfig
 	config, err := clientcmd.BuildConfigFromFlags("", common.KubeConfigPath)
@@ -47,7 +50,7 @@ func (m *MemoryManager) WatchPods() {
 
 	// 监听混部Pod事件
 	// 混部任务有个专门的namespace: "colocation-memory"
-	pods, err := clientset.CoreV1().Pods("colocation-memory").List(context.Background(), metav1.ListOptions{})
+	pods, err := clientset.CoreV1().Pods("colocation-memory").List(ctx, metav1.ListOptions{})
 	if err != nil {
 		klog.Error("[WatchPods] list error: ", err)
 		return
@@ -56,32 +59,43 @@ func (m *MemoryManager) WatchPods() {
 	// 获取最新的 resourceVersion
 	rv := pods.ResourceVersion
 
-	watcher, err := clientset.CoreV1().Pods("colocation-memory").Watch(context.Background(), metav1.ListOptions{
+	watcher, err := clientset.CoreV1().Pods("colocation-memory").Watch(ctx, metav1.ListOptions{
 		ResourceVersion: rv,
 	})
 
 	if err != nil {
 		klog.Error("[WatchPods] ", err)
+		return
 	}
 	defer watcher.Stop()
-	for event := range watcher.ResultChan() {
-		pod, ok := event.Object.(*v1.Pod)
-		if !ok {
-			klog.Error("[WatchPods] unexpected type")
-			continue
-		}
+	for {
+		select {
+		case <-ctx.Done():
+			klog.Info("[WatchPods] 停止监听Pod事件")
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				klog.Warning("[WatchPods] Pod事件通道已关闭")
+				return
+			}
+			pod, ok := event.Object.(*v1.Pod)
+			if !ok {
+				klog.Error("[WatchPods] unexpected type")
+				continue
+			}
 
-		switch event.Type {
-		case watch.Added:
-			m.handlePodAdded(clientset, pod.Namespace, pod.Name)
-		case watch.Deleted:
-			m.handlePodDeleted(pod.Name)
+			switch event.Type {
+			case watch.Added:
+				m.handlePodAdded(ctx, clientset, pod.Namespace, pod.Name)
+			case watch.Deleted:
+				m.handlePodDeleted(pod.Name)
+			}
 		}
 	}
 }
 
 // 等待 Pod 进入 Running 状态，然后执行 `env` 命令获取运行时环境变量
-func (m *MemoryManager) waitForPodAndFetchDevIds(clientset *kubernetes.Clientset, config string, namespace, podName string) {
+func (m *MemoryManager) waitForPodAndFetchDevIds(ctx context.Context, clientset *kubernetes.Clientset, config string, namespace, podName string) {
 	// 等待 Pod 进入 Running 状态
 	// Pod创建事件 -> Pod创建成功
 	// 这里有个时序问题，如果在等待Pod进入running的时候还没更新ColocMetaData，device monitor的判断就会出问题
@@ -89,11 +103,13 @@ func (m *MemoryManager) waitForPodAndFetchDevIds(clientset *kubernetes.Clientset
 	defer func() {
 		m.PodCreateRunning.Store(false)
 	}()
-	err := wait.PollImmediate(2*time.Second, 60*time.Second, func() (bool, error) {
-		pod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), podName, metav1.GetOptions{})
+	var podUID types.UID
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, 60*time.Second, true, func(ctx context.Context) (bool, error) {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 		if err != nil {
 			return false, err
 		}
+		podUID = pod.UID
 		return pod.Status.Phase == v1.PodRunning, nil
 	})
 
@@ -108,47 +124,28 @@ func (m *MemoryManager) waitForPodAndFetchDevIds(clientset *kubernetes.Clientset
 		klog.Errorf("[waitForPodAndFetchEnv] Failed to get environment variables from Pod %s/%s: %v\n", namespace, podName, err)
 		return
 	}
-	numOfDevices := m.processPodEnvVars(envVars, podName)
+	m.mu.Lock()
+	numOfDevices := m.processPodEnvVars(envVars, namespace, podName)
+	if podInfo, ok := m.Pod2PodInfo[podName]; ok {
+		podInfo.UID = podUID
+	}
+	m.mu.Unlock()
 	pid := m.inspectPodCgroup(podName)
 
-	klog.Info("[waitForPodAndFetchEnv] Pod2PodInfo update: ", m.Pod2PodInfo[podName])
-
 	m.setCgroupsMemoryLimit(pid, common.BlockSize*numOfDevices)
 }
 
 func (m *MemoryManager) setCgroupsMemoryLimit(pid int, limit int) {
-	cgroupFile := fmt.Sprintf("/proc/%s/cgroup", fmt.Sprintf("%d", pid))
-	data, err := os.ReadFile(cgroupFile)
+	// 为了防止OOM容器重启后memory.max被重置，这里设置的是Pod级别cgroup(容器cgroup的父目录)的memory.max
+	// 例如cgroup是/sys/fs/cgroup/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-podc02daf39_1e4d_448a_a551_1a6080a293ac.slice/cri-containerd-f83b2fb4148c0269b10e181fcae93693c2a1259fa37b0fe2a88937e0f26e9470.scope
+	// 那么应该设置kubepods-besteffort-podc02daf39_1e4d_448a_a551_1a6080a293ac.slice下的memory.max
+	podCgroupPath, err := GetPodCgroupPath(pid)
 	if err != nil {
 		klog.Error("[setCgroupsMemoryLimit] ", err)
 		return
 	}
-	klog.Info("[setCgroupsMemoryLimit] Read cgroup file: ", string(data))
-
-	var cgroupPath string
-	lines := strings.SplitSeq(string(data), "\n")
-	for line := range lines {
-		if strings.HasPrefix(line, "0::") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 3 {
-				cgroupPath = parts[2]
-			}
-			break
-		}
-	}
-
-	if cgroupPath == "" {
-		klog.Error("[setCgroupsMemoryLimit] Failed to find cgroup path for PID ", pid)
-		return
-	}
 
-	// 为了防止OOM容器重启后memory.max被重置，这里设置的是父目录的memory.max
-	// 例如cgroup是/sys/fs/cgroup/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-podc02daf39_1e4d_448a_a551_1a6080a293ac.slice/cri-containerd-f83b2fb4148c0269b10e181fcae93693c2a1259fa37b0fe2a88937e0f26e9470.scope
-	// 那么应该设置kubepods-besteffort-podc02daf39_1e4d_448a_a551_1a6080a293ac.slice下的memory.max
-
-	fullPath := filepath.Join("/sys/fs/cgroup", cgroupPath)
-	parentDir := filepath.Dir(fullPath)
-	err = os.WriteFile(filepath.Join(parentDir, "memory.max"), fmt.Appendf(nil, "%d", limit), 0644)
+	err = os.WriteFile(filepath.Join(podCgroupPath, "memory.max"), fmt.Appendf(nil, "%d", limit), 0644)
 	if err != nil {
 		klog.Error("[setCgroupsMemoryLimit] ", err)
 		return
@@ -185,12 +182,13 @@ func (m *MemoryManager) getPodEnvVars(kubeconfig, namespace, podName string) (ma
 	return envVars, nil
 }
 
-// 处理 Pod 的环境变量
-func (m *MemoryManager) processPodEnvVars(envVars map[string]string, podName string) int {
+// 处理 Pod 的环境变量，调用方持有m.mu
+func (m *MemoryManager) processPodEnvVars(envVars map[string]string, namespace, podName string) int {
 	cnt := 0
 	if resource, ok := envVars[common.ResourceName]; ok {
 		podInfo := &PodInfo{
 			Name:         podName,
+			Namespace:    namespace,
 			BindColocIds: []string{},
 			Pid:          -1,
 			SwapColocIds: []string{},
@@ -200,6 +198,7 @@ func (m *MemoryManager) processPodEnvVars(envVars map[string]string, podName str
 		for devId := range devIds {
 			m.updateDeviceMetadata(devId, podName, true)
 			podInfo.BindColocIds = append(podInfo.BindColocIds, devId)
+			m.Audit.Log(audit.Record{Event: audit.EventBound, Block: devId, Pod: podName, Tier: TierDRAM, Reason: "pod_started"})
 			cnt++
 		}
 
@@ -229,7 +228,22 @@ func (m *MemoryManager) inspectPodCgroup(podName string) int {
 		return -1
 	}
 
-	m.Pod2PodInfo[podName].Pid = pid
+	// 记录Pod级别的cgroup，迁移时需要迁移cgroup下的所有进程
+	cgroupPath, err := GetPodCgroupPath(pid)
+	if err != nil {
+		klog.Errorf("[inspectPodCgroup] %v", err)
+	}
+
+	// 执行crictl期间Pod可能已经删除
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	podInfo, ok := m.Pod2PodInfo[podName]
+	if !ok {
+		return -1
+	}
+	podInfo.Pid = pid
+	podInfo.CgroupPath = cgroupPath
+	klog.Info("[inspectPodCgroup] Pod2PodInfo update: ", podInfo)
 	return pid
 }
 
@@ -281,7 +295,7 @@ func (m *MemoryManager) getContainerPid(containerID string) (int, error) {
 	return inspectResult.Info.Pid, nil
 }
 
-// 更新设备元数据
+// 更新设备元数据，调用方持有m.mu
 func (m *MemoryManager) updateDeviceMetadata(devId, podName string, used bool) {
 	if meta, ok := m.Uuid2ColocMetaData[devId]; ok {
 		meta.BindPod = podName
@@ -290,22 +304,52 @@ func (m *MemoryManager) updateDeviceMetadata(devId, podName string, used bool) {
 	}
 }
 
-// 删除 Pod 和设备 ID 的映射关系
+// 删除 Pod 和设备 ID 的映射关系，调用方持有m.mu
 func (m *MemoryManager) removePodDeviceMapping(podName string) {
-	for _, devId := range m.Pod2PodInfo[podName].BindColocIds {
+	podInfo, ok := m.Pod2PodInfo[podName]
+	if !ok {
+		return
+	}
+	for _, devId := range podInfo.BindColocIds {
 		m.updateDeviceMetadata(devId, "", false)
+		m.Audit.Log(audit.Record{Event: audit.EventReleased, Block: devId, Pod: podName, Tier: TierDRAM, Reason: "pod_deleted"})
+	}
+	// 交换出去的块已经不在设备列表中，Pod删除后不再迁回
+	for _, devId := range podInfo.SwapColocIds {
+		m.Audit.Log(audit.Record{Event: audit.EventDeleted, Block: devId, Pod: podName, Tier: TierCXL, Reason: "pod_deleted"})
 	}
 	delete(m.Pod2PodInfo, podName)
 }
 
 // 处理 Pod 创建事件
-func (m *MemoryManager) handlePodAdded(clientset *kubernetes.Clientset, namespace, podName string) {
+func (m *MemoryManager) handlePodAdded(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) {
 	klog.Infof("[handlePodAdded] Pod created: %s/%s", namespace, podName)
-	go m.waitForPodAndFetchDevIds(clientset, common.KubeConfigPath, namespace, podName)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.waitForPodAndFetchDevIds(ctx, clientset, common.KubeConfigPath, namespace, podName)
+	}()
+}
+
+// AddPod 登记使用devIds的混部Pod，不经过API Server，供模拟器使用
+func (m *MemoryManager) AddPod(namespace, podName string, devIds []string, pid int) *PodInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.processPodEnvVars(map[string]string{common.ResourceName: strings.Join(devIds, ",")}, namespace, podName)
+	podInfo := m.Pod2PodInfo[podName]
+	podInfo.Pid = pid
+	return podInfo
+}
+
+// RemovePod 删除混部Pod并释放其绑定的块
+func (m *MemoryManager) RemovePod(podName string) {
+	m.handlePodDeleted(podName)
 }
 
 // 处理 Pod 删除事件
 func (m *MemoryManager) handlePodDeleted(podName string) {
 	klog.Infof("[handlePodDeleted] Pod deleted: %s", podName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.removePodDeviceMapping(podName)
 }
@@ -0,0 +1,68 @@
+package memory_manager
+
+/**
+author:liuyang
+date:2025-5-25
+节点和进程内存信息的读取接口，默认读取sysfs、procfs和cgroup，模拟器中替换为合成数据
+*/
+
+import (
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"path"
+)
+
+type SystemReader interface {
+	// NumaMemInfo 读取NUMA节点的内存信息
+	NumaMemInfo(node int) (NumaMemInfo, error)
+	// PodsUsage 读取kubepods各QoS类别的内存使用量，按配置的核算方式计算
+	PodsUsage() (QoSUsage, error)
+	// CgroupMemoryUsage 读取Pod级别cgroup的内存使用量，核算方式与PodsUsage相同
+	CgroupMemoryUsage(cgroupPath string) (uint64, error)
+	// ProcessNumaUsage 读取进程在各NUMA节点上的驻留字节数，共享的文件页面单独列出，汇总Pod时只计算一次
+	ProcessNumaUsage(pid int) (*NumaMapsUsage, error)
+}
+
+// HostSystem 读取当前节点的真实数据，使用working set核算cgroup内存
+var HostSystem SystemReader = hostSystem{accounting: common.MemoryAccountingWorkingSet}
+
+// NewHostSystem 使用指定的核算方式读取cgroup内存，见common.MemoryAccounting*
+func NewHostSystem(accounting string) (SystemReader, error) {
+	switch accounting {
+	case common.MemoryAccountingWorkingSet, common.MemoryAccountingAnon, common.MemoryAccountingCurrent:
+		return hostSystem{accounting: accounting}, nil
+	default:
+		return nil, fmt.Errorf("unknown memory accounting mode %q", accounting)
+	}
+}
+
+type hostSystem struct {
+	accounting string
+}
+
+func (hostSystem) NumaMemInfo(node int) (NumaMemInfo, error) {
+	return GetNumaMemInfo(node)
+}
+
+func (h hostSystem) PodsUsage() (QoSUsage, error) {
+	var usage QoSUsage
+	var err error
+	if usage.Total, err = GetCgroupMemoryUsage(common.K8sPodsBasePath, h.accounting); err != nil {
+		return usage, err
+	}
+	if usage.Burstable, err = GetCgroupMemoryUsage(path.Join(common.K8sPodsBasePath, common.BurstablePath), h.accounting); err != nil {
+		return usage, err
+	}
+	if usage.BestEffort, err = GetCgroupMemoryUsage(path.Join(common.K8sPodsBasePath, common.BestEffortPath), h.accounting); err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+func (h hostSystem) CgroupMemoryUsage(cgroupPath string) (uint64, error) {
+	return GetCgroupMemoryUsage(cgroupPath, h.accounting)
+}
+
+func (hostSystem) ProcessNumaUsage(pid int) (*NumaMapsUsage, error) {
+	return GetProcessNumaUsage(pid)
+}
@@ -0,0 +1,165 @@
+package metrics
+
+/**
+author:liuyang
+date:2025-5-16
+Prometheus指标，暴露混部内存、块状态、迁移和兜底等信息
+*/
+
+import (
+	"context"
+	"errors"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+)
+
+const namespace = "colocation_memory"
+
+// 块状态
+const (
+	BlockStateFree    = "free"    // 空闲
+	BlockStateBound   = "bound"   // 已绑定Pod
+	BlockStateSwapped = "swapped" // 已交换到池化内存
+)
+
+// 迁移方向
+const (
+	DirectionSwapOut = "swap_out"
+	DirectionSwapIn  = "swap_in"
+)
+
+// 结果标签
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	TotalMemoryBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "total_memory_bytes",
+		Help:      "Total DRAM of the NUMA nodes used for colocation.",
+	})
+	OnlinePodsUsedBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "online_pods_used_bytes",
+		Help:      "Memory used by online pods.",
+	})
+	SafetyMarginBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "safety_margin_bytes",
+		Help:      "Memory reserved as safety margin.",
+	})
+	ColocMemoryBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "available_bytes",
+		Help:      "Memory available for colocation pods.",
+	})
+	Blocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "blocks",
+		Help:      "Number of colocation memory blocks after the last adjustment.",
+	})
+	BlocksByState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "blocks_by_state",
+		Help:      "Number of colocation memory blocks by state.",
+	}, []string{"state"})
+
+	ListAndWatchUpdates = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "list_and_watch_updates_total",
+		Help:      "Number of device list updates sent to kubelet.",
+	})
+	Migrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "migrations_total",
+		Help:      "Number of pod memory migrations by direction and result.",
+	}, []string{"direction", "result"})
+	MigrationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "migration_duration_seconds",
+		Help:      "Duration of successful pod memory migrations.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"direction"})
+	Fallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fallbacks_total",
+		Help:      "Number of fallback actions taken when the pooled memory node is full, by action and result.",
+	}, []string{"action", "result"})
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of device plugin RPCs called by kubelet.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// Registry 插件自己的指标注册表，避免引入client-go等依赖注册到默认注册表的指标
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		TotalMemoryBytes,
+		OnlinePodsUsedBytes,
+		SafetyMarginBytes,
+		ColocMemoryBytes,
+		Blocks,
+		BlocksByState,
+		ListAndWatchUpdates,
+		Migrations,
+		MigrationDuration,
+		Fallbacks,
+		RPCDuration,
+	)
+}
+
+// ObserveRPC 记录RPC耗时，用法: defer metrics.ObserveRPC("Allocate", time.Now())
+func ObserveRPC(method string, start time.Time) {
+	RPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// Result 把错误转换为结果标签
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+// Serve 在addr上启动/metrics，addr为空时不启动，ctx取消后关闭
+func Serve(ctx context.Context, addr string) {
+	if addr == "" {
+		klog.Info("[metrics] 未配置监听地址, 不启动指标服务")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		klog.Infof("[metrics] 指标服务监听 %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("[metrics] 指标服务退出: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), common.ShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+}
@@ -0,0 +1,195 @@
+package node_status
+
+/**
+author:liuyang
+date:2025-5-8
+把混部内存压力以NodeCondition和污点的形式发布到Node对象上
+混部内存耗尽或发生交换时进入压力状态，容量连续多次恢复后才解除(滞后)，避免条件来回抖动
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"liuyang/colocation-memory-device-plugin/pkg/utils"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ReasonMemoryExhausted = "ColocationMemoryExhausted" // 可用混部内存为0
+	ReasonPodsSwappedOut  = "ColocationPodsSwappedOut"  // 发生了交换或驱逐
+	ReasonMemoryAvailable = "ColocationMemoryAvailable" // 容量恢复
+
+	// 条件没有变化时的心跳间隔
+	heartbeatInterval = time.Minute
+)
+
+type PressureReporter struct {
+	clientset     kubernetes.Interface
+	nodeName      string
+	taint         bool // 是否同时管理压力污点
+	recoverBlocks int  // 可用块数达到该值才认为容量恢复
+	recoverCount  int  // 连续多少次决策容量恢复才解除压力
+
+	// 以下字段由Report的调用方在d.mm.Lock()下访问
+	pressure  bool   // 当前是否处于压力状态
+	recovered int    // 连续恢复的决策次数
+	reason    string // 当前的原因
+
+	// 以下字段只由worker的后台协程访问
+	reportedReason string    // 上次上报的原因
+	reported       bool      // 上次上报的条件状态
+	lastHeartbeat  time.Time // 上次上报时间
+
+	worker *pushWorker
+}
+
+// 一次待上报的压力状态，在锁内生成，在锁外上报
+type pressureState struct {
+	pressure bool
+	reason   string
+	message  string
+}
+
+func NewPressureReporter(config *common.Config) (*PressureReporter, error) {
+	// 加载 kubeconfig
+	restConfig, err := clientcmd.BuildConfigFromFlags("", common.KubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPressureReporter(clientset, config), nil
+}
+
+func newPressureReporter(clientset kubernetes.Interface, config *common.Config) *PressureReporter {
+	return &PressureReporter{
+		clientset:     clientset,
+		nodeName:      config.NodeName,
+		taint:         config.PressureTaint,
+		recoverBlocks: config.PressureRecoverBlocks,
+		recoverCount:  config.PressureRecoverCount,
+		worker:        newPushWorker(common.ConnectTimeout),
+	}
+}
+
+// Report 根据最近一次adjustDevices的决策计算压力状态，条件和污点由后台协程异步更新，不等待API Server
+func (r *PressureReporter) Report(decision *memory_manager.AdjustDecision) {
+	if decision == nil {
+		return
+	}
+
+	state := r.evaluate(decision)
+	r.worker.Submit(func(ctx context.Context) {
+		r.push(ctx, state)
+	})
+}
+
+// Close 等待最后一次上报完成
+func (r *PressureReporter) Close() {
+	r.worker.Close()
+}
+
+// 原因变化或条件状态变化时立即更新，原因不变时只在心跳到期时刷新消息和心跳时间
+func (r *PressureReporter) push(ctx context.Context, state pressureState) {
+	if state.reason == r.reportedReason && time.Since(r.lastHeartbeat) < heartbeatInterval {
+		return
+	}
+
+	// 原因变化时记录日志，条件的状态变化(包括首次上报)时更新lastTransitionTime和污点
+	transition := state.reason != r.reportedReason
+	statusChanged := r.lastHeartbeat.IsZero() || state.pressure != r.reported
+	if err := r.patchCondition(ctx, state, statusChanged); err != nil {
+		klog.Errorf("[PressureReporter] 更新节点 %s 的条件失败: %v", r.nodeName, err)
+		return
+	}
+	if r.taint && statusChanged {
+		if _, err := utils.PatchNodeTaint(ctx, r.clientset, r.nodeName, common.PressureTaintKey, state.pressure); err != nil {
+			klog.Errorf("[PressureReporter] 更新节点 %s 的污点失败: %v", r.nodeName, err)
+			return
+		}
+	}
+	if transition {
+		klog.Infof("[PressureReporter] 节点 %s 混部内存压力: %v, 原因: %s, %s", r.nodeName, state.pressure, state.reason, state.message)
+	}
+	r.reportedReason = state.reason
+	r.reported = state.pressure
+	r.lastHeartbeat = time.Now()
+}
+
+// 计算压力状态，进入压力是立即的，解除压力需要连续recoverCount次容量恢复
+func (r *PressureReporter) evaluate(decision *memory_manager.AdjustDecision) pressureState {
+	message := decision.String()
+
+	switch {
+	case decision.ColocMemory == 0:
+		r.pressure = true
+		r.recovered = 0
+		r.reason = ReasonMemoryExhausted
+	case decision.HasSwapOut():
+		r.pressure = true
+		r.recovered = 0
+		r.reason = ReasonPodsSwappedOut
+	case !r.pressure:
+		r.reason = ReasonMemoryAvailable
+	default:
+		if decision.CurrentBlocks >= r.recoverBlocks {
+			r.recovered++
+		} else {
+			r.recovered = 0
+		}
+		if r.recovered < r.recoverCount {
+			// 还在滞后区间内，保持原来的原因
+			message = fmt.Sprintf("%s (recovering %d/%d)", message, r.recovered, r.recoverCount)
+			break
+		}
+		r.pressure = false
+		r.recovered = 0
+		r.reason = ReasonMemoryAvailable
+	}
+	return pressureState{pressure: r.pressure, reason: r.reason, message: message}
+}
+
+// 通过strategic merge patch更新Node的status.conditions，statusChanged时更新lastTransitionTime
+func (r *PressureReporter) patchCondition(ctx context.Context, state pressureState, statusChanged bool) error {
+	now := metav1.Now()
+	status := corev1.ConditionFalse
+	if state.pressure {
+		status = corev1.ConditionTrue
+	}
+	condition := map[string]any{
+		"type":              common.PressureConditionType,
+		"status":            status,
+		"reason":            state.reason,
+		"message":           state.message,
+		"lastHeartbeatTime": now,
+	}
+	// 首次上报时也需要设置lastTransitionTime
+	if statusChanged {
+		condition["lastTransitionTime"] = now
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"conditions": []any{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.clientset.CoreV1().Nodes().PatchStatus(ctx, r.nodeName, patch)
+	return err
+}
@@ -0,0 +1,143 @@
+package node_status
+
+import (
+	"context"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNodeName = "node-1"
+
+func newTestReporter(t *testing.T, node *corev1.Node) (*PressureReporter, *fake.Clientset) {
+	t.Helper()
+	clientset := fake.NewSimpleClientset(node)
+	r := newPressureReporter(clientset, &common.Config{
+		NodeName:              testNodeName,
+		PressureTaint:         true,
+		PressureRecoverBlocks: 4,
+		PressureRecoverCount:  2,
+	})
+	t.Cleanup(r.Close)
+	return r, clientset
+}
+
+func testNode(taints ...corev1.Taint) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: testNodeName},
+		Spec:       corev1.NodeSpec{Taints: taints},
+	}
+}
+
+// 进入压力是立即的，可用块数连续recoverCount次达到recoverBlocks才解除，中途不足时重新计数
+func TestEvaluateHysteresis(t *testing.T) {
+	r := &PressureReporter{recoverBlocks: 4, recoverCount: 2}
+
+	steps := []struct {
+		name     string
+		decision memory_manager.AdjustDecision
+		pressure bool
+		reason   string
+	}{
+		{"available", memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 8}, false, ReasonMemoryAvailable},
+		{"exhausted", memory_manager.AdjustDecision{ColocMemory: 0}, true, ReasonMemoryExhausted},
+		{"recovering 1/2", memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 4}, true, ReasonMemoryExhausted},
+		{"below recoverBlocks resets", memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 3}, true, ReasonMemoryExhausted},
+		{"recovering 1/2 again", memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 5}, true, ReasonMemoryExhausted},
+		{"recovered", memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 5}, false, ReasonMemoryAvailable},
+		{"swap out", memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 8, SwappedBlocks: 1}, true, ReasonPodsSwappedOut},
+		{"swap out recovering", memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 8}, true, ReasonPodsSwappedOut},
+		{"exhausted during recovery", memory_manager.AdjustDecision{ColocMemory: 0}, true, ReasonMemoryExhausted},
+	}
+	for _, step := range steps {
+		state := r.evaluate(&step.decision)
+		if state.pressure != step.pressure || state.reason != step.reason {
+			t.Fatalf("%s: got pressure=%v reason=%s, want pressure=%v reason=%s",
+				step.name, state.pressure, state.reason, step.pressure, step.reason)
+		}
+	}
+}
+
+// 条件状态变化时更新lastTransitionTime和污点，原因不变时在心跳间隔内不重复写API Server，其它污点保持不变
+func TestReportConditionAndTaintTransitions(t *testing.T) {
+	other := corev1.Taint{Key: "example.com/other", Effect: corev1.TaintEffectNoExecute}
+	r, clientset := newTestReporter(t, testNode(other))
+
+	report := func(decision memory_manager.AdjustDecision) {
+		r.Report(&decision)
+		r.worker.wait()
+	}
+	check := func(step string, status corev1.ConditionStatus, reason string, tainted bool) *corev1.NodeCondition {
+		t.Helper()
+		node, err := clientset.CoreV1().Nodes().Get(context.Background(), testNodeName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s: get node: %v", step, err)
+		}
+		var condition *corev1.NodeCondition
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == common.PressureConditionType {
+				condition = &node.Status.Conditions[i]
+			}
+		}
+		if condition == nil {
+			t.Fatalf("%s: condition %s not found", step, common.PressureConditionType)
+		}
+		if condition.Status != status || condition.Reason != reason {
+			t.Errorf("%s: got condition %s/%s, want %s/%s", step, condition.Status, condition.Reason, status, reason)
+		}
+		hasPressure, hasOther := false, false
+		for _, taint := range node.Spec.Taints {
+			hasPressure = hasPressure || taint.Key == common.PressureTaintKey
+			hasOther = hasOther || taint.Key == other.Key
+		}
+		if hasPressure != tainted {
+			t.Errorf("%s: got pressure taint %v, want %v", step, hasPressure, tainted)
+		}
+		if !hasOther {
+			t.Errorf("%s: taint %s was removed", step, other.Key)
+		}
+		return condition
+	}
+
+	report(memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 8})
+	first := check("initial", corev1.ConditionFalse, ReasonMemoryAvailable, false)
+	if first.LastTransitionTime.IsZero() {
+		t.Errorf("initial: lastTransitionTime not set")
+	}
+
+	report(memory_manager.AdjustDecision{ColocMemory: 0})
+	check("exhausted", corev1.ConditionTrue, ReasonMemoryExhausted, true)
+
+	// 原因不变，心跳间隔内不写API Server
+	clientset.ClearActions()
+	report(memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 4})
+	if actions := clientset.Actions(); len(actions) != 0 {
+		t.Errorf("unchanged reason: got %d actions, want 0", len(actions))
+	}
+
+	report(memory_manager.AdjustDecision{ColocMemory: 1, CurrentBlocks: 4})
+	check("recovered", corev1.ConditionFalse, ReasonMemoryAvailable, false)
+
+	// 污点通过merge patch写入，不整体更新Node对象
+	clientset.ClearActions()
+	report(memory_manager.AdjustDecision{ColocMemory: 1, SwappedBlocks: 1})
+	check("swapped out", corev1.ConditionTrue, ReasonPodsSwappedOut, true)
+	taintPatched := false
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("unexpected update of %s", action.GetResource().Resource)
+		}
+		if patch, ok := action.(k8stesting.PatchAction); ok && patch.GetSubresource() == "" {
+			taintPatched = patch.GetPatchType() == types.MergePatchType
+		}
+	}
+	if !taintPatched {
+		t.Errorf("taint not written with a merge patch")
+	}
+}
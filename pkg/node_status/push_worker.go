@@ -0,0 +1,92 @@
+package node_status
+
+/**
+author:liuyang
+date:2025-5-8
+在后台串行执行对API Server的写请求
+上报和发布由adjustOnce在d.mm.Lock()下触发，API Server变慢时不能阻塞内存管理，调用方只提交请求不等待结果
+*/
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pushWorker 只保留最新提交的一个请求，还没执行的旧请求会被新请求替换，每个请求带超时
+type pushWorker struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending func(ctx context.Context) // 等待执行的请求
+	running bool                      // 是否有请求正在执行
+	closed  bool
+	done    chan struct{}
+}
+
+func newPushWorker(timeout time.Duration) *pushWorker {
+	w := &pushWorker{
+		timeout: timeout,
+		done:    make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// Submit 提交一个请求，替换掉还没执行的请求，Close之后提交的请求被丢弃
+func (w *pushWorker) Submit(push func(ctx context.Context)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.pending = push
+	w.cond.Broadcast()
+}
+
+// Close 执行完已提交的请求后停止后台协程
+func (w *pushWorker) Close() {
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-w.done
+}
+
+// 等待已提交的请求全部执行完
+func (w *pushWorker) wait() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.pending != nil || w.running {
+		w.cond.Wait()
+	}
+}
+
+func (w *pushWorker) run() {
+	defer close(w.done)
+	for {
+		w.mu.Lock()
+		for w.pending == nil && !w.closed {
+			w.cond.Wait()
+		}
+		push := w.pending
+		w.pending = nil
+		if push == nil {
+			w.mu.Unlock()
+			return
+		}
+		w.running = true
+		w.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+		push(ctx)
+		cancel()
+
+		w.mu.Lock()
+		w.running = false
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
@@ -0,0 +1,168 @@
+package node_status
+
+/**
+author:liuyang
+date:2025-5-10
+把内存管理器的块绑定和交换状态发布到ColocationMemoryNode对象的status，方便通过kubectl get查看
+*/
+
+import (
+	"context"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+type StatusPublisher struct {
+	client      dynamic.Interface
+	nodeName    string
+	minInterval time.Duration // 两次更新的最小间隔
+	lastPublish time.Time     // 上次提交更新的时间，由Publish的调用方在d.mm.Lock()下访问
+
+	worker *pushWorker
+}
+
+func NewStatusPublisher(config *common.Config) (*StatusPublisher, error) {
+	// 加载 kubeconfig
+	restConfig, err := clientcmd.BuildConfigFromFlags("", common.KubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStatusPublisher(client, config), nil
+}
+
+func newStatusPublisher(client dynamic.Interface, config *common.Config) *StatusPublisher {
+	return &StatusPublisher{
+		client:      client,
+		nodeName:    config.NodeName,
+		minInterval: config.StatusUpdateInterval,
+		worker:      newPushWorker(common.ConnectTimeout),
+	}
+}
+
+// Publish 在调用方持有的锁内构造状态，由后台协程更新ColocationMemoryNode，距离上次提交不足minInterval时跳过
+// 更新失败时等到下一个minInterval再重试
+func (p *StatusPublisher) Publish(mm *memory_manager.MemoryManager) {
+	if time.Since(p.lastPublish) < p.minInterval {
+		return
+	}
+
+	status, err := toUnstructured(BuildStatus(mm))
+	if err != nil {
+		klog.Errorf("[StatusPublisher] 转换状态失败: %v", err)
+		return
+	}
+
+	p.lastPublish = time.Now()
+	p.worker.Submit(func(ctx context.Context) {
+		if err := p.updateStatus(ctx, status); err != nil {
+			klog.Errorf("[StatusPublisher] 更新 %s 状态失败: %v", p.nodeName, err)
+		}
+	})
+}
+
+// Flush 忽略minInterval立即发布，用于退出前写入最终状态
+func (p *StatusPublisher) Flush(mm *memory_manager.MemoryManager) {
+	p.lastPublish = time.Time{}
+	p.Publish(mm)
+}
+
+// Close 等待已提交的状态写入完成
+func (p *StatusPublisher) Close() {
+	p.worker.Close()
+}
+
+func (p *StatusPublisher) updateStatus(ctx context.Context, status map[string]any) error {
+	resource := p.client.Resource(ColocationMemoryNodeGVR)
+
+	obj, err := resource.Get(ctx, p.nodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		obj = &unstructured.Unstructured{}
+		obj.SetAPIVersion(ColocationMemoryNodeGVR.GroupVersion().String())
+		obj.SetKind(ColocationMemoryNodeKind)
+		obj.SetName(p.nodeName)
+		obj, err = resource.Create(ctx, obj, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	obj.Object["status"] = status
+	_, err = resource.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// 通过JSON转换成unstructured，字节数等uint64字段转换成int64，ToUnstructured会保留uint64，DeepCopy时panic
+func toUnstructured(status *ColocationMemoryNodeStatus) (map[string]any, error) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// BuildStatus 根据内存管理器的当前状态构造status
+func BuildStatus(mm *memory_manager.MemoryManager) *ColocationMemoryNodeStatus {
+	status := &ColocationMemoryNodeStatus{
+		TotalBytes:       mm.TotalMemory,
+		OnlineBytes:      mm.OnlinePodsUsed,
+		SafetyBytes:      mm.SafetyMargin,
+		ColocationBytes:  mm.ColocMemory,
+		AdvertisedBlocks: len(mm.Uuid2ColocMetaData),
+		LastUpdateTime:   time.Now().Format(time.RFC3339),
+	}
+
+	for _, meta := range mm.Uuid2ColocMetaData {
+		if meta.Used {
+			status.BoundBlocks++
+		}
+	}
+
+	for _, podInfo := range mm.Pod2PodInfo {
+		status.Pods = append(status.Pods, PodStatus{
+			Name:          podInfo.Name,
+			Namespace:     podInfo.Namespace,
+			BoundBlocks:   len(podInfo.BindColocIds),
+			SwappedBlocks: len(podInfo.SwapColocIds),
+			SwappedBytes:  podInfo.SwappedBytes,
+			Tier:          podInfo.Tier(),
+			SwapNode:      podInfo.SwapNode,
+		})
+	}
+	sort.Slice(status.Pods, func(i, j int) bool {
+		return status.Pods[i].Name < status.Pods[j].Name
+	})
+
+	if d := mm.LastDecision; d != nil {
+		status.LastDecision = &DecisionStatus{
+			Time:          d.Time.Format(time.RFC3339),
+			Action:        d.Action(),
+			PrevBlocks:    d.PrevBlocks,
+			CurrentBlocks: d.CurrentBlocks,
+			SwappedPods:   d.SwappedPods,
+			EvictedPods:   d.EvictedPods,
+			SkippedPods:   d.SkippedPods,
+			Summary:       d.String(),
+		}
+	}
+	return status
+}
@@ -0,0 +1,143 @@
+package node_status
+
+import (
+	"context"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func testMemoryManager() *memory_manager.MemoryManager {
+	return &memory_manager.MemoryManager{
+		TotalMemory:    64 << 30,
+		OnlinePodsUsed: 20 << 30,
+		SafetyMargin:   4 << 30,
+		ColocMemory:    8 << 30,
+		Uuid2ColocMetaData: map[string]*memory_manager.ColocMemoryBlockMetaData{
+			"a": {Uuid: "a", Used: true, BindPod: "web"},
+			"b": {Uuid: "b", Used: true, BindPod: "batch"},
+			"c": {Uuid: "c", Used: true, BindPod: "batch"},
+			"d": {Uuid: "d"},
+		},
+		Pod2PodInfo: map[string]*memory_manager.PodInfo{
+			"web":   {Name: "web", Namespace: "default", BindColocIds: []string{"a"}},
+			"batch": {Name: "batch", Namespace: "jobs", BindColocIds: []string{"b"}, SwapColocIds: []string{"c"}, SwappedBytes: 1 << 30, SwapNode: "2"},
+		},
+		LastDecision: &memory_manager.AdjustDecision{
+			Time:          time.Date(2025, 5, 10, 8, 0, 0, 0, time.UTC),
+			ColocMemory:   8 << 30,
+			PrevBlocks:    5,
+			CurrentBlocks: 4,
+			SwappedBlocks: 1,
+			SwappedPods:   []string{"batch"},
+		},
+	}
+}
+
+// 状态中的块数来自账本，Pod按名称排序，最近一次决策原样带上
+func TestBuildStatus(t *testing.T) {
+	status := BuildStatus(testMemoryManager())
+
+	if status.TotalBytes != 64<<30 || status.OnlineBytes != 20<<30 || status.SafetyBytes != 4<<30 || status.ColocationBytes != 8<<30 {
+		t.Errorf("got bytes %d/%d/%d/%d", status.TotalBytes, status.OnlineBytes, status.SafetyBytes, status.ColocationBytes)
+	}
+	if status.AdvertisedBlocks != 4 || status.BoundBlocks != 3 {
+		t.Errorf("got advertised=%d bound=%d, want 4/3", status.AdvertisedBlocks, status.BoundBlocks)
+	}
+	wantPods := []PodStatus{
+		{Name: "batch", Namespace: "jobs", BoundBlocks: 1, SwappedBlocks: 1, SwappedBytes: 1 << 30, Tier: memory_manager.TierMixed, SwapNode: "2"},
+		{Name: "web", Namespace: "default", BoundBlocks: 1, Tier: memory_manager.TierDRAM},
+	}
+	if !reflect.DeepEqual(status.Pods, wantPods) {
+		t.Errorf("got pods %+v, want %+v", status.Pods, wantPods)
+	}
+	decision := status.LastDecision
+	if decision == nil {
+		t.Fatalf("lastDecision missing")
+	}
+	if decision.Time != "2025-05-10T08:00:00Z" || decision.Action != "remove" || decision.PrevBlocks != 5 || decision.CurrentBlocks != 4 {
+		t.Errorf("got decision %+v", decision)
+	}
+	if !reflect.DeepEqual(decision.SwappedPods, []string{"batch"}) {
+		t.Errorf("got swapped pods %v, want [batch]", decision.SwappedPods)
+	}
+
+	empty := BuildStatus(&memory_manager.MemoryManager{})
+	if empty.Pods != nil || empty.LastDecision != nil || empty.AdvertisedBlocks != 0 {
+		t.Errorf("got %+v for an empty manager", empty)
+	}
+}
+
+func newTestPublisher(t *testing.T, minInterval time.Duration) (*StatusPublisher, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ColocationMemoryNodeGVR: ColocationMemoryNodeKind + "List"})
+	p := newStatusPublisher(client, &common.Config{NodeName: testNodeName, StatusUpdateInterval: minInterval})
+	t.Cleanup(p.Close)
+	return p, client
+}
+
+func getStatus(t *testing.T, p *StatusPublisher) map[string]any {
+	t.Helper()
+	obj, err := p.client.Resource(ColocationMemoryNodeGVR).Get(context.Background(), testNodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get %s: %v", testNodeName, err)
+	}
+	status, _, _ := unstructured.NestedMap(obj.Object, "status")
+	return status
+}
+
+// 第一次发布时创建对象，minInterval内的发布被跳过，Flush忽略间隔立即发布
+func TestPublishRateLimit(t *testing.T) {
+	p, client := newTestPublisher(t, time.Hour)
+	mm := testMemoryManager()
+
+	p.Publish(mm)
+	p.worker.wait()
+	if got := getStatus(t, p)["boundBlocks"]; got != int64(3) {
+		t.Fatalf("got boundBlocks %v, want 3", got)
+	}
+
+	client.ClearActions()
+	mm.Uuid2ColocMetaData["d"].Used = true
+	p.Publish(mm)
+	p.worker.wait()
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("publish within minInterval: got %d actions, want 0", len(actions))
+	}
+
+	p.Flush(mm)
+	p.worker.wait()
+	if got := getStatus(t, p)["boundBlocks"]; got != int64(4) {
+		t.Errorf("after flush: got boundBlocks %v, want 4", got)
+	}
+}
+
+// 没有间隔限制时每次发布都写入，后台写入的是提交时的状态，不受之后账本变化的影响
+func TestPublishSnapshot(t *testing.T) {
+	p, _ := newTestPublisher(t, 0)
+	mm := testMemoryManager()
+
+	p.Publish(mm)
+	delete(mm.Pod2PodInfo, "web")
+	p.worker.wait()
+	pods, _, _ := unstructured.NestedSlice(getStatus(t, p), "pods")
+	if len(pods) != 2 {
+		t.Errorf("got %d pods, want the 2 pods at submit time", len(pods))
+	}
+
+	p.Publish(mm)
+	p.worker.wait()
+	pods, _, _ = unstructured.NestedSlice(getStatus(t, p), "pods")
+	if len(pods) != 1 {
+		t.Errorf("got %d pods after second publish, want 1", len(pods))
+	}
+}
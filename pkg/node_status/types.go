@@ -0,0 +1,50 @@
+package node_status
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ColocationMemoryNode CRD，集群级别，每个节点一个对象，名称与节点相同
+var ColocationMemoryNodeGVR = schema.GroupVersionResource{
+	Group:    "x.com",
+	Version:  "v1alpha1",
+	Resource: "colocationmemorynodes",
+}
+
+const ColocationMemoryNodeKind = "ColocationMemoryNode"
+
+// ColocationMemoryNodeStatus 节点混部内存状态
+type ColocationMemoryNodeStatus struct {
+	TotalBytes       uint64          `json:"totalBytes"`       // 系统总内存
+	OnlineBytes      uint64          `json:"onlineBytes"`      // 在线任务内存使用量
+	SafetyBytes      uint64          `json:"safetyBytes"`      // 安全水位
+	ColocationBytes  uint64          `json:"colocationBytes"`  // 可用混部内存
+	AdvertisedBlocks int             `json:"advertisedBlocks"` // 上报给kubelet的块数
+	BoundBlocks      int             `json:"boundBlocks"`      // 已绑定Pod的块数
+	Pods             []PodStatus     `json:"pods,omitempty"`
+	LastDecision     *DecisionStatus `json:"lastDecision,omitempty"`
+	LastUpdateTime   string          `json:"lastUpdateTime"`
+}
+
+// PodStatus 混部Pod的块绑定和交换状态
+type PodStatus struct {
+	Name          string `json:"name"`
+	Namespace     string `json:"namespace,omitempty"`
+	BoundBlocks   int    `json:"boundBlocks"`
+	SwappedBlocks int    `json:"swappedBlocks"`
+	SwappedBytes  uint64 `json:"swappedBytes,omitempty"`
+	Tier          string `json:"tier"`
+	SwapNode      string `json:"swapNode,omitempty"`
+}
+
+// DecisionStatus 最近一次adjustDevices的决策
+type DecisionStatus struct {
+	Time          string   `json:"time"`
+	Action        string   `json:"action"`
+	PrevBlocks    int      `json:"prevBlocks"`
+	CurrentBlocks int      `json:"currentBlocks"`
+	SwappedPods   []string `json:"swappedPods,omitempty"`
+	EvictedPods   []string `json:"evictedPods,omitempty"`
+	SkippedPods   []string `json:"skippedPods,omitempty"`
+	Summary       string   `json:"summary"`
+}
@@ -0,0 +1,55 @@
+package simulator
+
+/**
+author:liuyang
+date:2025-5-25
+模拟的兜底驱逐：Pod离开模拟的节点，驻留内存随之释放
+*/
+
+import (
+	"context"
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/device_plugin"
+	"sync"
+)
+
+var _ device_plugin.PodEvictor = &evictor{}
+
+// evictor 在DeviceMonitor的驱逐协程中调用，此时调整可能还持有s.mm.Lock()
+// 先等待锁再修改Machine，Pod的删除事件由模拟器在WaitEvictions之后补发
+type evictor struct {
+	s *Simulator
+
+	mu      sync.Mutex
+	evicted []string // 已经离开节点、等待补发删除事件的Pod
+}
+
+func (e *evictor) MigratePodToAnotherNode(ctx context.Context, _, podName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.s.mm.Lock()
+	defer e.s.mm.Unlock()
+
+	podInfo, ok := e.s.mm.Pod2PodInfo[podName]
+	if !ok {
+		return fmt.Errorf("pod %s not found", podName)
+	}
+	e.s.machine.RemovePod(podInfo.Pid)
+
+	e.mu.Lock()
+	e.evicted = append(e.evicted, podName)
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *evictor) Shutdown(context.Context) {}
+
+// 取出已经驱逐的Pod
+func (e *evictor) drain() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	evicted := e.evicted
+	e.evicted = nil
+	return evicted
+}
@@ -0,0 +1,196 @@
+package simulator
+
+/**
+author:liuyang
+date:2025-5-25
+模拟的节点：维护各NUMA节点的空闲内存和混部Pod的驻留内存
+同时实现memory_manager.SystemReader和PageMigrator，迁移只修改模型中的数据
+*/
+
+import (
+	"errors"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"maps"
+	"os"
+	"slices"
+	"syscall"
+	"time"
+)
+
+var errNoSuchProcess = errors.New("no such process")
+
+type simPod struct {
+	name     string
+	resident map[int]uint64 // 节点 -> 驻留字节数
+}
+
+// 一次迁移，供统计使用
+type migration struct {
+	pod   string
+	toCxl bool   // 迁移到CXL节点为交换出去，否则为迁回
+	bytes uint64 // 实际迁移的字节数
+}
+
+type Machine struct {
+	topo       *memory_manager.NumaTopology
+	nodeFree   map[int]uint64 // 除混部Pod外的空闲内存
+	nodeTotal  map[int]uint64
+	onlineUsed uint64
+	pods       map[int]*simPod // pid -> Pod
+
+	now       time.Duration // 虚拟时钟
+	onMigrate func(migration)
+	pageSize  uint64
+	nextPid   int
+}
+
+func NewMachine(topo *memory_manager.NumaTopology) *Machine {
+	return &Machine{
+		topo:      topo,
+		nodeFree:  make(map[int]uint64),
+		nodeTotal: make(map[int]uint64),
+		pods:      make(map[int]*simPod),
+		pageSize:  uint64(os.Getpagesize()),
+		nextPid:   100000,
+	}
+}
+
+// ApplyUsage 应用usage事件
+func (m *Machine) ApplyUsage(e *Event) {
+	m.onlineUsed = e.OnlineUsed
+	maps.Copy(m.nodeFree, e.NodeFree)
+	maps.Copy(m.nodeTotal, e.NodeTotal)
+}
+
+// AddPod 混部Pod开始运行，驻留内存平均分布在DRAM节点上，返回分配的pid
+func (m *Machine) AddPod(name string, bytes uint64) int {
+	pid := m.nextPid
+	m.nextPid++
+	pod := &simPod{name: name, resident: make(map[int]uint64)}
+	for i, node := range m.topo.DramNodes {
+		share := bytes / uint64(len(m.topo.DramNodes))
+		if i == 0 {
+			share += bytes % uint64(len(m.topo.DramNodes))
+		}
+		pod.resident[node] = share
+	}
+	m.pods[pid] = pod
+	return pid
+}
+
+// RemovePod 混部Pod结束
+func (m *Machine) RemovePod(pid int) {
+	delete(m.pods, pid)
+}
+
+// 节点上混部Pod的驻留内存
+func (m *Machine) colocResident(node int) uint64 {
+	var used uint64
+	for _, pod := range m.pods {
+		used += pod.resident[node]
+	}
+	return used
+}
+
+// 节点实际空闲内存
+func (m *Machine) free(node int) uint64 {
+	free, used := m.nodeFree[node], m.colocResident(node)
+	if used > free {
+		return 0
+	}
+	return free - used
+}
+
+func (m *Machine) NumaMemInfo(node int) (memory_manager.NumaMemInfo, error) {
+	if _, ok := m.nodeFree[node]; !ok {
+		return memory_manager.NumaMemInfo{}, errors.New("numa node not in trace")
+	}
+	info := memory_manager.NumaMemInfo{Free: m.free(node), Total: m.nodeTotal[node]}
+	if info.Total < info.Free {
+		info.Total = m.nodeFree[node]
+	}
+	info.Used = info.Total - info.Free
+	// 模拟的节点没有页缓存
+	info.Available = info.Free
+	return info, nil
+}
+
+// PodsUsage 在线任务视为Burstable，混部Pod为BestEffort
+func (m *Machine) PodsUsage() (memory_manager.QoSUsage, error) {
+	var coloc uint64
+	for _, node := range m.topo.DramNodes {
+		coloc += m.colocResident(node)
+	}
+	return memory_manager.QoSUsage{
+		Total:      m.onlineUsed + coloc,
+		Burstable:  m.onlineUsed,
+		BestEffort: coloc,
+	}, nil
+}
+
+// CgroupMemoryUsage 模拟的Pod没有cgroup
+func (m *Machine) CgroupMemoryUsage(string) (uint64, error) {
+	return 0, errors.New("no cgroup in simulator")
+}
+
+// ProcessNumaUsage 模拟的Pod只有私有内存
+func (m *Machine) ProcessNumaUsage(pid int) (*memory_manager.NumaMapsUsage, error) {
+	pod, ok := m.pods[pid]
+	if !ok {
+		return nil, errNoSuchProcess
+	}
+	return &memory_manager.NumaMapsUsage{Private: maps.Clone(pod.resident)}, nil
+}
+
+func (m *Machine) MigratePages(pids []int, srcNodes, dstNodes []int) *memory_manager.MigrationResult {
+	result := &memory_manager.MigrationResult{}
+	for _, pid := range pids {
+		pod, ok := m.pods[pid]
+		if !ok {
+			result.Pids = append(result.Pids, memory_manager.PidMigrationResult{Pid: pid, Errno: syscall.ESRCH})
+			continue
+		}
+		var want uint64
+		for _, node := range srcNodes {
+			want += pod.resident[node]
+		}
+		moved := m.move(pod, srcNodes, dstNodes, want)
+		result.Pids = append(result.Pids, memory_manager.PidMigrationResult{
+			Pid:      pid,
+			NotMoved: int((want - moved) / m.pageSize),
+		})
+	}
+	return result
+}
+
+func (m *Machine) MovePages(pid int, srcNodes, dstNodes []int, budget uint64) (uint64, error) {
+	pod, ok := m.pods[pid]
+	if !ok {
+		return 0, errNoSuchProcess
+	}
+	return m.move(pod, srcNodes, dstNodes, budget), nil
+}
+
+// 把Pod在srcNodes上最多budget字节迁移到dstNodes，依次填满目标节点，空间不足时只迁移能放下的部分
+func (m *Machine) move(pod *simPod, srcNodes, dstNodes []int, budget uint64) uint64 {
+	var moved uint64
+	for _, src := range srcNodes {
+		if slices.Contains(dstNodes, src) {
+			continue
+		}
+		for _, dst := range dstNodes {
+			n := min(pod.resident[src], budget-moved, m.free(dst))
+			pod.resident[src] -= n
+			pod.resident[dst] += n
+			moved += n
+		}
+	}
+	if moved > 0 && m.onMigrate != nil {
+		m.onMigrate(migration{
+			pod:   pod.name,
+			toCxl: slices.ContainsFunc(dstNodes, func(n int) bool { return slices.Contains(m.topo.CxlNodes, n) }),
+			bytes: moved,
+		})
+	}
+	return moved
+}
@@ -0,0 +1,48 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Report 模拟结果
+type Report struct {
+	Duration    time.Duration `json:"duration"`
+	Adjustments int           `json:"adjustments"`
+	Reclaims    int           `json:"reclaims"`
+
+	AvgBlocks float64 `json:"avgBlocks"` // 按时间加权的平均上报块数
+	MinBlocks int     `json:"minBlocks"`
+	MaxBlocks int     `json:"maxBlocks"`
+
+	ScheduledPods      int           `json:"scheduledPods"`
+	PendingPods        int           `json:"pendingPods"` // 结束时仍在等待空闲块的Pod
+	AvgSchedulingDelay time.Duration `json:"avgSchedulingDelay"`
+
+	SwapOuts        int    `json:"swapOuts"`
+	SwapIns         int    `json:"swapIns"`
+	BytesSwappedOut uint64 `json:"bytesSwappedOut"`
+	BytesSwappedIn  uint64 `json:"bytesSwappedIn"`
+	PingPongs       int    `json:"pingPongs"`   // 迁回后很快又被交换出去的次数
+	SkippedPods     int    `json:"skippedPods"` // 池化内存容量不足被跳过的次数
+	EvictedPods     int    `json:"evictedPods"`
+
+	TimeBelowSafetyMargin time.Duration `json:"timeBelowSafetyMargin"` // DRAM实际空闲内存低于安全水位的时间
+
+	blockSeconds float64
+	totalWait    time.Duration
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "simulated:              %s (%d adjustments, %d reclaim checks)\n", r.Duration, r.Adjustments, r.Reclaims)
+	fmt.Fprintf(&b, "blocks advertised:      avg %.1f, min %d, max %d\n", r.AvgBlocks, max(r.MinBlocks, 0), r.MaxBlocks)
+	fmt.Fprintf(&b, "pods scheduled:         %d (avg delay %s), pending at end: %d\n", r.ScheduledPods, r.AvgSchedulingDelay, r.PendingPods)
+	fmt.Fprintf(&b, "swap-outs:              %d (%d MiB)\n", r.SwapOuts, r.BytesSwappedOut>>20)
+	fmt.Fprintf(&b, "swap-ins:               %d (%d MiB)\n", r.SwapIns, r.BytesSwappedIn>>20)
+	fmt.Fprintf(&b, "ping-pongs:             %d\n", r.PingPongs)
+	fmt.Fprintf(&b, "skipped / evicted:      %d / %d\n", r.SkippedPods, r.EvictedPods)
+	fmt.Fprintf(&b, "below safety margin:    %s", r.TimeBelowSafetyMargin)
+	return b.String()
+}
@@ -0,0 +1,276 @@
+package simulator
+
+/**
+author:liuyang
+date:2025-5-25
+离线模拟器：用虚拟时钟回放轨迹，驱动真实的UpdateState、adjustDevices和tryReclaimSwapBlocks逻辑
+用于上线前比较不同迁移模式和兜底策略的效果
+*/
+
+import (
+	"fmt"
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"liuyang/colocation-memory-device-plugin/pkg/device_plugin"
+	"liuyang/colocation-memory-device-plugin/pkg/memory_manager"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Options 模拟参数
+type Options struct {
+	AdjustInterval  time.Duration // 调整设备的周期，默认common.RefreshInterval
+	ReclaimInterval time.Duration // 回收巡检的周期，默认common.ReclaimCheckInterval
+	PingPongWindow  time.Duration // 迁回后在该时间内又被交换出去记为一次乒乓
+	Tail            time.Duration // 最后一个事件之后继续模拟的时间
+}
+
+func (o *Options) setDefaults() {
+	if o.AdjustInterval <= 0 {
+		o.AdjustInterval = common.RefreshInterval
+	}
+	if o.ReclaimInterval <= 0 {
+		o.ReclaimInterval = common.ReclaimCheckInterval
+	}
+	if o.PingPongWindow <= 0 {
+		o.PingPongWindow = 10 * time.Minute
+	}
+}
+
+type pendingPod struct {
+	event   *Event
+	arrival time.Duration
+}
+
+type Simulator struct {
+	config  *common.Config
+	opts    Options
+	events  []Event
+	machine *Machine
+	mm      *memory_manager.MemoryManager
+	dm      *device_plugin.DeviceMonitor
+	evictor *evictor
+
+	pending  []*pendingPod
+	pids     map[string]int           // Pod名称 -> 模拟的pid
+	lastIn   map[string]time.Duration // Pod最近一次迁回的时间
+	report   *Report
+	blocksAt time.Duration // 上次记录块数的时间
+}
+
+func New(config *common.Config, opts Options, events []Event) (*Simulator, error) {
+	if config.MigrationMode == common.MigrationModeDemotion {
+		return nil, fmt.Errorf("migration mode %q depends on kernel reclaim and cannot be simulated", config.MigrationMode)
+	}
+	if len(events) == 0 || events[0].Type != EventUsage || events[0].At.Duration != 0 {
+		return nil, fmt.Errorf("trace must start with a usage event at 0s")
+	}
+	opts.setDefaults()
+
+	topo, err := Topology(&events[0])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		config:  config,
+		opts:    opts,
+		events:  events,
+		machine: NewMachine(topo),
+		pids:    make(map[string]int),
+		lastIn:  make(map[string]time.Duration),
+		report:  &Report{MinBlocks: -1},
+	}
+	s.machine.onMigrate = s.recordMigration
+	return s, nil
+}
+
+// Topology 根据usage事件中出现的节点构造拓扑，节点0和1为DRAM节点，其余为CXL节点
+func Topology(usage *Event) (*memory_manager.NumaTopology, error) {
+	topo := &memory_manager.NumaTopology{DramNodes: []int{0, 1}}
+	for _, node := range slices.Sorted(maps.Keys(usage.NodeFree)) {
+		topo.Online = append(topo.Online, node)
+		topo.MaxNode = max(topo.MaxNode, node)
+		if !slices.Contains(topo.DramNodes, node) {
+			topo.CxlNodes = append(topo.CxlNodes, node)
+		}
+	}
+	if err := topo.Validate(topo.DramNodes); err != nil {
+		return nil, fmt.Errorf("usage event must cover nodes 0 and 1: %w", err)
+	}
+	return topo, nil
+}
+
+// Run 回放轨迹并返回统计结果
+func (s *Simulator) Run() (*Report, error) {
+	// 先应用开始时刻的内存数据，MemoryManager初始化时据此计算块数
+	next := 0
+	for next < len(s.events) && s.events[next].At.Duration == 0 && s.events[next].Type == EventUsage {
+		s.machine.ApplyUsage(&s.events[next])
+		next++
+	}
+
+	mm, err := memory_manager.NewOfflineMemoryManager(s.config, s.machine.topo, s.machine, s.machine)
+	if err != nil {
+		return nil, err
+	}
+	s.mm = mm
+	s.evictor = &evictor{s: s}
+	s.dm = device_plugin.NewOfflineDeviceMonitor(mm, s.evictor)
+
+	end := s.events[len(s.events)-1].At.Duration + s.opts.Tail
+	nextAdjust, nextReclaim := s.opts.AdjustInterval, s.opts.ReclaimInterval
+	var now time.Duration
+	for {
+		s.machine.now = now
+		for next < len(s.events) && s.events[next].At.Duration <= now {
+			s.apply(&s.events[next], now)
+			next++
+		}
+		s.schedulePending(now)
+
+		if now >= nextAdjust {
+			if err := s.dm.Adjust(); err != nil {
+				return nil, fmt.Errorf("adjust at %s: %w", now, err)
+			}
+			s.finishEvictions()
+			s.recordDecision(s.mm.LastDecision)
+			nextAdjust += s.opts.AdjustInterval
+		}
+		if now >= nextReclaim {
+			s.dm.Reclaim()
+			s.finishEvictions()
+			s.report.Reclaims++
+			nextReclaim += s.opts.ReclaimInterval
+		}
+		s.schedulePending(now)
+
+		if now >= end {
+			break
+		}
+		step := min(nextAdjust, nextReclaim, end)
+		if next < len(s.events) {
+			step = min(step, s.events[next].At.Duration)
+		}
+		s.sample(now, step)
+		now = step
+	}
+
+	s.report.Duration = now
+	s.report.PendingPods = len(s.pending)
+	if now > 0 {
+		s.report.AvgBlocks = s.report.blockSeconds / now.Seconds()
+	}
+	return s.report, nil
+}
+
+func (s *Simulator) apply(e *Event, now time.Duration) {
+	switch e.Type {
+	case EventUsage:
+		s.machine.ApplyUsage(e)
+	case EventArrive:
+		s.pending = append(s.pending, &pendingPod{event: e, arrival: now})
+	case EventDepart:
+		s.pending = slices.DeleteFunc(s.pending, func(p *pendingPod) bool { return p.event.Pod == e.Pod })
+		if pid, ok := s.pids[e.Pod]; ok {
+			s.mm.RemovePod(e.Pod)
+			s.machine.RemovePod(pid)
+			delete(s.pids, e.Pod)
+		}
+	}
+}
+
+// 等待本轮发起的兜底驱逐结束，被驱逐的Pod从节点上删除
+func (s *Simulator) finishEvictions() {
+	s.dm.WaitEvictions()
+	for _, pod := range s.evictor.drain() {
+		s.mm.RemovePod(pod)
+		delete(s.pids, pod)
+	}
+}
+
+// 模拟kubelet按到达顺序给Pod分配空闲块，空闲块不足的Pod继续等待
+func (s *Simulator) schedulePending(now time.Duration) {
+	if len(s.pending) == 0 {
+		return
+	}
+	var free []string
+	for _, block := range s.dm.State().Blocks {
+		if !block.Used {
+			free = append(free, block.ID)
+		}
+	}
+
+	remaining := s.pending[:0]
+	for _, p := range s.pending {
+		if len(free) < p.event.Blocks {
+			remaining = append(remaining, p)
+			continue
+		}
+		resident := p.event.ResidentBytes
+		if resident == 0 {
+			resident = uint64(p.event.Blocks) * common.BlockSize
+		}
+		namespace := p.event.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		pid := s.machine.AddPod(p.event.Pod, resident)
+		s.mm.AddPod(namespace, p.event.Pod, free[:p.event.Blocks], pid)
+		free = free[p.event.Blocks:]
+		s.pids[p.event.Pod] = pid
+		s.report.ScheduledPods++
+		s.report.totalWait += now - p.arrival
+	}
+	s.pending = remaining
+	if s.report.ScheduledPods > 0 {
+		s.report.AvgSchedulingDelay = s.report.totalWait / time.Duration(s.report.ScheduledPods)
+	}
+}
+
+// 记录[from, to)期间的块数和安全水位
+func (s *Simulator) sample(from, to time.Duration) {
+	blocks := len(s.dm.Devices())
+	if s.report.MinBlocks < 0 || blocks < s.report.MinBlocks {
+		s.report.MinBlocks = blocks
+	}
+	s.report.MaxBlocks = max(s.report.MaxBlocks, blocks)
+	s.report.blockSeconds += float64(blocks) * (to - from).Seconds()
+
+	var free, total uint64
+	for _, node := range s.machine.topo.DramNodes {
+		free += s.machine.free(node)
+		total += s.machine.nodeTotal[node]
+	}
+	margin := s.mm.SafetyMargin
+	if total > 0 {
+		margin = uint64(float64(total) * common.SafetyWatermark)
+	}
+	if free < margin {
+		s.report.TimeBelowSafetyMargin += to - from
+	}
+}
+
+func (s *Simulator) recordMigration(m migration) {
+	now := s.machine.now
+	if !m.toCxl {
+		s.report.SwapIns++
+		s.report.BytesSwappedIn += m.bytes
+		s.lastIn[m.pod] = now
+		return
+	}
+	s.report.SwapOuts++
+	s.report.BytesSwappedOut += m.bytes
+	if in, ok := s.lastIn[m.pod]; ok && now-in <= s.opts.PingPongWindow {
+		s.report.PingPongs++
+	}
+}
+
+func (s *Simulator) recordDecision(d *memory_manager.AdjustDecision) {
+	s.report.Adjustments++
+	if d == nil {
+		return
+	}
+	s.report.SkippedPods += len(d.SkippedPods)
+	s.report.EvictedPods += len(d.EvictedPods)
+}
@@ -0,0 +1,132 @@
+package simulator
+
+import (
+	"liuyang/colocation-memory-device-plugin/pkg/common"
+	"testing"
+	"time"
+)
+
+// 回放testdata中的轨迹，检查迁移和兜底策略的统计结果
+// burst.jsonl: 两个混部Pod先后占用30和15个块，2分钟后在线任务内存上涨，10分钟后回落，20分钟时job-1结束
+// small_cxl.jsonl: 同样的轨迹，但池化内存节点只有4GiB空闲，容纳不下任何一个Pod
+func TestRunTrace(t *testing.T) {
+	tests := []struct {
+		name     string
+		trace    string
+		mode     string
+		fallback string
+
+		swapOuts, swapIns  int
+		swappedOutMiB      uint64
+		skipped, evicted   int
+		wantSkippedAtLeast bool          // 每次调整都会重复跳过，只检查有跳过
+		belowSafetyMargin  time.Duration // 没有及时腾出DRAM的时间
+	}{
+		{name: "full", trace: "burst.jsonl", mode: common.MigrationModeFull, fallback: common.FallbackPolicySkip,
+			swapOuts: 1, swapIns: 1, swappedOutMiB: 15360},
+		{name: "partial", trace: "burst.jsonl", mode: common.MigrationModePartial, fallback: common.FallbackPolicySkip,
+			swapOuts: 3, swapIns: 2, swappedOutMiB: 12800, belowSafetyMargin: 20 * time.Second},
+		{name: "small cxl skip", trace: "small_cxl.jsonl", mode: common.MigrationModeFull, fallback: common.FallbackPolicySkip,
+			skipped: 1, wantSkippedAtLeast: true, belowSafetyMargin: 8 * time.Minute},
+		{name: "small cxl another-node", trace: "small_cxl.jsonl", mode: common.MigrationModeFull, fallback: common.FallbackPolicyOtherNode,
+			skipped: 1, wantSkippedAtLeast: true, belowSafetyMargin: 8 * time.Minute},
+		{name: "small cxl evict", trace: "small_cxl.jsonl", mode: common.MigrationModeFull, fallback: common.FallbackPolicyEvict,
+			evicted: 1},
+		{name: "small cxl evict partial", trace: "small_cxl.jsonl", mode: common.MigrationModePartial, fallback: common.FallbackPolicyEvict,
+			evicted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := LoadTrace("testdata/" + tt.trace)
+			if err != nil {
+				t.Fatalf("LoadTrace: %v", err)
+			}
+			config, err := common.LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			config.MigrationMode = tt.mode
+			config.FallbackPolicy = tt.fallback
+			config.AuditLogPath = ""
+
+			sim, err := New(config, Options{Tail: 5 * time.Minute}, events)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			report, err := sim.Run()
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			if report.Duration != 25*time.Minute {
+				t.Errorf("Duration = %s, want 25m", report.Duration)
+			}
+			if report.ScheduledPods != 2 || report.PendingPods != 0 {
+				t.Errorf("scheduled/pending = %d/%d, want 2/0", report.ScheduledPods, report.PendingPods)
+			}
+			if report.SwapOuts != tt.swapOuts || report.SwapIns != tt.swapIns {
+				t.Errorf("swap-outs/ins = %d/%d, want %d/%d", report.SwapOuts, report.SwapIns, tt.swapOuts, tt.swapIns)
+			}
+			if got := report.BytesSwappedOut >> 20; got != tt.swappedOutMiB {
+				t.Errorf("swapped out %d MiB, want %d", got, tt.swappedOutMiB)
+			}
+			if report.BytesSwappedIn != report.BytesSwappedOut {
+				t.Errorf("swapped in %d bytes, want everything swapped out (%d) back", report.BytesSwappedIn, report.BytesSwappedOut)
+			}
+			if tt.wantSkippedAtLeast {
+				if report.SkippedPods < tt.skipped {
+					t.Errorf("SkippedPods = %d, want at least %d", report.SkippedPods, tt.skipped)
+				}
+			} else if report.SkippedPods != tt.skipped {
+				t.Errorf("SkippedPods = %d, want %d", report.SkippedPods, tt.skipped)
+			}
+			if report.EvictedPods != tt.evicted {
+				t.Errorf("EvictedPods = %d, want %d", report.EvictedPods, tt.evicted)
+			}
+			if report.TimeBelowSafetyMargin != tt.belowSafetyMargin {
+				t.Errorf("TimeBelowSafetyMargin = %s, want %s", report.TimeBelowSafetyMargin, tt.belowSafetyMargin)
+			}
+		})
+	}
+}
+
+// 被驱逐的Pod离开模拟的节点，账本中不再有它和它绑定的块
+func TestRunEvictRemovesPod(t *testing.T) {
+	events, err := LoadTrace("testdata/small_cxl.jsonl")
+	if err != nil {
+		t.Fatalf("LoadTrace: %v", err)
+	}
+	config, err := common.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	config.MigrationMode = common.MigrationModeFull
+	config.FallbackPolicy = common.FallbackPolicyEvict
+	config.AuditLogPath = ""
+
+	// 在job-1结束之前停止，被驱逐的只能是兜底驱逐的Pod
+	sim, err := New(config, Options{}, events[:len(events)-1])
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := sim.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(sim.pids) != 1 || len(sim.machine.pods) != 1 {
+		t.Fatalf("pods left: pids=%v machine=%d, want one", sim.pids, len(sim.machine.pods))
+	}
+	state := sim.dm.State()
+	if len(state.Pods) != 1 {
+		t.Fatalf("ledger holds %d pods, want 1", len(state.Pods))
+	}
+	remaining := state.Pods[0].Name
+	if _, ok := sim.pids[remaining]; !ok {
+		t.Errorf("ledger keeps %s, simulator keeps %v", remaining, sim.pids)
+	}
+	for _, block := range state.Blocks {
+		if block.Used && block.BindPod != remaining {
+			t.Errorf("block %s still bound to evicted pod %s", block.ID, block.BindPod)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package simulator
+
+/**
+author:liuyang
+date:2025-5-25
+模拟器的输入：按时间排序的JSON Lines事件，每行一个事件
+{"at":"0s","type":"usage","onlineUsed":8589934592,"nodeFree":{"0":34359738368,"1":34359738368,"2":68719476736}}
+{"at":"30s","type":"arrive","pod":"job-1","blocks":8}
+{"at":"10m","type":"depart","pod":"job-1"}
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 事件类型
+const (
+	EventUsage  = "usage"  // 更新在线任务内存使用和各节点空闲内存
+	EventArrive = "arrive" // 混部Pod到达
+	EventDepart = "depart" // 混部Pod结束
+)
+
+// Event 一条轨迹事件
+type Event struct {
+	At   Duration `json:"at"`   // 相对轨迹开始的时间
+	Type string   `json:"type"` // 事件类型，见Event*
+
+	// usage
+	OnlineUsed uint64         `json:"onlineUsed,omitempty"` // 在线任务内存使用量
+	NodeFree   map[int]uint64 `json:"nodeFree,omitempty"`   // 各节点除混部Pod外的空闲内存，未出现的节点保持不变
+	NodeTotal  map[int]uint64 `json:"nodeTotal,omitempty"`  // 各节点总内存，用于计算安全水位
+
+	// arrive / depart
+	Pod           string `json:"pod,omitempty"`
+	Namespace     string `json:"namespace,omitempty"`
+	Blocks        int    `json:"blocks,omitempty"`        // 申请的混部内存块数
+	ResidentBytes uint64 `json:"residentBytes,omitempty"` // 实际驻留内存，默认等于申请的块大小
+}
+
+// Duration 支持"90s"、"5m"格式的时间
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// LoadTrace 读取轨迹文件，按时间排序，同一时间的事件保持文件中的顺序
+func LoadTrace(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].At.Duration < events[j].At.Duration
+	})
+	return events, nil
+}
+
+func (e *Event) validate() error {
+	switch e.Type {
+	case EventUsage:
+	case EventArrive:
+		if e.Pod == "" || e.Blocks <= 0 {
+			return fmt.Errorf("arrive event needs pod and positive blocks")
+		}
+	case EventDepart:
+		if e.Pod == "" {
+			return fmt.Errorf("depart event needs pod")
+		}
+	default:
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	return nil
+}
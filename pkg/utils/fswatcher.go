@@ -1,47 +1,91 @@
 package utils
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
-	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
-// WatchKubelet restart device plugin when kubelet restarted
-// 当kubelet重启后，device plugin也要重启
-func WatchKubelet(stop chan<- struct{}) error {
+// WatchKubelet re-register device plugin when kubelet restarted
+// 监听socket所在的目录而不是kubelet.sock文件本身：文件被删除后inotify对该inode的监听就失效了
+// kubelet.sock重新创建(kubelet重启)或插件自己的socket被删除(kubelet清理)时向restart发送通知，多次通知会合并
+// ctx取消后停止监听
+func WatchKubelet(ctx context.Context, kubeletSocket, pluginSocket string, restart chan<- struct{}) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return errors.WithMessage(err, "Unable to create fsnotify watcher")
 	}
-	defer watcher.Close()
+
+	kubeletSocket = filepath.Clean(kubeletSocket)
+	pluginSocket = filepath.Clean(pluginSocket)
+	for _, dir := range []string{filepath.Dir(kubeletSocket), filepath.Dir(pluginSocket)} {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return errors.WithMessagef(err, "Unable to add path %s to watcher", dir)
+		}
+	}
+
+	notify := func() {
+		select {
+		case restart <- struct{}{}:
+		default:
+		}
+	}
 
 	go func() {
+		defer watcher.Close()
 		// Start listening for events.
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case event, ok := <-watcher.Events:
 				if !ok {
-					continue
+					return
 				}
-				klog.Infof("fsnotify events: %s %v", event.Name, event.Op.String())
-				if event.Name == pluginapi.KubeletSocket && event.Op == fsnotify.Create {
-					klog.Warning("inotify: kubelet.sock created, restarting.")
-					stop <- struct{}{}
+				switch {
+				case event.Name == kubeletSocket && event.Has(fsnotify.Create):
+					klog.Warning("inotify: kubelet.sock created, re-registering.")
+					notify()
+				case event.Name == pluginSocket && event.Has(fsnotify.Remove):
+					// 插件重启gRPC服务时会先删除自己的socket，重新监听后socket已存在，不需要再次重启
+					if _, err := os.Stat(pluginSocket); err == nil {
+						continue
+					}
+					klog.Warningf("inotify: %s removed, re-registering.", pluginSocket)
+					notify()
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
-					continue
+					return
 				}
 				klog.Errorf("fsnotify failed restarting,detail:%v", err)
 			}
 		}
 	}()
+	return nil
+}
+
+// FileID 标识路径上的一个文件，文件被删除后重新创建时FileID会变化
+type FileID struct {
+	Ino     uint64
+	ModTime int64
+}
 
-	// watch kubelet.sock
-	err = watcher.Add(pluginapi.KubeletSocket)
+// StatFileID 返回path当前的FileID，文件不存在时返回false
+func StatFileID(path string) (FileID, bool) {
+	info, err := os.Stat(path)
 	if err != nil {
-		return errors.WithMessagef(err, "Unable to add path %s to watcher", pluginapi.KubeletSocket)
+		return FileID{}, false
 	}
-	return nil
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}, false
+	}
+	return FileID{Ino: stat.Ino, ModTime: info.ModTime().UnixNano()}, true
 }
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PatchNodeTaint 添加或移除节点上键为key的NoSchedule污点，返回节点的污点是否发生了变化
+// spec.taints是整体替换的列表，这里用merge patch只写taints，不带resourceVersion，不会和更新节点状态的组件冲突
+func PatchNodeTaint(ctx context.Context, clientset kubernetes.Interface, nodeName, key string, add bool) (bool, error) {
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	exists := slices.ContainsFunc(node.Spec.Taints, func(t corev1.Taint) bool {
+		return t.Key == key
+	})
+	if exists == add {
+		return false, nil
+	}
+	taints := make([]corev1.Taint, 0, len(node.Spec.Taints)+1)
+	for _, t := range node.Spec.Taints {
+		if t.Key != key {
+			taints = append(taints, t)
+		}
+	}
+	if add {
+		taints = append(taints, corev1.Taint{
+			Key:    key,
+			Effect: corev1.TaintEffectNoSchedule,
+		})
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{"taints": taints},
+	})
+	if err != nil {
+		return false, err
+	}
+	_, err = clientset.CoreV1().Nodes().Patch(ctx, nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err == nil, err
+}